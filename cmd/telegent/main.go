@@ -1,7 +1,14 @@
 package main
 
-import "telegent/internal/bridge"
+import (
+	"os"
+
+	"telegent/internal/bridge"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(bridge.RunCLI(os.Args[1:]))
+	}
 	bridge.Run()
 }
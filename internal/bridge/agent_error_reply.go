@@ -0,0 +1,82 @@
+package bridge
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const errorDetailsCallbackPrefix = "errdetail:"
+
+// Raw error texts behind the Details button. Only the most recent ones are
+// kept; older buttons answer that the details have expired.
+const maxErrorDetails = 50
+
+var (
+	errorDetailsMu    sync.Mutex
+	errorDetails      = map[string]string{}
+	errorDetailsOrder []string
+	errorDetailsSeq   atomic.Int64
+)
+
+func storeErrorDetails(detail string) string {
+	id := strconv.FormatInt(errorDetailsSeq.Add(1), 36)
+	errorDetailsMu.Lock()
+	defer errorDetailsMu.Unlock()
+	errorDetails[id] = detail
+	errorDetailsOrder = append(errorDetailsOrder, id)
+	for len(errorDetailsOrder) > maxErrorDetails {
+		delete(errorDetails, errorDetailsOrder[0])
+		errorDetailsOrder = errorDetailsOrder[1:]
+	}
+	return id
+}
+
+func lookupErrorDetails(id string) (string, bool) {
+	errorDetailsMu.Lock()
+	defer errorDetailsMu.Unlock()
+	d, ok := errorDetails[id]
+	return d, ok
+}
+
+func isAgentError(err error) bool {
+	var ae *agentError
+	return errors.As(err, &ae)
+}
+
+// agentErrorReply turns a failed run into the chat reply: a short explanation
+// plus any partial output. The raw error is stored for the Details button.
+func agentErrorReply(cfg bridgeConfig, err error, partial string) (string, string) {
+	resp := friendlyAgentError(err)
+	if p := strings.TrimSpace(partial); p != "" {
+		resp += "\n\npartial output:\n" + p
+	}
+	return trimForTelegram(resp, cfg.MaxReplyChars), storeErrorDetails(err.Error())
+}
+
+func sendAgentErrorReply(cfg bridgeConfig, chatID int64, resp string, detailsID string) {
+	if detailsID == "" {
+		_ = sendMessage(cfg, chatID, resp)
+		return
+	}
+	keyboard := telegramInlineKeyboard{InlineKeyboard: [][]telegramInlineButton{{
+		{Text: "Details", CallbackData: errorDetailsCallbackPrefix + detailsID},
+	}}}
+	if _, err := sendMessageWithKeyboard(cfg, chatID, resp, keyboard); err != nil {
+		log.Printf("agent error reply with keyboard failed chat_id=%d: %v", chatID, err)
+		_ = sendMessage(cfg, chatID, resp)
+	}
+}
+
+func handleErrorDetailsCallback(cfg bridgeConfig, cq telegramCallbackQuery, id string) {
+	detail, ok := lookupErrorDetails(id)
+	if !ok {
+		_ = answerCallbackQuery(cfg, cq.ID, "details expired.")
+		return
+	}
+	_ = answerCallbackQuery(cfg, cq.ID, "")
+	_ = sendMessage(cfg, cq.Message.Chat.ID, trimForTelegram("error details:\n"+detail, cfg.MaxReplyChars))
+}
@@ -0,0 +1,209 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+type agentErrorClass string
+
+const (
+	agentErrNone        agentErrorClass = ""
+	agentErrCancelled   agentErrorClass = "cancelled"
+	agentErrTimeout     agentErrorClass = "timeout"
+	agentErrExit        agentErrorClass = "exit"
+	agentErrAuth        agentErrorClass = "auth_required"
+	agentErrRateLimited agentErrorClass = "rate_limited"
+	// agentErrQuota is an exhausted quota or a billing problem: unlike a
+	// rate limit it does not clear up by waiting a few minutes.
+	agentErrQuota          agentErrorClass = "quota_exhausted"
+	agentErrInvalidSession agentErrorClass = "invalid_session"
+	agentErrNotFound       agentErrorClass = "binary_not_found"
+	// agentErrTransient covers overload and network trouble that may go away
+	// on its own.
+	agentErrTransient agentErrorClass = "transient"
+	agentErrOther     agentErrorClass = "other"
+)
+
+// agentError is what runners return for a failed run. Error() keeps the
+// historical "<err>\n<output>" shape; Class, Provider and ExitCode drive
+// retries, fallback and the message shown to the user.
+type agentError struct {
+	Class      agentErrorClass
+	Provider   string
+	ExitCode   int
+	TimeoutSec int
+	Detail     string
+	Err        error
+}
+
+func (e *agentError) Error() string {
+	if strings.TrimSpace(e.Detail) == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v\n%s", e.Err, e.Detail)
+}
+
+func (e *agentError) Unwrap() error { return e.Err }
+
+// Output patterns are checked in order; the first match wins. Session errors
+// come first because their wording often also says "not found". HTTP status
+// codes only count next to a word that marks them as one, since bare numbers
+// such as "port 5030" or "expected 200, got 403" turn up in ordinary output.
+var agentErrorPatterns = []struct {
+	class    agentErrorClass
+	patterns []string
+	status   *regexp.Regexp
+}{
+	{agentErrInvalidSession, []string{
+		"session not found", "no session found", "conversation not found", "no conversation found",
+		"invalid session", "unknown session", "thread not found", "no rollout found",
+		"could not find session", "session does not exist",
+	}, nil},
+	{agentErrNotFound, []string{"executable file not found", "command not found"}, nil},
+	{agentErrQuota, []string{"insufficient_quota", "quota exceeded", "billing"}, nil},
+	{agentErrAuth, []string{
+		"unauthorized", "invalid api key", "invalid_api_key", "not logged in",
+		"please log in", "please login", "login required", "authentication",
+	}, httpStatusPattern("401|403")},
+	{agentErrRateLimited, []string{"rate limit", "rate_limit", "too many requests", "usage limit"}, httpStatusPattern("429")},
+	{agentErrTransient, []string{
+		"overloaded", "bad gateway", "service unavailable", "gateway timeout",
+		"connection refused", "connection reset", "no such host", "network is unreachable",
+		"temporarily unavailable", "try again later", "stream disconnected", "unexpected eof",
+	}, httpStatusPattern("502|503|504")},
+	{agentErrTimeout, []string{"timeout after", "deadline exceeded"}, nil},
+}
+
+// httpStatusPattern matches one of codes as an HTTP status: after "status",
+// "http", "error" or "code", e.g. "status: 401", "HTTP/1.1 503",
+// "error 429".
+func httpStatusPattern(codes string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(?:status(?:[ _]?code)?|http(?:/[0-9.]+)?|error|code)[\s:=]*(?:` + codes + `)\b`)
+}
+
+func classifyAgentErrorText(text string) agentErrorClass {
+	msg := strings.ToLower(text)
+	for _, group := range agentErrorPatterns {
+		for _, p := range group.patterns {
+			if strings.Contains(msg, p) {
+				return group.class
+			}
+		}
+		if group.status != nil && group.status.MatchString(msg) {
+			return group.class
+		}
+	}
+	return agentErrNone
+}
+
+// newAgentExecError wraps the error of a finished agent process together with
+// its output, which is kept for the Details button, and classifies it from
+// the exit status and the patterns in diagnostics: the agent's stderr or
+// error events. The reply text is never classified, since an agent may well
+// talk about "401" or "rate limits" in a run that failed for other reasons.
+func newAgentExecError(err error, output string, diagnostics string) *agentError {
+	e := &agentError{ExitCode: -1, Detail: strings.TrimSpace(output), Err: err}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+		e.Class = agentErrNotFound
+		return e
+	case errors.As(err, &exitErr):
+		e.ExitCode = exitErr.ExitCode()
+	}
+	if class := classifyAgentErrorText(err.Error() + "\n" + diagnostics); class != agentErrNone {
+		e.Class = class
+		return e
+	}
+	switch {
+	case e.ExitCode == 127:
+		e.Class = agentErrNotFound
+	case e.ExitCode > 0:
+		e.Class = agentErrExit
+	default:
+		e.Class = agentErrOther
+	}
+	return e
+}
+
+func newAgentTimeoutError(timeoutSec int) *agentError {
+	return &agentError{Class: agentErrTimeout, ExitCode: -1, TimeoutSec: timeoutSec, Err: fmt.Errorf("timeout after %d seconds", timeoutSec)}
+}
+
+func classifyAgentError(err error) agentErrorClass {
+	if err == nil {
+		return agentErrNone
+	}
+	if errors.Is(err, errRunCancelled) || errors.Is(err, errBridgeShutdown) {
+		return agentErrCancelled
+	}
+	var ae *agentError
+	if errors.As(err, &ae) && ae.Class != agentErrNone {
+		return ae.Class
+	}
+	if class := classifyAgentErrorText(err.Error()); class != agentErrNone {
+		return class
+	}
+	return agentErrOther
+}
+
+// shouldFallback reports whether another provider should get the request
+// after a failure of this class.
+func shouldFallback(class agentErrorClass) bool {
+	switch class {
+	case agentErrTimeout, agentErrTransient, agentErrRateLimited, agentErrQuota, agentErrAuth, agentErrNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// shouldRetry reports whether the same provider is worth another try after a
+// short backoff.
+func shouldRetry(class agentErrorClass) bool {
+	return class == agentErrTransient || class == agentErrRateLimited
+}
+
+// friendlyAgentError is the short explanation shown in chat; the raw error is
+// kept behind the Details button.
+func friendlyAgentError(err error) string {
+	provider := "agent"
+	exitCode := -1
+	timeoutSec := 0
+	var ae *agentError
+	if errors.As(err, &ae) {
+		if ae.Provider != "" {
+			provider = ae.Provider
+		}
+		exitCode = ae.ExitCode
+		timeoutSec = ae.TimeoutSec
+	}
+	switch classifyAgentError(err) {
+	case agentErrTimeout:
+		if timeoutSec > 0 {
+			return fmt.Sprintf("timed out after %d s. The %s agent and everything it started were stopped.", timeoutSec, provider)
+		}
+		return "timed out. The " + provider + " agent and everything it started were stopped."
+	case agentErrAuth:
+		return "The " + provider + " agent needs you to sign in again, or its API key is not valid."
+	case agentErrQuota:
+		return "The " + provider + " agent is out of quota or has a billing problem. Check the account's plan and billing."
+	case agentErrRateLimited:
+		return "The " + provider + " agent is rate limited right now. Try again in a few minutes."
+	case agentErrInvalidSession:
+		return "The previous " + provider + " session is gone and a fresh one failed too. Try /newsession."
+	case agentErrNotFound:
+		return "The " + provider + " agent program was not found. Check AGENT_BIN / CODEX_BIN / CLAUDE_BIN."
+	case agentErrTransient:
+		return "The " + provider + " agent is temporarily unavailable (network or overload)."
+	case agentErrExit:
+		return fmt.Sprintf("The %s agent exited with code %d.", provider, exitCode)
+	default:
+		return "The " + provider + " agent failed."
+	}
+}
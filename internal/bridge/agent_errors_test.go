@@ -0,0 +1,111 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestClassifyAgentError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err  error
+		want agentErrorClass
+	}{
+		{nil, agentErrNone},
+		{errRunCancelled, agentErrCancelled},
+		{fmt.Errorf("wrapped: %w", errBridgeShutdown), agentErrCancelled},
+		{newAgentTimeoutError(180), agentErrTimeout},
+		{errors.New("exit status 1\nstream error: 429 Too Many Requests"), agentErrRateLimited},
+		{newOpenAIStatusError(503, "overloaded"), agentErrTransient},
+		{newOpenAIStatusError(401, "bad key"), agentErrAuth},
+		{errors.New("exit status 1\nInvalid API key"), agentErrAuth},
+		{errors.New("exit status 1\nerror: insufficient_quota"), agentErrQuota},
+		{errors.New("exit status 1\nError: Quota exceeded for this project"), agentErrQuota},
+		{errors.New("exit status 1\nCheck your plan and billing details"), agentErrQuota},
+		{newOpenAIStatusError(429, `{"error":{"code":"insufficient_quota"}}`), agentErrQuota},
+		{errors.New("exit status 1\nError: No conversation found with session ID: abc"), agentErrInvalidSession},
+		{errors.New("exit status 2\nsyntax error in prompt"), agentErrOther},
+		{errors.New("exit status 1\nrequest failed: status 401"), agentErrAuth},
+		{errors.New("exit status 1\nHTTP/1.1 503"), agentErrTransient},
+		{errors.New("exit status 1\nerror: 429"), agentErrRateLimited},
+		// Bare numbers are not status codes.
+		{errors.New("exit status 1\ntest failed: expected 200, got 403"), agentErrOther},
+		{errors.New("exit status 1\nlisten tcp :5030: address already in use"), agentErrOther},
+		{errors.New("exit status 1\nSyntaxError at line 4291"), agentErrOther},
+		{errors.New("exit status 1\nAssertionError: 401 != 200"), agentErrOther},
+	}
+	for _, tc := range cases {
+		if got := classifyAgentError(tc.err); got != tc.want {
+			t.Fatalf("classifyAgentError(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+	if shouldFallback(agentErrCancelled) || shouldFallback(agentErrExit) || !shouldFallback(agentErrRateLimited) {
+		t.Fatal("unexpected shouldFallback result")
+	}
+	if shouldRetry(agentErrTimeout) || shouldRetry(agentErrQuota) || !shouldRetry(agentErrTransient) {
+		t.Fatal("unexpected shouldRetry result")
+	}
+}
+
+func TestNewAgentExecError(t *testing.T) {
+	t.Parallel()
+
+	err := exec.Command("/bin/sh", "-c", "exit 3").Run()
+	e := newAgentExecError(err, "something broke", "")
+	if e.Class != agentErrExit || e.ExitCode != 3 {
+		t.Fatalf("exit error = %+v", e)
+	}
+	if e.Error() != "exit status 3\nsomething broke" {
+		t.Fatalf("Error() = %q", e.Error())
+	}
+
+	_, err = exec.LookPath("telegent-no-such-agent")
+	if e := newAgentExecError(err, "", ""); e.Class != agentErrNotFound {
+		t.Fatalf("missing binary class = %q", e.Class)
+	}
+	err = exec.Command("/nonexistent/agent").Run()
+	if e := newAgentExecError(err, "", ""); e.Class != agentErrNotFound {
+		t.Fatalf("missing path class = %q", e.Class)
+	}
+	err = exec.Command("/bin/sh", "-c", "exit 127").Run()
+	if e := newAgentExecError(err, "", ""); e.Class != agentErrNotFound {
+		t.Fatalf("exit 127 class = %q", e.Class)
+	}
+
+	// Only the diagnostics are classified, not what the agent replied.
+	err = exec.Command("/bin/sh", "-c", "exit 1").Run()
+	e = newAgentExecError(err, "the API returned 401, and then we hit the rate limit", "tests failed")
+	if e.Class != agentErrExit {
+		t.Fatalf("reply text classified as %q", e.Class)
+	}
+	if e := newAgentExecError(err, "", "Error: rate limit exceeded"); e.Class != agentErrRateLimited {
+		t.Fatalf("stderr class = %q", e.Class)
+	}
+}
+
+func TestFriendlyAgentErrorAndDetails(t *testing.T) {
+	t.Parallel()
+
+	err := &agentError{Class: agentErrRateLimited, Provider: "codex", ExitCode: 1, Detail: "429 Too Many Requests", Err: errors.New("exit status 1")}
+	resp, id := agentErrorReply(bridgeConfig{MaxReplyChars: 3500}, err, "half an answer")
+	if !strings.HasPrefix(resp, "The codex agent is rate limited") || !strings.Contains(resp, "partial output:\nhalf an answer") {
+		t.Fatalf("unexpected reply: %q", resp)
+	}
+	if strings.Contains(resp, "429") {
+		t.Fatalf("raw error leaked into the reply: %q", resp)
+	}
+	detail, ok := lookupErrorDetails(id)
+	if !ok || detail != "exit status 1\n429 Too Many Requests" {
+		t.Fatalf("details = %q %v", detail, ok)
+	}
+
+	quota := newAgentExecError(errors.New("exit status 1"), "", "insufficient_quota")
+	quota.Provider = "codex"
+	if got := friendlyAgentError(quota); !strings.Contains(got, "out of quota") {
+		t.Fatalf("quota message = %q", got)
+	}
+}
@@ -3,7 +3,9 @@ package bridge
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -16,62 +18,171 @@ import (
 type agentRunResult struct {
 	Output    string
 	SessionID string
+	Usage     agentUsage
+}
+
+type agentUsage struct {
+	InputTokens       int64
+	CachedInputTokens int64
+	OutputTokens      int64
+	// TotalTokens is set when only a total is known, e.g. from text output.
+	TotalTokens int64
+	CostUSD     float64
 }
 
 type agentRunner interface {
 	Name() string
 	SupportsImages() bool
-	Run(cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error)
+	Run(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error)
+}
+
+// runAgent returns whatever output the runner produced even when err is set,
+// so callers can surface partial output of cancelled runs. Transient failures
+// are retried with backoff, a vanished session is replaced by a fresh one,
+// and when the chat's provider still fails with a timeout, transient or
+// provider-level error the request moves on to the providers in
+// AGENT_FALLBACK, each with its own session.
+func runAgent(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (string, string, error) {
+	chain := agentProviderChain(chatConfig(cfg, chatID))
+
+	var failures []string
+	for i, provider := range chain {
+		attemptCfg := chatConfigForProvider(cfg, chatID, provider)
+		if sec := runTimeoutOverride(ctx); sec > 0 {
+			attemptCfg.TimeoutSec = sec
+		}
+		out, sid, err := runAgentWithRetry(ctx, attemptCfg, chatID, prompt, imagePaths)
+		if err == nil {
+			if len(failures) > 0 {
+				out = "[answered by " + provider + "; " + strings.Join(failures, "; ") + "]\n\n" + out
+			}
+			return out, sid, nil
+		}
+		var ae *agentError
+		if errors.As(err, &ae) && ae.Provider == "" {
+			ae.Provider = provider
+		}
+		class := classifyAgentError(err)
+		if i == len(chain)-1 || !shouldFallback(class) || ctx.Err() != nil {
+			return out, "", err
+		}
+		log.Printf("[agent] falling back chat_id=%d from=%s to=%s class=%s err=%v", chatID, provider, chain[i+1], class, err)
+		failures = append(failures, provider+" failed ("+string(class)+")")
+	}
+	return "", "", errors.New("no agent provider configured")
+}
+
+func runAgentWithRetry(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (string, string, error) {
+	freshSession := false
+	for attempt := 0; ; attempt++ {
+		out, sid, err := runAgentOnce(ctx, cfg, chatID, prompt, imagePaths)
+		if err == nil || ctx.Err() != nil {
+			return out, sid, err
+		}
+		class := classifyAgentError(err)
+		switch {
+		case class == agentErrInvalidSession && !freshSession:
+			// The agent lost the session we resumed; start over so the
+			// next attempt injects context into a new session.
+			log.Printf("[agent] session gone provider=%s chat_id=%d session=%q; starting a fresh one", cfg.AgentProvider, chatID, getRunSessionID(ctx, cfg.AgentProvider, chatID))
+			clearRunSession(ctx, cfg, cfg.AgentProvider, chatID)
+			freshSession = true
+		case shouldRetry(class) && attempt < cfg.AgentMaxRetries:
+			delay := time.Duration(cfg.AgentRetryBackoffMs) * time.Millisecond << attempt
+			log.Printf("[agent] retrying provider=%s chat_id=%d class=%s attempt=%d delay=%s", cfg.AgentProvider, chatID, class, attempt+1, delay)
+			select {
+			case <-ctx.Done():
+				return out, sid, err
+			case <-time.After(delay):
+			}
+		default:
+			return out, sid, err
+		}
+	}
 }
 
-func runAgent(cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (string, string, error) {
+// agentProviderChain is the chat's provider followed by the fallback list.
+func agentProviderChain(cfg bridgeConfig) []string {
+	chain := []string{cfg.AgentProvider}
+	for _, p := range cfg.AgentFallback {
+		if p != cfg.AgentProvider {
+			chain = append(chain, p)
+		}
+	}
+	return chain
+}
+
+func runAgentOnce(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (string, string, error) {
 	runner := selectRunner(cfg)
-	existingSessionID := strings.TrimSpace(getChatSessionID(runner.Name(), chatID))
-	finalPrompt := buildPromptWithMemory(cfg, prompt, existingSessionID == "")
+	rec, resumed := getRunSession(ctx, runner.Name(), chatID)
+	rolloverNotice := ""
+	if resumed {
+		if reason := sessionRolloverReason(cfg, rec, time.Now()); reason != "" {
+			log.Printf("[agent] session rollover provider=%s chat_id=%d session=%q: %s", runner.Name(), chatID, rec.SessionID, reason)
+			clearRunSession(ctx, cfg, runner.Name(), chatID)
+			rolloverNotice = "[started a new session: " + reason + "; /sessions can resume it]\n\n"
+			rec, resumed = sessionRecord{}, false
+		}
+	}
+	existingSessionID := strings.TrimSpace(rec.SessionID)
+	contextHash := promptContextHash(cfg)
+	finalPrompt, injected := buildTurnPrompt(cfg, prompt, rec, resumed, contextHash)
 	processedPrompt, processedImages, err := preprocessForRunner(cfg, runner, finalPrompt, imagePaths)
 	if err != nil {
 		log.Printf("[agent] preprocess failed provider=%s chat_id=%d err=%v", runner.Name(), chatID, err)
 		return "", "", err
 	}
 
-	log.Printf("[agent] request provider=%s chat_id=%d images=%d session=%q inject_context=%t", runner.Name(), chatID, len(processedImages), existingSessionID, existingSessionID == "")
+	log.Printf("[agent] request provider=%s chat_id=%d images=%d session=%q inject_context=%t", runner.Name(), chatID, len(processedImages), existingSessionID, injected)
 	if len(processedImages) > 0 {
 		log.Printf("[agent] image_paths provider=%s chat_id=%d paths=%q", runner.Name(), chatID, processedImages)
 	}
 	log.Printf("[agent] prompt begin provider=%s chat_id=%d\n%s\n[agent] prompt end provider=%s chat_id=%d", runner.Name(), chatID, processedPrompt, runner.Name(), chatID)
-	res, err := runner.Run(cfg, chatID, processedPrompt, processedImages)
+	started := time.Now()
+	res, err := runner.Run(ctx, cfg, chatID, processedPrompt, processedImages)
+	if alert := recordAgentUsage(cfg, chatID, started, res.Usage, err); alert != "" {
+		log.Printf("[agent] budget alert chat_id=%d: %s", chatID, alert)
+		_ = sendMessage(cfg, chatID, alert)
+	}
+	if shouldAuditAgentRun(cfg) {
+		appendAudit(cfg, "user:"+strconv.FormatInt(cfg.AllowedUserID, 10), "agent_run", auditArgsForAgentRun(cfg, runner.Name(), chatID, prompt), auditOutcome(err))
+	}
 	if err != nil {
 		log.Printf("[agent] response error provider=%s chat_id=%d err=%v", runner.Name(), chatID, err)
-		return "", "", err
+		return strings.TrimSpace(res.Output), "", err
 	}
 
+	log.Printf("[agent] usage provider=%s chat_id=%d tokens_in=%d tokens_cached=%d tokens_out=%d tokens_total=%d cost_usd=%.4f", runner.Name(), chatID, res.Usage.InputTokens, res.Usage.CachedInputTokens, res.Usage.OutputTokens, res.Usage.Total(), res.Usage.CostUSD)
 	log.Printf("[agent] response provider=%s chat_id=%d session=%q output begin\n%s\n[agent] response provider=%s chat_id=%d output end", runner.Name(), chatID, strings.TrimSpace(res.SessionID), strings.TrimSpace(res.Output), runner.Name(), chatID)
 	if strings.TrimSpace(res.SessionID) != "" {
-		setChatSessionID(cfg, runner.Name(), chatID, strings.TrimSpace(res.SessionID))
+		recordSessionTurn(ctx, cfg, runner.Name(), chatID, rec, strings.TrimSpace(res.SessionID), contextHash)
+		if !isScopedSession(ctx) {
+			recordSessionUse(cfg, runner.Name(), chatID, strings.TrimSpace(res.SessionID), prompt, contextHash)
+		}
 	}
-	return strings.TrimSpace(res.Output), strings.TrimSpace(res.SessionID), nil
+	return rolloverNotice + strings.TrimSpace(res.Output), strings.TrimSpace(res.SessionID), nil
 }
 
-func runCodexWithImages(cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (string, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSec)*time.Second)
+func runCodexWithImages(parent context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
+	ctx, cancel := context.WithTimeout(parent, time.Duration(cfg.TimeoutSec)*time.Second)
 	defer cancel()
 	finalPrompt := prompt
 
-	existingSessionID := getChatSessionID("codex", chatID)
+	existingSessionID := getRunSessionID(ctx, "codex", chatID)
 	useOutputLastMessage := existingSessionID == ""
 
 	lastMsgPath := ""
 	if useOutputLastMessage {
 		lastMsgFile, err := os.CreateTemp(os.TempDir(), "codex-last-message-*.txt")
 		if err != nil {
-			return "", "", fmt.Errorf("failed to create temp file for codex output: %w", err)
+			return agentRunResult{}, fmt.Errorf("failed to create temp file for codex output: %w", err)
 		}
 		lastMsgPath = lastMsgFile.Name()
 		_ = lastMsgFile.Close()
 		defer os.Remove(lastMsgPath)
 	}
 
-	args := []string{"exec"}
+	args := []string{"exec", "--json"}
 	if cfg.CodexSandbox != "" {
 		args = append(args, "--sandbox", cfg.CodexSandbox)
 	}
@@ -97,26 +208,56 @@ func runCodexWithImages(cfg bridgeConfig, chatID int64, prompt string, imagePath
 
 	cmd := exec.CommandContext(ctx, cfg.CodexBin, args...)
 	cmd.Dir = cfg.CodexWorkdir
+	releaseGroup := startInProcessGroup(cmd, killGrace(cfg))
 
-	var combined bytes.Buffer
-	cmd.Stdout = &combined
-	cmd.Stderr = &combined
+	// stdout carries the JSONL event stream; combined keeps the interleaved
+	// human-readable output for the legacy parser.
+	var stdout, stderr bytes.Buffer
+	combined := &lockedBuffer{}
+	cmd.Stdout = io.MultiWriter(&stdout, combined)
+	cmd.Stderr = io.MultiWriter(&stderr, combined)
 
 	err := cmd.Run()
+	releaseGroup()
+	events := parseCodexEventStream(stdout.String())
+	if isRunCancelled(parent) {
+		log.Printf("[codex] cancelled chat_id=%d session=%q args=%q", chatID, existingSessionID, args)
+		partial := events.PartialReply()
+		if events.Events == 0 {
+			partial = cleanCodexOutput(combined.String())
+		}
+		return agentRunResult{Output: partial, SessionID: existingSessionID}, errRunCancelled
+	}
 	if ctx.Err() == context.DeadlineExceeded {
 		log.Printf("[codex] timeout chat_id=%d session=%q args=%q", chatID, existingSessionID, args)
-		return "", existingSessionID, fmt.Errorf("timeout after %d seconds", cfg.TimeoutSec)
+		partial := events.PartialReply()
+		if events.Events == 0 {
+			partial = cleanCodexOutput(combined.String())
+		}
+		return agentRunResult{Output: partial, SessionID: existingSessionID}, newAgentTimeoutError(cfg.TimeoutSec)
 	}
 	if err != nil {
 		log.Printf("[codex] exec failed chat_id=%d session=%q args=%q output=%q err=%v", chatID, existingSessionID, args, combined.String(), err)
-		return "", existingSessionID, fmt.Errorf("%v\n%s", err, combined.String())
+		if len(events.Errors) > 0 {
+			errText := strings.Join(events.Errors, "\n")
+			return agentRunResult{SessionID: existingSessionID}, newAgentExecError(err, errText, errText)
+		}
+		return agentRunResult{SessionID: existingSessionID}, newAgentExecError(err, combined.String(), stderr.String())
+	}
+
+	if events.Events > 0 {
+		return codexResultFromEvents(chatID, existingSessionID, events, lastMsgPath), nil
 	}
-	log.Printf("[codex] exec ok chat_id=%d session_before=%q session_after=%q args=%q raw_output begin\n%s\n[codex] exec ok chat_id=%d raw_output end", chatID, existingSessionID, parseSessionID(combined.String()), args, combined.String(), chatID)
+
+	// No structured events: an older codex without --json support, so fall
+	// back to scraping the human-readable output.
+	log.Printf("[codex] exec ok (no json events) chat_id=%d session_before=%q session_after=%q args=%q raw_output begin\n%s\n[codex] exec ok chat_id=%d raw_output end", chatID, existingSessionID, parseSessionID(combined.String()), args, combined.String(), chatID)
 
 	actualSessionID := parseSessionID(combined.String())
 	if actualSessionID == "" {
 		actualSessionID = existingSessionID
 	}
+	usage := parseUsageText(combined.String())
 
 	if useOutputLastMessage {
 		lastMsg, err := os.ReadFile(lastMsgPath)
@@ -124,31 +265,82 @@ func runCodexWithImages(cfg bridgeConfig, chatID int64, prompt string, imagePath
 			final := strings.TrimSpace(string(lastMsg))
 			if final != "" {
 				log.Printf("[codex] output-last-message chat_id=%d session=%q value begin\n%s\n[codex] output-last-message chat_id=%d value end", chatID, actualSessionID, final, chatID)
-				return final, actualSessionID, nil
+				return agentRunResult{Output: final, SessionID: actualSessionID, Usage: usage}, nil
 			}
 		}
 	}
 
 	if resumed := extractAssistantReply(combined.String()); resumed != "" {
 		log.Printf("[codex] extracted assistant reply chat_id=%d session=%q value begin\n%s\n[codex] extracted assistant reply chat_id=%d value end", chatID, actualSessionID, resumed, chatID)
-		return resumed, actualSessionID, nil
+		return agentRunResult{Output: resumed, SessionID: actualSessionID, Usage: usage}, nil
 	}
 
 	clean := cleanCodexOutput(combined.String())
 	log.Printf("[codex] clean output chat_id=%d session=%q value begin\n%s\n[codex] clean output chat_id=%d value end", chatID, actualSessionID, clean, chatID)
-	return clean, actualSessionID, nil
+	return agentRunResult{Output: clean, SessionID: actualSessionID, Usage: usage}, nil
+}
+
+func codexResultFromEvents(chatID int64, existingSessionID string, events codexRunSummary, lastMsgPath string) agentRunResult {
+	sessionID := events.SessionID
+	if sessionID == "" {
+		sessionID = existingSessionID
+	}
+	reply := events.FinalReply()
+	if reply == "" && lastMsgPath != "" {
+		if lastMsg, err := os.ReadFile(lastMsgPath); err == nil {
+			reply = strings.TrimSpace(string(lastMsg))
+		}
+	}
+	log.Printf("[codex] exec ok chat_id=%d session_before=%q session_after=%q events=%d messages=%d commands=%d file_changes=%d tokens_in=%d tokens_cached=%d tokens_out=%d reply begin\n%s\n[codex] exec ok chat_id=%d reply end",
+		chatID, existingSessionID, sessionID, events.Events, len(events.Messages), len(events.Commands), len(events.FileChanges),
+		events.Usage.InputTokens, events.Usage.CachedInputTokens, events.Usage.OutputTokens, reply, chatID)
+	return agentRunResult{Output: reply, SessionID: sessionID, Usage: events.Usage}
 }
 
 type codexRunner struct{}
 
 func (c codexRunner) Name() string         { return "codex" }
 func (c codexRunner) SupportsImages() bool { return true }
-func (c codexRunner) Run(cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
-	out, sid, err := runCodexWithImages(cfg, chatID, prompt, imagePaths)
+func (c codexRunner) Run(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
+	res, err := runCodexWithImages(ctx, cfg, chatID, prompt, imagePaths)
 	if err != nil {
-		return agentRunResult{}, err
+		// Only the output survives a failed run; the session stays unchanged.
+		return agentRunResult{Output: res.Output}, err
 	}
-	return agentRunResult{Output: out, SessionID: sid}, nil
+	return res, nil
+}
+
+// genericAgentConfig is the command line of one generic provider; see
+// loadGenericAgentConfig.
+type genericAgentConfig struct {
+	Bin           string
+	Args          string
+	ResumeArgs    string
+	SupportsImage bool
+}
+
+// isBuiltinProvider reports whether name has a runner of its own; any other
+// provider runs as a generic CLI.
+func isBuiltinProvider(name string) bool {
+	switch name {
+	case "", "codex", "claude", "openai":
+		return true
+	}
+	return false
+}
+
+// configForProvider points cfg at provider. A generic provider gets its own
+// binary, argument templates and image support in the AGENT_* fields the
+// generic runner reads.
+func configForProvider(cfg bridgeConfig, provider string) bridgeConfig {
+	cfg.AgentProvider = provider
+	if g, ok := cfg.GenericAgents[provider]; ok {
+		cfg.AgentBin = g.Bin
+		cfg.AgentArgs = g.Args
+		cfg.AgentResumeArgs = g.ResumeArgs
+		cfg.AgentSupportsImage = g.SupportsImage
+	}
+	return cfg
 }
 
 type genericRunner struct {
@@ -164,20 +356,41 @@ func (g genericRunner) Name() string {
 }
 func (g genericRunner) SupportsImages() bool { return g.supportsImage }
 
-func buildGenericRunnerArgs(cfg bridgeConfig, prompt string, sessionID string, imagePaths []string) ([]string, error) {
+// buildGenericRunnerArgs expands AGENT_ARGS, or AGENT_RESUME_ARGS when resume
+// is set and a resume template is configured. The prompt only lands in argv in
+// the argv prompt mode; in file mode promptFile is passed instead.
+func buildGenericRunnerArgs(cfg bridgeConfig, prompt string, promptFile string, sessionID string, resume bool, imagePaths []string) ([]string, error) {
 	imageJoined := strings.Join(imagePaths, ",")
-	rawArgs, err := parseCommandArgs(cfg.AgentArgs)
+	template, templateName := cfg.AgentArgs, "AGENT_ARGS"
+	if resume && strings.TrimSpace(cfg.AgentResumeArgs) != "" {
+		template, templateName = cfg.AgentResumeArgs, "AGENT_RESUME_ARGS"
+	}
+	rawArgs, err := parseCommandArgs(template)
 	if err != nil {
-		return nil, fmt.Errorf("invalid AGENT_ARGS: %w", err)
+		return nil, fmt.Errorf("invalid %s: %w", templateName, err)
+	}
+	mode := cfg.AgentPromptMode
+	if mode == "" {
+		mode = promptModeArgv
 	}
 	args := make([]string, 0, len(rawArgs)+4)
 	promptAttached := false
 	imageAttached := false
 	for _, a := range rawArgs {
 		if strings.Contains(a, "{{prompt}}") {
+			if mode != promptModeArgv {
+				return nil, fmt.Errorf("%s uses {{prompt}} but AGENT_PROMPT_MODE=%s", templateName, mode)
+			}
 			a = strings.ReplaceAll(a, "{{prompt}}", prompt)
 			promptAttached = true
 		}
+		if strings.Contains(a, "{{prompt_file}}") {
+			if mode != promptModeFile {
+				return nil, fmt.Errorf("%s uses {{prompt_file}} but AGENT_PROMPT_MODE=%s", templateName, mode)
+			}
+			a = strings.ReplaceAll(a, "{{prompt_file}}", promptFile)
+			promptAttached = true
+		}
 		if strings.Contains(a, "{{session_id}}") {
 			a = strings.ReplaceAll(a, "{{session_id}}", sessionID)
 		}
@@ -195,45 +408,81 @@ func buildGenericRunnerArgs(cfg bridgeConfig, prompt string, sessionID string, i
 		}
 	}
 	if !promptAttached {
-		args = append(args, prompt)
+		switch mode {
+		case promptModeArgv:
+			args = append(args, prompt)
+		case promptModeFile:
+			args = append(args, promptFile)
+		}
 	}
 	return args, nil
 }
 
-func (g genericRunner) Run(cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
-	sessionID := getChatSessionID(g.Name(), chatID)
-	if sessionID == "" {
+func (g genericRunner) Run(parent context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
+	sessionID := getRunSessionID(parent, g.Name(), chatID)
+	resume := sessionID != ""
+	if !resume && !genericSessionExtractionEnabled(cfg) {
+		// Without a way to learn the agent's own session ID, make one up and
+		// hope the tool accepts arbitrary IDs.
 		sessionID = strconv.FormatInt(time.Now().UnixNano(), 10)
 	}
 
-	args, err := buildGenericRunnerArgs(cfg, prompt, sessionID, imagePaths)
+	promptFile := ""
+	if cfg.AgentPromptMode == promptModeFile {
+		var err error
+		promptFile, err = writePromptFile(cfg, prompt)
+		if err != nil {
+			return agentRunResult{}, err
+		}
+		defer os.Remove(promptFile)
+	}
+
+	args, err := buildGenericRunnerArgs(cfg, prompt, promptFile, sessionID, resume, imagePaths)
 	if err != nil {
 		return agentRunResult{}, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSec)*time.Second)
+	ctx, cancel := context.WithTimeout(parent, time.Duration(cfg.TimeoutSec)*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, cfg.AgentBin, args...)
 	cmd.Dir = cfg.CodexWorkdir
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	if err := cmd.Run(); err != nil {
+	attachPromptInput(cmd, cfg, prompt)
+	releaseGroup := startInProcessGroup(cmd, killGrace(cfg))
+	// out keeps both streams interleaved for the reply and the Details
+	// button; only stderr is used to classify a failure.
+	out := &lockedBuffer{}
+	var stderr bytes.Buffer
+	cmd.Stdout = out
+	cmd.Stderr = io.MultiWriter(out, &stderr)
+	err = cmd.Run()
+	releaseGroup()
+	if err != nil {
+		if isRunCancelled(parent) {
+			log.Printf("[agent-generic] cancelled provider=%s chat_id=%d args=%q", g.Name(), chatID, args)
+			return agentRunResult{Output: strings.TrimSpace(out.String())}, errRunCancelled
+		}
 		if ctx.Err() == context.DeadlineExceeded {
 			log.Printf("[agent-generic] timeout provider=%s chat_id=%d args=%q", g.Name(), chatID, args)
-			return agentRunResult{}, fmt.Errorf("timeout after %d seconds", cfg.TimeoutSec)
+			return agentRunResult{Output: strings.TrimSpace(out.String())}, newAgentTimeoutError(cfg.TimeoutSec)
 		}
 		log.Printf("[agent-generic] exec failed provider=%s chat_id=%d args=%q output=%q err=%v", g.Name(), chatID, args, out.String(), err)
-		return agentRunResult{}, fmt.Errorf("%v\n%s", err, out.String())
+		return agentRunResult{}, newAgentExecError(err, out.String(), stderr.String())
+	}
+	if found := extractGenericSessionID(cfg, out.String()); found != "" {
+		sessionID = found
 	}
 	log.Printf("[agent-generic] exec ok provider=%s chat_id=%d session=%q args=%q output begin\n%s\n[agent-generic] exec ok provider=%s chat_id=%d output end", g.Name(), chatID, sessionID, args, strings.TrimSpace(out.String()), g.Name(), chatID)
-	return agentRunResult{Output: strings.TrimSpace(out.String()), SessionID: sessionID}, nil
+	return agentRunResult{Output: extractGenericReply(cfg, out.String()), SessionID: sessionID, Usage: parseUsageText(out.String())}, nil
 }
 
 func selectRunner(cfg bridgeConfig) agentRunner {
 	switch cfg.AgentProvider {
 	case "", "codex":
 		return codexRunner{}
+	case "claude":
+		return claudeRunner{}
+	case "openai":
+		return openAIRunner{}
 	case "generic", "command", "cli":
 		return genericRunner{name: cfg.AgentProvider, supportsImage: cfg.AgentSupportsImage}
 	default:
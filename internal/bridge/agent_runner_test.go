@@ -1,7 +1,12 @@
 package bridge
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,7 +18,7 @@ func TestBuildGenericRunnerArgs(t *testing.T) {
 		AgentSupportsImage: true,
 	}
 
-	got, err := buildGenericRunnerArgs(cfg, "hello world", "sid-1", []string{"/tmp/1.png", "/tmp/2.png"})
+	got, err := buildGenericRunnerArgs(cfg, "hello world", "", "sid-1", false, []string{"/tmp/1.png", "/tmp/2.png"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -35,7 +40,7 @@ func TestBuildGenericRunnerArgs_AutoAppendPromptAndImage(t *testing.T) {
 		AgentArgs:          `--mode fast`,
 		AgentSupportsImage: true,
 	}
-	got, err := buildGenericRunnerArgs(cfg, "hello", "sid-2", []string{"/tmp/img.png"})
+	got, err := buildGenericRunnerArgs(cfg, "hello", "", "sid-2", false, []string{"/tmp/img.png"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -52,8 +57,171 @@ func TestBuildGenericRunnerArgs_InvalidArgs(t *testing.T) {
 	cfg := bridgeConfig{
 		AgentArgs: `--message "broken`,
 	}
-	_, err := buildGenericRunnerArgs(cfg, "hello", "sid", nil)
+	_, err := buildGenericRunnerArgs(cfg, "hello", "", "sid", false, nil)
 	if err == nil {
 		t.Fatal("expected error for invalid AGENT_ARGS, got nil")
 	}
 }
+
+func TestBuildGenericRunnerArgs_ResumeTemplate(t *testing.T) {
+	t.Parallel()
+
+	cfg := bridgeConfig{
+		AgentArgs:       `run --json "{{prompt}}"`,
+		AgentResumeArgs: `run --json --resume "{{session_id}}" "{{prompt}}"`,
+	}
+	got, err := buildGenericRunnerArgs(cfg, "hi", "", "", false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"run", "--json", "hi"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("new session args mismatch\ngot : %v\nwant: %v", got, want)
+	}
+	got, err = buildGenericRunnerArgs(cfg, "hi", "", "abc", true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"run", "--json", "--resume", "abc", "hi"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resume args mismatch\ngot : %v\nwant: %v", got, want)
+	}
+}
+
+func TestExtractGenericSessionAndReply(t *testing.T) {
+	t.Parallel()
+
+	jsonl := `{"type":"start","session":{"id":"s-77"}}
+{"type":"message","text":"partial"}
+{"type":"done","result":{"text":"final answer"}}
+`
+	cfg := bridgeConfig{AgentSessionJSONPath: "session.id", AgentReplyJSONPath: "result.text"}
+	if got := extractGenericSessionID(cfg, jsonl); got != "s-77" {
+		t.Fatalf("json path session = %q", got)
+	}
+	if got := extractGenericReply(cfg, jsonl); got != "final answer" {
+		t.Fatalf("json path reply = %q", got)
+	}
+
+	cfg = bridgeConfig{AgentSessionRegex: `session: ([0-9a-f-]+)`}
+	if got := extractGenericSessionID(cfg, "booting\nsession: 1f2e-3d\nhello"); got != "1f2e-3d" {
+		t.Fatalf("regex session = %q", got)
+	}
+	if got := extractGenericReply(cfg, "  plain output \n"); got != "plain output" {
+		t.Fatalf("plain reply = %q", got)
+	}
+
+	// Numeric IDs come back as printed, not as floats.
+	cfg = bridgeConfig{AgentSessionJSONPath: "session_id"}
+	if got := extractGenericSessionID(cfg, `{"session_id": 1234567}`); got != "1234567" {
+		t.Fatalf("numeric session = %q", got)
+	}
+	if got := extractGenericSessionID(cfg, "log line\n{\"session_id\": 9007199254740993}\n"); got != "9007199254740993" {
+		t.Fatalf("large numeric session = %q", got)
+	}
+
+	if got, ok := lookupJSONPath(map[string]any{"items": []any{"a", "b"}}, "items.-1"); !ok || got != "b" {
+		t.Fatalf("negative index lookup = %q %v", got, ok)
+	}
+}
+
+func TestRunAgentFallsBackToNextProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limit reached", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:       "openai",
+		AgentProviders:      []string{"openai", "generic"},
+		AgentFallback:       []string{"generic"},
+		AgentBin:            "/bin/sh",
+		AgentArgs:           `-c 'echo fallback ok' sh`,
+		AgentPromptMode:     promptModeStdin,
+		OpenAIBaseURL:       srv.URL + "/v1",
+		OpenAIHistoryTokens: 1000,
+		OpenAIHistoryDir:    filepath.Join(dir, "openai-history"),
+		SessionStoreFile:    filepath.Join(dir, "sessions.json"),
+		CodexWorkdir:        dir,
+		MemoryFile:          "MEMORY.md",
+		CodexSandbox:        "read-only",
+		TimeoutSec:          10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+
+	out, _, err := runAgent(context.Background(), cfg, 11, "hello", nil)
+	if err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+	if !strings.HasPrefix(out, "[answered by generic; openai failed (rate_limited)]") || !strings.HasSuffix(out, "fallback ok") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if sid := getChatSessionID("openai", 11); sid != "" {
+		t.Fatalf("failed provider must not get a session, got %q", sid)
+	}
+	if sid := getChatSessionID("generic", 11); sid == "" {
+		t.Fatal("answering provider should keep its own session")
+	}
+
+	// Errors that another provider would not fix are returned as is.
+	cfg.AgentArgs = `-c 'echo boom >&2; exit 3' sh`
+	cfg.AgentProvider, cfg.AgentFallback = "generic", []string{"openai"}
+	if _, _, err := runAgent(context.Background(), cfg, 12, "hello", nil); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected generic failure without fallback, got %v", err)
+	}
+}
+
+func TestRunAgentRetriesAndRenewsSession(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"third time lucky"}}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:       "openai",
+		AgentProviders:      []string{"openai"},
+		AgentMaxRetries:     2,
+		AgentRetryBackoffMs: 1,
+		OpenAIBaseURL:       srv.URL + "/v1",
+		OpenAIHistoryTokens: 1000,
+		OpenAIHistoryDir:    filepath.Join(dir, "openai-history"),
+		SessionStoreFile:    filepath.Join(dir, "sessions.json"),
+		CodexWorkdir:        dir,
+		MemoryFile:          "MEMORY.md",
+		CodexSandbox:        "read-only",
+		TimeoutSec:          10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+
+	out, _, err := runAgent(context.Background(), cfg, 21, "hello", nil)
+	if err != nil || out != "third time lucky" || calls != 3 {
+		t.Fatalf("retry result: out=%q err=%v calls=%d", out, err, calls)
+	}
+
+	// A resumed session the agent no longer knows is dropped and the request
+	// runs again in a fresh session.
+	cfg.AgentProvider, cfg.AgentProviders = "generic", []string{"generic"}
+	cfg.AgentBin = "/bin/sh"
+	cfg.AgentArgs = `-c 'echo "new-sid"; echo fresh answer' sh`
+	cfg.AgentResumeArgs = `-c 'echo "Error: session not found" >&2; exit 1' sh`
+	cfg.AgentSessionRegex = `new-sid`
+	cfg.AgentPromptMode = promptModeStdin
+	setChatSessionID(cfg, "generic", 21, "stale-sid")
+
+	out, _, err = runAgent(context.Background(), cfg, 21, "hello", nil)
+	if err != nil || !strings.HasSuffix(out, "fresh answer") {
+		t.Fatalf("fresh session result: out=%q err=%v", out, err)
+	}
+	if sid := getChatSessionID("generic", 21); sid != "new-sid" {
+		t.Fatalf("session after renewal = %q", sid)
+	}
+}
@@ -0,0 +1,341 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var auditMu sync.Mutex
+
+type auditRecord struct {
+	Seq       int64             `json:"seq"`
+	Timestamp string            `json:"timestamp"`
+	Actor     string            `json:"actor"`
+	Action    string            `json:"action"`
+	Args      map[string]string `json:"args,omitempty"`
+	Outcome   string            `json:"outcome"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+type auditVerifyReport struct {
+	Entries  int
+	LastSeq  int64
+	LastHash string
+	Problems []string
+}
+
+func (r auditVerifyReport) OK() bool { return len(r.Problems) == 0 }
+
+func defaultAuditLogPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("AUDIT_LOG_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "audit-log.jsonl")
+}
+
+func auditHeadPath(path string) string {
+	return path + ".head"
+}
+
+func auditActor(msg telegramMessage) string {
+	if msg.From == nil {
+		return "chat:" + strconv.FormatInt(msg.Chat.ID, 10)
+	}
+	return "user:" + strconv.FormatInt(msg.From.ID, 10)
+}
+
+func auditOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return "error: " + err.Error()
+}
+
+func appendAudit(cfg bridgeConfig, actor string, action string, args map[string]string, outcome string) {
+	if strings.TrimSpace(cfg.AuditLogFile) == "" {
+		return
+	}
+	if err := appendAuditRecord(cfg.AuditLogFile, actor, action, args, outcome); err != nil {
+		log.Printf("audit log append failed action=%s: %v", action, err)
+	}
+}
+
+func appendAuditRecord(path string, actor string, action string, args map[string]string, outcome string) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	prev, err := readLastAuditRecord(f)
+	if err != nil {
+		// A crash mid-append leaves a torn last line. Resume the chain
+		// after the last intact record and say so in the log itself,
+		// rather than failing every append from now on.
+		prev, err = reanchorAuditChain(f, path, err)
+		if err != nil {
+			return fmt.Errorf("failed to read chain tail: %w", err)
+		}
+	}
+
+	rec, err := writeAuditRecord(f, prev, actor, action, args, outcome)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	head := fmt.Sprintf("%d %s\n", rec.Seq, rec.Hash)
+	return os.WriteFile(auditHeadPath(path), []byte(head), 0o600)
+}
+
+func writeAuditRecord(f *os.File, prev *auditRecord, actor string, action string, args map[string]string, outcome string) (auditRecord, error) {
+	rec := auditRecord{
+		Seq:       1,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Actor:     actor,
+		Action:    action,
+		Args:      args,
+		Outcome:   outcome,
+	}
+	if prev != nil {
+		rec.Seq = prev.Seq + 1
+		rec.PrevHash = prev.Hash
+	}
+	var err error
+	rec.Hash, err = auditRecordHash(rec)
+	if err != nil {
+		return rec, err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return rec, err
+}
+
+// reanchorAuditChain recovers from an unreadable last line: it ends that
+// line, finds the last intact record and appends an audit_chain_break record
+// linked to it, with seq one past that record. Its args carry the anchor's
+// seq as resumed_after_seq and the seq from the head file as head_seq, so
+// verification still shows whether intact records went missing as well.
+func reanchorAuditChain(f *os.File, path string, cause error) (*auditRecord, error) {
+	anchor, err := lastIntactAuditRecord(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v; re-anchoring failed: %w", cause, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return nil, err
+		}
+		if last[0] != '\n' {
+			if _, err := f.Write([]byte("\n")); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	args := map[string]string{"reason": cause.Error(), "resumed_after_seq": "0"}
+	if anchor != nil {
+		args["resumed_after_seq"] = strconv.FormatInt(anchor.Seq, 10)
+	}
+	if raw, err := os.ReadFile(auditHeadPath(path)); err == nil {
+		if fields := strings.Fields(string(raw)); len(fields) == 2 {
+			args["head_seq"] = fields[0]
+		}
+	}
+	log.Printf("audit log %s: %v; resuming the chain after seq %s", path, cause, args["resumed_after_seq"])
+	brk, err := writeAuditRecord(f, anchor, "bridge", "audit_chain_break", args, "ok")
+	if err != nil {
+		return nil, err
+	}
+	return &brk, nil
+}
+
+// lastIntactAuditRecord scans the whole log for the last record that parses
+// and hashes correctly.
+func lastIntactAuditRecord(f *os.File) (*auditRecord, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var last *auditRecord
+	scanner := bufio.NewScanner(io.NewSectionReader(f, 0, info.Size()))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(bytes.TrimSpace(scanner.Bytes()), &rec); err != nil {
+			continue
+		}
+		if want, err := auditRecordHash(rec); err != nil || rec.Hash != want {
+			continue
+		}
+		last = &rec
+	}
+	return last, scanner.Err()
+}
+
+// auditRecordHash hashes the record with its own hash field cleared, so the
+// digest covers every other field including the link to the previous record.
+func auditRecordHash(rec auditRecord) (string, error) {
+	rec.Hash = ""
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func readLastAuditRecord(f *os.File) (*auditRecord, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+
+	chunk := int64(64 * 1024)
+	for {
+		if chunk > size {
+			chunk = size
+		}
+		buf := make([]byte, chunk)
+		if _, err := f.ReadAt(buf, size-chunk); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		idx := bytes.LastIndexByte(buf, '\n')
+		if idx < 0 && chunk < size {
+			chunk *= 2
+			continue
+		}
+		line := buf[idx+1:]
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil, nil
+		}
+		var rec auditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("last audit record is corrupt: %w", err)
+		}
+		return &rec, nil
+	}
+}
+
+func verifyAuditLog(path string) (auditVerifyReport, error) {
+	report := auditVerifyReport{}
+	f, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	problem := func(format string, args ...any) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			problem("line %d: empty line inside the chain", lineNo)
+			continue
+		}
+		var rec auditRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			problem("line %d: unparsable record: %v", lineNo, err)
+			continue
+		}
+		report.Entries++
+		if rec.Seq != report.LastSeq+1 {
+			problem("line %d: seq=%d, expected %d (entries deleted or reordered)", lineNo, rec.Seq, report.LastSeq+1)
+		}
+		if rec.PrevHash != report.LastHash {
+			problem("line %d: seq=%d prev_hash does not match previous record", lineNo, rec.Seq)
+		}
+		want, err := auditRecordHash(rec)
+		if err != nil {
+			return report, err
+		}
+		if rec.Hash != want {
+			problem("line %d: seq=%d hash mismatch (record edited)", lineNo, rec.Seq)
+		}
+		report.LastSeq = rec.Seq
+		report.LastHash = rec.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	raw, err := os.ReadFile(auditHeadPath(path))
+	switch {
+	case err == nil:
+		fields := strings.Fields(string(raw))
+		if len(fields) != 2 {
+			problem("head file is malformed")
+			break
+		}
+		headSeq, convErr := strconv.ParseInt(fields[0], 10, 64)
+		if convErr != nil {
+			problem("head file is malformed: %v", convErr)
+			break
+		}
+		if headSeq != report.LastSeq || fields[1] != report.LastHash {
+			problem("chain ends at seq=%d but head records seq=%d (trailing entries deleted or head edited)", report.LastSeq, headSeq)
+		}
+	case os.IsNotExist(err):
+		if report.Entries > 0 {
+			problem("head file %s is missing", auditHeadPath(path))
+		}
+	default:
+		return report, err
+	}
+	return report, nil
+}
+
+func auditArgsForAgentRun(cfg bridgeConfig, provider string, chatID int64, prompt string) map[string]string {
+	p := strings.TrimSpace(prompt)
+	if len([]rune(p)) > 200 {
+		p = string([]rune(p)[:200]) + "..."
+	}
+	return map[string]string{
+		"provider": provider,
+		"sandbox":  cfg.CodexSandbox,
+		"chat_id":  strconv.FormatInt(chatID, 10),
+		"prompt":   p,
+	}
+}
+
+// shouldAuditAgentRun reports whether an agent run may change local state.
+// Read-only runs are ordinary conversation and stay out of the audit log.
+func shouldAuditAgentRun(cfg bridgeConfig) bool {
+	return strings.TrimSpace(cfg.CodexSandbox) != "read-only"
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAuditFixture(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i, action := range []string{"memory_reset", "session_reset", "agent_run"} {
+		args := map[string]string{"n": strings.Repeat("x", i+1)}
+		if err := appendAuditRecord(path, "user:1", action, args, "ok"); err != nil {
+			t.Fatalf("appendAuditRecord failed: %v", err)
+		}
+	}
+	return path
+}
+
+func TestAuditLogVerifyIntact(t *testing.T) {
+	t.Parallel()
+	path := writeAuditFixture(t)
+
+	report, err := verifyAuditLog(path)
+	if err != nil {
+		t.Fatalf("verifyAuditLog error: %v", err)
+	}
+	if !report.OK() || report.Entries != 3 || report.LastSeq != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestAuditLogVerifyDetectsEdit(t *testing.T) {
+	t.Parallel()
+	path := writeAuditFixture(t)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(raw), `"action":"session_reset"`, `"action":"ping"`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := verifyAuditLog(path)
+	if err != nil {
+		t.Fatalf("verifyAuditLog error: %v", err)
+	}
+	if report.OK() || !strings.Contains(strings.Join(report.Problems, "\n"), "hash mismatch") {
+		t.Fatalf("expected hash mismatch, got %+v", report)
+	}
+}
+
+func TestAuditLogVerifyDetectsDeletion(t *testing.T) {
+	t.Parallel()
+
+	for _, drop := range []int{1, 2} {
+		path := writeAuditFixture(t)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+		lines = append(lines[:drop], lines[drop+1:]...)
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := verifyAuditLog(path)
+		if err != nil {
+			t.Fatalf("verifyAuditLog error: %v", err)
+		}
+		if report.OK() {
+			t.Fatalf("expected deletion of line %d to be detected", drop+1)
+		}
+	}
+}
+
+func TestAuditLogAppendContinuesChain(t *testing.T) {
+	t.Parallel()
+	path := writeAuditFixture(t)
+
+	if err := appendAuditRecord(path, "user:1", "screenshot", nil, "ok"); err != nil {
+		t.Fatalf("appendAuditRecord failed: %v", err)
+	}
+	report, err := verifyAuditLog(path)
+	if err != nil {
+		t.Fatalf("verifyAuditLog error: %v", err)
+	}
+	if !report.OK() || report.LastSeq != 4 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestAuditLogAppendRecoversFromTornLine(t *testing.T) {
+	t.Parallel()
+	path := writeAuditFixture(t)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"seq":4,"timestamp":"2026-`)
+	_ = f.Close()
+
+	for _, action := range []string{"screenshot", "memory_reset"} {
+		if err := appendAuditRecord(path, "user:1", action, nil, "ok"); err != nil {
+			t.Fatalf("appendAuditRecord after torn line: %v", err)
+		}
+	}
+	report, err := verifyAuditLog(path)
+	if err != nil {
+		t.Fatalf("verifyAuditLog error: %v", err)
+	}
+	// The torn line stays visible; the chain around it is intact.
+	if len(report.Problems) != 1 || !strings.Contains(report.Problems[0], "line 4: unparsable") || report.LastSeq != 6 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	raw, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimRight(string(raw), "\n"), "\n")
+	if len(lines) != 7 || !strings.Contains(lines[4], `"action":"audit_chain_break"`) || !strings.Contains(lines[4], `"resumed_after_seq":"3"`) {
+		t.Fatalf("log after recovery:\n%s", raw)
+	}
+}
@@ -0,0 +1,464 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bgStatusRunning     = "running"
+	bgStatusDone        = "done"
+	bgStatusFailed      = "failed"
+	bgStatusCancelled   = "cancelled"
+	bgStatusInterrupted = "interrupted"
+
+	// Finished jobs beyond this many are dropped from the store, oldest first.
+	maxBackgroundJobs = 50
+	// Output beyond this is cut from the front; the end of a long run is
+	// usually what matters.
+	maxBackgroundOutputChars = 256 * 1024
+	maxBackgroundJobList     = 15
+)
+
+// backgroundJob is a /bg run detached from the chat's queue.
+type backgroundJob struct {
+	ID       int    `json:"id"`
+	ChatID   int64  `json:"chat_id"`
+	Prompt   string `json:"prompt"`
+	Status   string `json:"status"`
+	Provider string `json:"provider,omitempty"`
+	// Times are RFC3339.
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (j backgroundJob) duration(now time.Time) time.Duration {
+	started, err := time.Parse(time.RFC3339, j.StartedAt)
+	if err != nil {
+		return 0
+	}
+	if finished, err := time.Parse(time.RFC3339, j.FinishedAt); err == nil {
+		return finished.Sub(started)
+	}
+	if j.Status != bgStatusRunning {
+		return 0
+	}
+	return now.Sub(started)
+}
+
+type backgroundJobStoreData struct {
+	NextID int             `json:"next_id"`
+	Jobs   []backgroundJob `json:"jobs"`
+}
+
+var (
+	bgJobMu sync.Mutex
+	bgJobs  = backgroundJobStoreData{NextID: 1}
+	// bgJobCancel holds the cancel functions of the jobs running in this
+	// process, by job ID.
+	bgJobCancel = map[int]context.CancelCauseFunc{}
+	bgJobWG     sync.WaitGroup
+)
+
+type runTimeoutKey struct{}
+
+// withRunTimeout makes agent runs under ctx use timeoutSec instead of the
+// chat's timeout.
+func withRunTimeout(ctx context.Context, timeoutSec int) context.Context {
+	return context.WithValue(ctx, runTimeoutKey{}, timeoutSec)
+}
+
+func runTimeoutOverride(ctx context.Context) int {
+	sec, _ := ctx.Value(runTimeoutKey{}).(int)
+	return sec
+}
+
+func defaultBackgroundJobPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("BG_JOB_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "jobs.json")
+}
+
+func loadBackgroundJobs(cfg bridgeConfig) error {
+	bgJobMu.Lock()
+	defer bgJobMu.Unlock()
+
+	bgJobs = backgroundJobStoreData{NextID: 1}
+	raw, err := readStoreFile(cfg, cfg.BgJobFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return nil
+	}
+	var parsed backgroundJobStoreData
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	for _, j := range parsed.Jobs {
+		if j.ID >= parsed.NextID {
+			parsed.NextID = j.ID + 1
+		}
+	}
+	if parsed.NextID < 1 {
+		parsed.NextID = 1
+	}
+	bgJobs = parsed
+	return nil
+}
+
+func saveBackgroundJobsLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(bgJobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, cfg.BgJobFile, data)
+}
+
+// pruneBackgroundJobsLocked drops the oldest finished jobs beyond
+// maxBackgroundJobs.
+func pruneBackgroundJobsLocked() {
+	excess := len(bgJobs.Jobs) - maxBackgroundJobs
+	if excess <= 0 {
+		return
+	}
+	kept := bgJobs.Jobs[:0]
+	for _, j := range bgJobs.Jobs {
+		if excess > 0 && j.Status != bgStatusRunning {
+			excess--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	bgJobs.Jobs = kept
+}
+
+// markInterruptedBackgroundJobs settles jobs that were still running when
+// the bridge last stopped without a clean shutdown, and tells their chats.
+func markInterruptedBackgroundJobs(cfg bridgeConfig) {
+	bgJobMu.Lock()
+	var interrupted []backgroundJob
+	now := time.Now().Format(time.RFC3339)
+	for i, j := range bgJobs.Jobs {
+		if j.Status == bgStatusRunning {
+			bgJobs.Jobs[i].Status = bgStatusInterrupted
+			bgJobs.Jobs[i].FinishedAt = now
+			bgJobs.Jobs[i].Error = "the bridge stopped while the job was running"
+			interrupted = append(interrupted, bgJobs.Jobs[i])
+		}
+	}
+	if len(interrupted) > 0 {
+		if err := saveBackgroundJobsLocked(cfg); err != nil {
+			log.Printf("[bg] failed to save jobs: %v", err)
+		}
+	}
+	bgJobMu.Unlock()
+
+	for _, j := range interrupted {
+		log.Printf("[bg] job %d chat_id=%d was interrupted by a restart", j.ID, j.ChatID)
+		_ = sendMessage(cfg, j.ChatID, fmt.Sprintf("[job #%d] was interrupted because the bridge restarted. resend it with /bg if needed.", j.ID))
+	}
+}
+
+type backgroundCommand struct {
+	Name string
+	Args string
+}
+
+func parseBackgroundCommand(text string) (backgroundCommand, bool) {
+	text = strings.TrimSpace(text)
+	name, args, _ := strings.Cut(text, " ")
+	switch name {
+	case "/bg", "/jobs", "/job":
+		return backgroundCommand{Name: strings.TrimPrefix(name, "/"), Args: strings.TrimSpace(args)}, true
+	}
+	return backgroundCommand{}, false
+}
+
+func handleBackgroundCommand(cfg bridgeConfig, msg telegramMessage, cmd backgroundCommand) {
+	var reply string
+	switch cmd.Name {
+	case "bg":
+		reply = startBackgroundJob(cfg, msg, cmd.Args)
+	case "jobs":
+		reply = formatBackgroundJobList(msg.Chat.ID, time.Now())
+	case "job":
+		id, action, _ := strings.Cut(cmd.Args, " ")
+		n, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+		switch {
+		case err != nil:
+			reply = "usage: /job <id> [cancel]. send /jobs for the ids."
+		case strings.TrimSpace(action) == "cancel":
+			reply = cancelBackgroundJob(cfg, msg, n)
+		default:
+			if sendBackgroundJobOutput(cfg, msg, n) {
+				return
+			}
+			reply = fmt.Sprintf("no job #%d in this chat.", n)
+		}
+	}
+	_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, cmd.Name)
+}
+
+func startBackgroundJob(cfg bridgeConfig, msg telegramMessage, prompt string) string {
+	if prompt == "" {
+		return "usage: /bg <prompt>. the job runs detached with a " + formatDelay(time.Duration(cfg.BgTimeoutSec)*time.Second) + " timeout; /jobs lists jobs."
+	}
+	now := time.Now()
+
+	bgJobMu.Lock()
+	if len(bgJobCancel) >= cfg.BgMaxRunning {
+		bgJobMu.Unlock()
+		return fmt.Sprintf("%d background jobs are already running (BG_MAX_RUNNING). wait for one to finish or cancel it with /job <id> cancel.", len(bgJobCancel))
+	}
+	job := backgroundJob{
+		ID:        bgJobs.NextID,
+		ChatID:    msg.Chat.ID,
+		Prompt:    prompt,
+		Status:    bgStatusRunning,
+		Provider:  chatProvider(cfg, msg.Chat.ID),
+		StartedAt: now.Format(time.RFC3339),
+	}
+	bgJobs.NextID++
+	bgJobs.Jobs = append(bgJobs.Jobs, job)
+	pruneBackgroundJobsLocked()
+	err := saveBackgroundJobsLocked(cfg)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	bgJobCancel[job.ID] = cancel
+	bgJobWG.Add(1)
+	bgJobMu.Unlock()
+
+	appendAudit(cfg, auditActor(msg), "bg_start", map[string]string{
+		"id":       strconv.Itoa(job.ID),
+		"chat_id":  strconv.FormatInt(msg.Chat.ID, 10),
+		"provider": job.Provider,
+	}, auditOutcome(err))
+	if err != nil {
+		log.Printf("[bg] failed to save jobs: %v", err)
+	}
+	go runBackgroundJob(ctx, cfg, job)
+	return fmt.Sprintf("started job #%d on %s (timeout %s). you will be notified when it finishes; /job %d shows its status.", job.ID, job.Provider, formatDelay(time.Duration(cfg.BgTimeoutSec)*time.Second), job.ID)
+}
+
+// runBackgroundJob runs the job in a fresh session of its own with the
+// background timeout, stores the result and notifies the chat.
+func runBackgroundJob(ctx context.Context, cfg bridgeConfig, job backgroundJob) {
+	defer bgJobWG.Done()
+	scope := "bg-" + strconv.Itoa(job.ID)
+	log.Printf("[bg] starting job %d chat_id=%d provider=%s", job.ID, job.ChatID, job.Provider)
+
+	runCtx := withRunTimeout(withSessionScope(ctx, scope), cfg.BgTimeoutSec)
+	out, _, err := runAgent(runCtx, cfg, job.ChatID, job.Prompt, nil)
+	clearSessionScope(cfg, scope)
+
+	finished := time.Now()
+	status := bgStatusDone
+	switch {
+	case isShutdownCancel(ctx):
+		status = bgStatusInterrupted
+	case isRunCancelled(ctx):
+		status = bgStatusCancelled
+	case err != nil:
+		status = bgStatusFailed
+	}
+
+	bgJobMu.Lock()
+	delete(bgJobCancel, job.ID)
+	for i := range bgJobs.Jobs {
+		if bgJobs.Jobs[i].ID != job.ID {
+			continue
+		}
+		bgJobs.Jobs[i].Status = status
+		bgJobs.Jobs[i].FinishedAt = finished.Format(time.RFC3339)
+		bgJobs.Jobs[i].Output = trimBackgroundOutput(out)
+		if err != nil {
+			bgJobs.Jobs[i].Error = err.Error()
+		}
+		job = bgJobs.Jobs[i]
+	}
+	if err := saveBackgroundJobsLocked(cfg); err != nil {
+		log.Printf("[bg] failed to save jobs: %v", err)
+	}
+	bgJobMu.Unlock()
+
+	elapsed := job.duration(finished).Truncate(time.Second)
+	log.Printf("[bg] job %d chat_id=%d %s after %s", job.ID, job.ChatID, status, elapsed)
+	label := "[job #" + strconv.Itoa(job.ID) + "]"
+	r := detachedRun{
+		ChatID: job.ChatID,
+		Label:  label,
+		Header: fmt.Sprintf("%s %s after %s: %s", label, status, elapsed, sessionTitle(job.Prompt)),
+		Prompt: job.Prompt,
+		Tag:    "bg",
+	}
+	resp, detailsID, _, tag := detachedReply(ctx, cfg, r, out, err)
+	if len(r.Header)+2+len(strings.TrimSpace(out)) > cfg.MaxReplyChars {
+		resp += fmt.Sprintf("\nsend /job %d for the full output.", job.ID)
+	}
+	sendAgentErrorReply(cfg, job.ChatID, resp, detailsID)
+	appendChatLogWithOptions(cfg, telegramMessage{Chat: telegramChat{ID: job.ChatID}}, resp, tag, chatLogOptions{UserText: label + " " + job.Prompt})
+}
+
+func trimBackgroundOutput(out string) string {
+	out = strings.TrimSpace(out)
+	if len(out) <= maxBackgroundOutputChars {
+		return out
+	}
+	cut := len(out) - maxBackgroundOutputChars
+	for cut < len(out) && out[cut]&0xC0 == 0x80 {
+		cut++
+	}
+	return "[earlier output truncated]\n" + out[cut:]
+}
+
+func cancelBackgroundJob(cfg bridgeConfig, msg telegramMessage, id int) string {
+	bgJobMu.Lock()
+	cancel, running := bgJobCancel[id]
+	owned := false
+	for _, j := range bgJobs.Jobs {
+		if j.ID == id && j.ChatID == msg.Chat.ID {
+			owned = true
+		}
+	}
+	bgJobMu.Unlock()
+	if !owned {
+		return fmt.Sprintf("no job #%d in this chat.", id)
+	}
+	if !running {
+		return fmt.Sprintf("job #%d is not running.", id)
+	}
+	cancel(errRunCancelled)
+	appendAudit(cfg, auditActor(msg), "bg_cancel", map[string]string{
+		"id":      strconv.Itoa(id),
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+	}, "ok")
+	return fmt.Sprintf("cancelling job #%d...", id)
+}
+
+func listChatBackgroundJobs(chatID int64) []backgroundJob {
+	bgJobMu.Lock()
+	defer bgJobMu.Unlock()
+	var out []backgroundJob
+	for _, j := range bgJobs.Jobs {
+		if j.ChatID == chatID {
+			out = append(out, j)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].ID > out[k].ID })
+	return out
+}
+
+func findBackgroundJob(chatID int64, id int) (backgroundJob, bool) {
+	bgJobMu.Lock()
+	defer bgJobMu.Unlock()
+	for _, j := range bgJobs.Jobs {
+		if j.ID == id && j.ChatID == chatID {
+			return j, true
+		}
+	}
+	return backgroundJob{}, false
+}
+
+func formatBackgroundJobList(chatID int64, now time.Time) string {
+	jobs := listChatBackgroundJobs(chatID)
+	if len(jobs) == 0 {
+		return "no background jobs. start one with /bg <prompt>"
+	}
+	var b strings.Builder
+	b.WriteString("background jobs:")
+	for i, j := range jobs {
+		if i == maxBackgroundJobList {
+			fmt.Fprintf(&b, "\n... and %d older", len(jobs)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n#%d  %s  %s  %s", j.ID, j.Status, j.duration(now).Truncate(time.Second), sessionTitle(j.Prompt))
+	}
+	b.WriteString("\n/job <id> shows the output")
+	return b.String()
+}
+
+// sendBackgroundJobOutput answers /job <id> with the job's status and output,
+// attached as a file when it does not fit in a message.
+func sendBackgroundJobOutput(cfg bridgeConfig, msg telegramMessage, id int) bool {
+	job, ok := findBackgroundJob(msg.Chat.ID, id)
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	head := fmt.Sprintf("job #%d %s (%s, %s)\nprompt: %s", job.ID, job.Status, job.Provider, job.duration(now).Truncate(time.Second), job.Prompt)
+	if job.Status == bgStatusRunning {
+		head += fmt.Sprintf("\nstill running. cancel with /job %d cancel", job.ID)
+	}
+	if job.Error != "" {
+		head += "\nerror: " + firstLine(job.Error)
+	}
+	body := head
+	if job.Output != "" {
+		body += "\n\noutput:\n" + job.Output
+	}
+	if len(body) <= cfg.MaxReplyChars {
+		_ = sendMessage(cfg, msg.Chat.ID, body)
+		appendChatLog(cfg, msg, body, "job")
+		return true
+	}
+
+	path := filepath.Join(cfg.TmpDir, fmt.Sprintf("job-%d-output.txt", job.ID))
+	if err := os.WriteFile(path, []byte(job.Output+"\n"), 0o600); err != nil {
+		log.Printf("[bg] failed to write output of job %d: %v", job.ID, err)
+		body = trimForTelegram(body, cfg.MaxReplyChars)
+		_ = sendMessage(cfg, msg.Chat.ID, body)
+		appendChatLog(cfg, msg, body, "job")
+		return true
+	}
+	defer os.Remove(path)
+	caption := trimForTelegram(head, 1000)
+	if err := sendDocument(cfg, msg.Chat.ID, path, caption); err != nil {
+		log.Printf("[bg] failed to send output of job %d: %v", job.ID, err)
+		body = trimForTelegram(body, cfg.MaxReplyChars)
+		_ = sendMessage(cfg, msg.Chat.ID, body)
+	}
+	appendChatLog(cfg, msg, head+"\n(output sent as a file)", "job")
+	return true
+}
+
+// shutdownBackgroundJobs waits up to timeout for running jobs, then cancels
+// them; they are reported as interrupted.
+func shutdownBackgroundJobs(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		bgJobWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	bgJobMu.Lock()
+	for id, cancel := range bgJobCancel {
+		log.Printf("shutdown: cancelling background job %d", id)
+		cancel(errBridgeShutdown)
+	}
+	bgJobMu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		log.Printf("shutdown: background jobs still running after cancellation; giving up")
+	}
+}
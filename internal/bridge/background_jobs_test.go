@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBackgroundCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want backgroundCommand
+		ok   bool
+	}{
+		{"/bg refactor the parser and run go test ./...", backgroundCommand{Name: "bg", Args: "refactor the parser and run go test ./..."}, true},
+		{"/jobs", backgroundCommand{Name: "jobs"}, true},
+		{"/job 3 cancel", backgroundCommand{Name: "job", Args: "3 cancel"}, true},
+		{"/jobsearch", backgroundCommand{}, false},
+	}
+	for _, tc := range cases {
+		got, ok := parseBackgroundCommand(tc.in)
+		if ok != tc.ok || got != tc.want {
+			t.Fatalf("parseBackgroundCommand(%q) = %+v, %v", tc.in, got, ok)
+		}
+	}
+}
+
+func TestBackgroundJobStorePrunesFinishedJobs(t *testing.T) {
+	cfg := bridgeConfig{BgJobFile: filepath.Join(t.TempDir(), "jobs.json")}
+	bgJobs = backgroundJobStoreData{NextID: 1}
+	bgJobMu.Lock()
+	for i := 1; i <= maxBackgroundJobs+5; i++ {
+		status := bgStatusDone
+		if i == 2 {
+			status = bgStatusRunning
+		}
+		bgJobs.Jobs = append(bgJobs.Jobs, backgroundJob{ID: i, ChatID: 71, Status: status, StartedAt: time.Now().Format(time.RFC3339)})
+	}
+	bgJobs.NextID = maxBackgroundJobs + 6
+	pruneBackgroundJobsLocked()
+	if err := saveBackgroundJobsLocked(cfg); err != nil {
+		t.Fatal(err)
+	}
+	bgJobMu.Unlock()
+
+	if err := loadBackgroundJobs(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(bgJobs.Jobs) != maxBackgroundJobs || bgJobs.NextID != maxBackgroundJobs+6 {
+		t.Fatalf("kept %d jobs, next id %d", len(bgJobs.Jobs), bgJobs.NextID)
+	}
+	if bgJobs.Jobs[0].ID != 2 || bgJobs.Jobs[1].ID != 7 {
+		t.Fatalf("pruned the wrong jobs: first ids %d, %d", bgJobs.Jobs[0].ID, bgJobs.Jobs[1].ID)
+	}
+	if list := formatBackgroundJobList(71, time.Now()); !strings.HasPrefix(list, "background jobs:\n#55  done") || !strings.Contains(list, "older") {
+		t.Fatalf("job list = %q", list)
+	}
+}
+
+func TestTrimBackgroundOutputKeepsTheEnd(t *testing.T) {
+	t.Parallel()
+
+	out := strings.Repeat("é", maxBackgroundOutputChars) + "PASS"
+	got := trimBackgroundOutput(out)
+	if !strings.HasPrefix(got, "[earlier output truncated]\n") || !strings.HasSuffix(got, "PASS") || !strings.HasPrefix(strings.TrimPrefix(got, "[earlier output truncated]\n"), "é") {
+		t.Fatalf("trimmed output starts %q", got[:40])
+	}
+}
+
+func TestRunTimeoutOverridesChatTimeout(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:     "generic",
+		AgentProviders:    []string{"generic"},
+		AgentBin:          "/bin/sh",
+		AgentArgs:         `-c 'sleep 1.5; cat' sh`,
+		AgentPromptMode:   promptModeStdin,
+		SessionStoreFile:  filepath.Join(dir, "sessions.json"),
+		CodexWorkdir:      dir,
+		MemoryFile:        "MEMORY.md",
+		TimeoutSec:        1,
+		AgentKillGraceSec: 1,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+
+	ctx := withRunTimeout(withSessionScope(context.Background(), "bg-"+strconv.Itoa(1)), 10)
+	out, _, err := runAgent(ctx, cfg, 72, "long job", nil)
+	if err != nil || !strings.HasSuffix(out, "long job") {
+		t.Fatalf("runAgent = %q, %v", out, err)
+	}
+}
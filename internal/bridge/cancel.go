@@ -0,0 +1,88 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+const cancelCallbackData = "cancel"
+
+func isCancelRequest(cfg bridgeConfig, msg telegramMessage) bool {
+	if msg.From == nil || msg.From.ID != cfg.AllowedUserID {
+		return false
+	}
+	return classifyTextCommand(normalizeMessageText(msg)) == commandCancel
+}
+
+func handleCancelCommand(cfg bridgeConfig, d *chatDispatcher, msg telegramMessage) {
+	reply := "nothing to cancel."
+	if d.Cancel(msg.Chat.ID) {
+		reply = "cancelling the running request..."
+	}
+	_ = sendMessage(cfg, msg.Chat.ID, reply)
+	appendChatLog(cfg, msg, reply, "cancel")
+}
+
+func handleCallbackQuery(cfg bridgeConfig, d *chatDispatcher, cq telegramCallbackQuery) {
+	if cq.From == nil || cq.From.ID != cfg.AllowedUserID || cq.Message == nil {
+		_ = answerCallbackQuery(cfg, cq.ID, "Not authorized.")
+		return
+	}
+	data := strings.TrimSpace(cq.Data)
+	if id, ok := strings.CutPrefix(data, errorDetailsCallbackPrefix); ok {
+		handleErrorDetailsCallback(cfg, cq, id)
+		return
+	}
+	if ref, ok := strings.CutPrefix(data, sessionResumeCallback); ok {
+		handleSessionResumeCallback(cfg, cq, ref)
+		return
+	}
+	switch data {
+	case cancelCallbackData:
+		text := "nothing to cancel."
+		if d.Cancel(cq.Message.Chat.ID) {
+			text = "cancelling..."
+		}
+		_ = answerCallbackQuery(cfg, cq.ID, text)
+	case sandboxConfirmCallbackData, sandboxAbortCallbackData:
+		handleSandboxConfirmCallback(cfg, cq, data == sandboxConfirmCallbackData)
+	default:
+		_ = answerCallbackQuery(cfg, cq.ID, "")
+	}
+}
+
+// startRunProgress posts a "working" notice with a cancel button and returns
+// a function that removes it once the run is over.
+func startRunProgress(cfg bridgeConfig, chatID int64) func() {
+	keyboard := telegramInlineKeyboard{InlineKeyboard: [][]telegramInlineButton{{
+		{Text: "Cancel", CallbackData: cancelCallbackData},
+	}}}
+	messageID, err := sendMessageWithKeyboard(cfg, chatID, "working... send /cancel or tap Cancel to abort.", keyboard)
+	if err != nil {
+		log.Printf("progress message failed chat_id=%d: %v", chatID, err)
+		return func() {}
+	}
+	return func() {
+		if err := deleteMessage(cfg, chatID, messageID); err != nil {
+			log.Printf("progress message cleanup failed chat_id=%d: %v", chatID, err)
+		}
+	}
+}
+
+// cancelledResponse builds the reply and chat log tag for a run whose context
+// was cancelled, telling user cancellation apart from bridge shutdown.
+func cancelledResponse(ctx context.Context, cfg bridgeConfig, partial string) (string, string) {
+	if isShutdownCancel(ctx) {
+		return interruptedReply(cfg, partial), "interrupted"
+	}
+	return cancelledReply(cfg, partial), "cancelled"
+}
+
+func cancelledReply(cfg bridgeConfig, partial string) string {
+	partial = strings.TrimSpace(partial)
+	if partial == "" {
+		return "cancelled."
+	}
+	return trimForTelegram("cancelled. partial output:\n"+partial, cfg.MaxReplyChars)
+}
@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	carrySummaryPrompt = "Summarize our conversation so far for a fresh session that will continue it: " +
+		"the goal, decisions made, the current state of the work, open questions and next steps. " +
+		"Be compact (at most 15 bullet points) and reply with the summary only."
+
+	// summarizerScope is the session slot SUMMARIZER_PROVIDER runs in, so it
+	// starts fresh and never resumes or binds the chat's own session.
+	summarizerScope = "summarizer"
+
+	maxCarryTranscriptChars = 12000
+)
+
+// parseNewSessionCommand recognizes /newsession and /reset with an optional
+// --carry or --fresh flag; without a flag NEWSESSION_CARRY decides.
+func parseNewSessionCommand(cfg bridgeConfig, text string) (carry bool, ok bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || (fields[0] != "/newsession" && fields[0] != "/reset") || len(fields) > 2 {
+		return false, false
+	}
+	if len(fields) == 1 {
+		return cfg.NewSessionCarry, true
+	}
+	switch fields[1] {
+	case "--carry":
+		return true, true
+	case "--fresh":
+		return false, true
+	}
+	return false, false
+}
+
+// handleCarryNewSession resets the chat's session but first asks for a
+// summary of it, which is injected into the first prompt of the next
+// session. It runs on the work lane since the summary is an agent run.
+func handleCarryNewSession(ctx context.Context, cfg bridgeConfig, msg telegramMessage) {
+	chatID := msg.Chat.ID
+	provider := chatProvider(cfg, chatID)
+	sid := getChatSessionID(provider, chatID)
+	if sid == "" {
+		handleExactCommand(cfg, msg, commandNewSession)
+		return
+	}
+
+	stopProgress := startRunProgress(cfg, chatID)
+	summary, err := summarizeOutgoingSession(ctx, cfg, chatID, provider, sid)
+	stopProgress()
+	if errors.Is(err, errRunCancelled) {
+		resp, tag := cancelledResponse(ctx, cfg, "")
+		resp += "\nthe session was kept."
+		_ = sendMessage(cfg, chatID, resp)
+		appendChatLog(cfg, msg, resp, tag)
+		return
+	}
+
+	var reply string
+	if err != nil || summary == "" {
+		if err == nil {
+			err = errors.New("empty summary")
+		}
+		log.Printf("[carry] summary failed provider=%s chat_id=%d session=%q: %v", provider, chatID, sid, err)
+		clearChatSessionID(cfg, provider, chatID)
+		reply = "session reset without a summary (" + firstLine(err.Error()) + "). next message will start a new " + provider + " session."
+	} else {
+		setCarrySummary(cfg, provider, chatID, summary)
+		reply = "session reset. this summary will be carried into the next " + provider + " session:\n\n" + summary
+	}
+	appendAudit(cfg, auditActor(msg), "session_reset", map[string]string{
+		"provider": provider,
+		"chat_id":  strconv.FormatInt(chatID, 10),
+		"carry":    strconv.FormatBool(err == nil),
+	}, "ok")
+	_ = sendMessage(cfg, chatID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "new_session_carry")
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// summarizeOutgoingSession asks the session itself for a summary, or, with
+// SUMMARIZER_PROVIDER set, hands that provider the session's transcript from
+// the chat log.
+func summarizeOutgoingSession(ctx context.Context, cfg bridgeConfig, chatID int64, provider string, sid string) (string, error) {
+	if cfg.SummarizerProvider == "" {
+		// The runner is called directly: runAgentOnce would roll an idle or
+		// long session over before the summary (the usual case here), and
+		// count the turn and list it in /sessions.
+		runCfg := chatConfigForProvider(cfg, chatID, provider)
+		log.Printf("[carry] summarizing provider=%s chat_id=%d session=%q", provider, chatID, sid)
+		res, err := runSummaryAgent(ctx, runCfg, chatID, carrySummaryPrompt)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(res.Output), nil
+	}
+
+	transcript, err := sessionTranscript(cfg, chatID, sid)
+	if err != nil {
+		return "", fmt.Errorf("failed to read chat log: %w", err)
+	}
+	if transcript == "" {
+		return "", errors.New("no conversation found in the chat log for this session")
+	}
+	sumCfg := configForProvider(cfg, cfg.SummarizerProvider)
+	sumCfg.CodexSandbox = "read-only"
+	prompt := carrySummaryPrompt + "\n\nConversation:\n" + transcript
+	log.Printf("[carry] summarizing provider=%s chat_id=%d session=%q transcript_chars=%d", sumCfg.AgentProvider, chatID, sid, len(transcript))
+	res, err := runSummaryAgent(withSessionScope(ctx, summarizerScope), sumCfg, chatID, prompt)
+	if sumCfg.AgentProvider == "openai" && res.SessionID != "" {
+		// The one-off session is never resumed; drop the history the bridge
+		// kept for it.
+		deleteOpenAIHistory(sumCfg, res.SessionID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Output), nil
+}
+
+// runSummaryAgent runs prompt outside the session bookkeeping of
+// runAgentOnce, but accounts for it like any other agent run: usage, budget
+// alert and audit record all go to chatID.
+func runSummaryAgent(ctx context.Context, cfg bridgeConfig, chatID int64, prompt string) (agentRunResult, error) {
+	runner := selectRunner(cfg)
+	started := time.Now()
+	res, err := runner.Run(ctx, cfg, chatID, prompt, nil)
+	if alert := recordAgentUsage(cfg, chatID, started, res.Usage, err); alert != "" {
+		log.Printf("[carry] budget alert chat_id=%d: %s", chatID, alert)
+		_ = sendMessage(cfg, chatID, alert)
+	}
+	if shouldAuditAgentRun(cfg) {
+		appendAudit(cfg, "user:"+strconv.FormatInt(cfg.AllowedUserID, 10), "agent_run", auditArgsForAgentRun(cfg, runner.Name(), chatID, prompt), auditOutcome(err))
+	}
+	return res, err
+}
+
+// sessionTranscript rebuilds the exchanges of one session from the chat log,
+// keeping the most recent ones when it gets long.
+func sessionTranscript(cfg bridgeConfig, chatID int64, sid string) (string, error) {
+	chatLogMu.Lock()
+	defer chatLogMu.Unlock()
+	f, err := os.Open(cfg.ChatLogFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var turns []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		plain, err := decodeChatLogLine(cfg, line)
+		if err != nil {
+			return "", err
+		}
+		var rec chatLogRecord
+		if err := json.Unmarshal(plain, &rec); err != nil || rec.ChatID != chatID || rec.SessionID != sid {
+			continue
+		}
+		switch rec.Tag {
+		case "agent_output", "media_output", "image_output":
+			turns = append(turns, "User: "+rec.UserText+"\nAssistant: "+rec.BotText)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	size := 0
+	start := len(turns)
+	for start > 0 && size+len(turns[start-1]) <= maxCarryTranscriptChars {
+		start--
+		size += len(turns[start]) + 2
+	}
+	return strings.Join(turns[start:], "\n\n"), nil
+}
+
+// setCarrySummary replaces the chat's session with an empty slot that only
+// holds the summary for the next session's first prompt.
+func setCarrySummary(cfg bridgeConfig, provider string, chatID int64, summary string) {
+	sessionMu.Lock()
+	key := sessionKey(provider, chatID)
+	normalized, _, _ := strings.Cut(key, ":")
+	chatSessions[key] = sessionRecord{Provider: normalized, ChatID: chatID, CarrySummary: summary}
+	err := saveSessionsLocked(cfg)
+	sessionMu.Unlock()
+	if err != nil {
+		log.Printf("failed to save session store: %v", err)
+	}
+}
+
+func withCarrySummary(prompt string, summary string) string {
+	if strings.TrimSpace(summary) == "" {
+		return prompt
+	}
+	return "Summary of the earlier conversation, carried over from the previous session:\n" +
+		strings.TrimSpace(summary) + "\n\nCurrent request:\n" + prompt
+}
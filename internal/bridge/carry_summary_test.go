@@ -0,0 +1,173 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNewSessionCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		text         string
+		defaultCarry bool
+		carry, ok    bool
+	}{
+		{"/newsession", false, false, true},
+		{"/newsession", true, true, true},
+		{"/reset --carry", false, true, true},
+		{"/newsession --fresh", true, false, true},
+		{"/newsession now", false, false, false},
+		{"/newsessions", false, false, false},
+	}
+	for _, tc := range cases {
+		carry, ok := parseNewSessionCommand(bridgeConfig{NewSessionCarry: tc.defaultCarry}, tc.text)
+		if carry != tc.carry || ok != tc.ok {
+			t.Fatalf("parseNewSessionCommand(%q, %v) = %v, %v", tc.text, tc.defaultCarry, carry, ok)
+		}
+	}
+}
+
+func TestCarrySummaryFromSummarizerReachesNextSession(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:      "generic",
+		AgentProviders:     []string{"generic"},
+		SummarizerProvider: "generic",
+		AgentBin:           "/bin/sh",
+		AgentArgs:          `-c 'cat' sh`,
+		AgentPromptMode:    promptModeStdin,
+		SessionStoreFile:   filepath.Join(dir, "sessions.json"),
+		ChatLogFile:        filepath.Join(dir, "chat.jsonl"),
+		CodexWorkdir:       dir,
+		MemoryFile:         "MEMORY.md",
+		CodexSandbox:       "read-only",
+		TimeoutSec:         10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+
+	var log strings.Builder
+	for _, rec := range []chatLogRecord{
+		{Tag: "agent_output", ChatID: 41, SessionID: "old", UserText: "add retries", BotText: "added backoff"},
+		{Tag: "ping", ChatID: 41, SessionID: "old", UserText: "/ping", BotText: "pong"},
+		{Tag: "agent_output", ChatID: 42, SessionID: "old", UserText: "other chat", BotText: "x"},
+	} {
+		b, _ := json.Marshal(rec)
+		log.Write(append(b, '\n'))
+	}
+	if err := os.WriteFile(cfg.ChatLogFile, []byte(log.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := summarizeOutgoingSession(context.Background(), cfg, 41, "generic", "old")
+	if err != nil {
+		t.Fatalf("summarizeOutgoingSession: %v", err)
+	}
+	if !strings.Contains(summary, "User: add retries\nAssistant: added backoff") || strings.Contains(summary, "pong") || strings.Contains(summary, "other chat") {
+		t.Fatalf("summarizer prompt = %q", summary)
+	}
+	if sid := getRunSessionID(withSessionScope(context.Background(), summarizerScope), "generic", 41); sid != "" {
+		t.Fatalf("summarizer bound a session: %q", sid)
+	}
+
+	setCarrySummary(cfg, "generic", 41, "- retries use backoff")
+	if sid := getChatSessionID("generic", 41); sid != "" {
+		t.Fatalf("carry slot has a session: %q", sid)
+	}
+	out, _, err := runAgent(context.Background(), cfg, 41, "continue", nil)
+	if err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+	if !strings.Contains(out, "carried over from the previous session:\n- retries use backoff") || !strings.HasSuffix(out, "continue") {
+		t.Fatalf("first prompt of new session = %q", out)
+	}
+	if rec, _ := getChatSession("generic", 41); rec.CarrySummary != "" || rec.SessionID == "" {
+		t.Fatalf("carry summary not consumed: %+v", rec)
+	}
+}
+
+func TestOpenAISummarizerAccountsUsageAndDropsHistory(t *testing.T) {
+	srv, _ := newMockChatServer(t)
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:       "codex",
+		AgentProviders:      []string{"codex", "openai"},
+		SummarizerProvider:  "openai",
+		OpenAIBaseURL:       srv.URL + "/v1",
+		OpenAIAPIKey:        "test-key",
+		OpenAIModel:         "local-model",
+		OpenAIHistoryTokens: 8000,
+		OpenAIHistoryDir:    filepath.Join(dir, "openai-history"),
+		SessionStoreFile:    filepath.Join(dir, "sessions.json"),
+		ChatLogFile:         filepath.Join(dir, "chat.jsonl"),
+		UsageLogFile:        filepath.Join(dir, "usage.jsonl"),
+		CodexWorkdir:        dir,
+		TimeoutSec:          10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	b, _ := json.Marshal(chatLogRecord{Tag: "agent_output", ChatID: 44, SessionID: "old", UserText: "ship it", BotText: "shipped"})
+	if err := os.WriteFile(cfg.ChatLogFile, append(b, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := summarizeOutgoingSession(context.Background(), cfg, 44, "codex", "old")
+	if err != nil || !strings.Contains(summary, "User: ship it") {
+		t.Fatalf("summarizeOutgoingSession = %q, %v", summary, err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(cfg.OpenAIHistoryDir, "*.json")); len(left) != 0 {
+		t.Fatalf("summarizer history left behind: %v", left)
+	}
+	raw, err := os.ReadFile(cfg.UsageLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec usageRecord
+	if err := json.Unmarshal(raw, &rec); err != nil || rec.ChatID != 44 || rec.Provider != "openai" || rec.InputTokens != 12 {
+		t.Fatalf("usage record = %+v, %v", rec, err)
+	}
+}
+
+func TestCarrySummaryResumesExpiredSession(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:      "generic",
+		AgentProviders:     []string{"generic"},
+		AgentBin:           "/bin/sh",
+		AgentArgs:          `-c 'echo fresh session' sh`,
+		AgentResumeArgs:    `-c 'echo "summary of $0"' "{{session_id}}"`,
+		AgentPromptMode:    promptModeStdin,
+		SessionIdleTTLSec:  60,
+		SessionMaxTurns:    5,
+		SessionStoreFile:   filepath.Join(dir, "sessions.json"),
+		SessionHistoryFile: filepath.Join(dir, "session-history.json"),
+		CodexWorkdir:       dir,
+		MemoryFile:         "MEMORY.md",
+		CodexSandbox:       "read-only",
+		TimeoutSec:         10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	sessionHistory = map[string][]sessionHistoryEntry{}
+	stale := sessionRecord{SessionID: "old-sid", Provider: "generic", ChatID: 43, Turns: 9, UpdatedAt: "2020-01-01T00:00:00Z"}
+	chatSessions[sessionKey("generic", 43)] = stale
+
+	summary, err := summarizeOutgoingSession(context.Background(), cfg, 43, "generic", "old-sid")
+	if err != nil {
+		t.Fatalf("summarizeOutgoingSession: %v", err)
+	}
+	if summary != "summary of old-sid" {
+		t.Fatalf("summary = %q, want it from the outgoing session", summary)
+	}
+	if rec, _ := getChatSession("generic", 43); rec != stale {
+		t.Fatalf("summary turn touched the session: %+v", rec)
+	}
+	if got := listChatSessions(43); len(got) != 0 {
+		t.Fatalf("summary turn listed in /sessions: %+v", got)
+	}
+}
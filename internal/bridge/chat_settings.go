@@ -0,0 +1,121 @@
+package bridge
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// chatSettings holds per-chat choices made through bot commands. They live in
+// their own store next to the session store so they survive session resets.
+type chatSettings struct {
+	Provider string `json:"provider,omitempty"`
+	// Models maps a provider name to the model chosen for it in this chat.
+	Models     map[string]string `json:"models,omitempty"`
+	Sandbox    string            `json:"sandbox,omitempty"`
+	TimeoutSec int               `json:"timeout_sec,omitempty"`
+}
+
+func (s chatSettings) isEmpty() bool {
+	return s.Provider == "" && len(s.Models) == 0 && s.Sandbox == "" && s.TimeoutSec == 0
+}
+
+var (
+	settingsMu        sync.RWMutex
+	chatSettingsStore = map[string]chatSettings{}
+)
+
+func loadChatSettings(cfg bridgeConfig) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	raw, err := readStoreFile(cfg, cfg.ChatSettingsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			chatSettingsStore = map[string]chatSettings{}
+			return nil
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		chatSettingsStore = map[string]chatSettings{}
+		return nil
+	}
+	var parsed map[string]chatSettings
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	if parsed == nil {
+		parsed = map[string]chatSettings{}
+	}
+	chatSettingsStore = parsed
+	return nil
+}
+
+func saveChatSettingsLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(chatSettingsStore, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, cfg.ChatSettingsFile, data)
+}
+
+func getChatSettings(chatID int64) chatSettings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return chatSettingsStore[strconv.FormatInt(chatID, 10)]
+}
+
+func updateChatSettings(cfg bridgeConfig, chatID int64, update func(*chatSettings)) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	key := strconv.FormatInt(chatID, 10)
+	s := chatSettingsStore[key]
+	if s.Models != nil {
+		models := make(map[string]string, len(s.Models))
+		for k, v := range s.Models {
+			models[k] = v
+		}
+		s.Models = models
+	}
+	update(&s)
+	if s.isEmpty() {
+		delete(chatSettingsStore, key)
+	} else {
+		chatSettingsStore[key] = s
+	}
+	if err := saveChatSettingsLocked(cfg); err != nil {
+		log.Printf("failed to save chat settings: %v", err)
+		return err
+	}
+	return nil
+}
+
+// chatConfig returns cfg with the per-chat choices of chatID applied. Every
+// agent run goes through it so runners only ever look at their cfg.
+func chatConfig(cfg bridgeConfig, chatID int64) bridgeConfig {
+	return chatConfigForProvider(cfg, chatID, chatProvider(cfg, chatID))
+}
+
+// chatConfigForProvider is chatConfig for an explicit provider, used for
+// fallback attempts. Models are chosen per provider, so a model picked for
+// one provider never leaks into another.
+func chatConfigForProvider(cfg bridgeConfig, chatID int64, provider string) bridgeConfig {
+	cfg = configForProvider(cfg, provider)
+	settings := getChatSettings(chatID)
+	if m := settings.Models[cfg.AgentProvider]; m != "" && isAllowedModel(cfg, m) {
+		cfg.AgentModel = m
+		cfg.CodexModel = m
+		cfg.OpenAIModel = m
+	}
+	if settings.Sandbox != "" && isAllowedSandbox(cfg, settings.Sandbox) {
+		cfg.CodexSandbox = settings.Sandbox
+	}
+	if settings.TimeoutSec > 0 && settings.TimeoutSec <= cfg.ChatMaxTimeoutSec {
+		cfg.TimeoutSec = settings.TimeoutSec
+	}
+	return cfg
+}
@@ -0,0 +1,230 @@
+package bridge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sandboxDangerFullAccess = "danger-full-access"
+
+	sandboxConfirmCallbackData = "sandbox-confirm"
+	sandboxAbortCallbackData   = "sandbox-abort"
+	sandboxConfirmWindow       = 2 * time.Minute
+	minChatTimeoutSec          = 10
+)
+
+// Pending danger-full-access switches waiting for the confirm button, by chat.
+var (
+	sandboxConfirmMu      sync.Mutex
+	pendingSandboxConfirm = map[int64]time.Time{}
+)
+
+type settingCommand struct {
+	Name  string
+	Value string
+}
+
+func parseSettingCommand(text string) (settingCommand, bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 {
+		return settingCommand{}, false
+	}
+	switch fields[0] {
+	case "/model", "/sandbox", "/timeout":
+	default:
+		return settingCommand{}, false
+	}
+	cmd := settingCommand{Name: strings.TrimPrefix(fields[0], "/")}
+	if len(fields) > 1 {
+		cmd.Value = fields[1]
+	}
+	return cmd, true
+}
+
+// splitSettingList splits a comma separated admin list, keeping case since
+// model names are passed to the agent verbatim.
+func splitSettingList(raw string) []string {
+	var out []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func isAllowedModel(cfg bridgeConfig, model string) bool {
+	for _, m := range cfg.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedSandbox(cfg bridgeConfig, sandbox string) bool {
+	for _, s := range cfg.AllowedSandboxes {
+		if s == sandbox {
+			return true
+		}
+	}
+	return false
+}
+
+func handleSettingCommand(cfg bridgeConfig, msg telegramMessage, cmd settingCommand) {
+	chatID := msg.Chat.ID
+	var reply string
+	switch cmd.Name {
+	case "model":
+		reply = handleModelSetting(cfg, msg, cmd.Value)
+	case "sandbox":
+		if cmd.Value == sandboxDangerFullAccess && isAllowedSandbox(cfg, cmd.Value) {
+			requestSandboxConfirmation(cfg, msg)
+			return
+		}
+		reply = handleSandboxSetting(cfg, msg, cmd.Value)
+	case "timeout":
+		reply = handleTimeoutSetting(cfg, msg, cmd.Value)
+	}
+	_ = sendMessage(cfg, chatID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "setting_"+cmd.Name)
+}
+
+func saveChatSetting(cfg bridgeConfig, msg telegramMessage, name string, value string, update func(*chatSettings)) error {
+	err := updateChatSettings(cfg, msg.Chat.ID, update)
+	appendAudit(cfg, auditActor(msg), "chat_setting", map[string]string{
+		"setting": name,
+		"value":   value,
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+	}, auditOutcome(err))
+	return err
+}
+
+func handleModelSetting(cfg bridgeConfig, msg telegramMessage, value string) string {
+	effective := chatConfig(cfg, msg.Chat.ID)
+	provider := effective.AgentProvider
+	current := effective.AgentModel
+	if provider == "codex" {
+		current = effective.CodexModel
+	}
+	if current == "" {
+		current = "(provider default)"
+	}
+	if value == "" {
+		allowed := "none configured (ALLOWED_MODELS)"
+		if len(cfg.AllowedModels) > 0 {
+			allowed = strings.Join(cfg.AllowedModels, ", ")
+		}
+		return fmt.Sprintf("model for %s: %s\nallowed: %s\nchange with /model <name>, reset with /model default", provider, current, allowed)
+	}
+	if value == "default" {
+		if err := saveChatSetting(cfg, msg, "model", provider+"=default", func(s *chatSettings) { delete(s.Models, provider) }); err != nil {
+			return "failed to save setting: " + err.Error()
+		}
+		return "model for " + provider + " reset to the default."
+	}
+	if !isAllowedModel(cfg, value) {
+		if len(cfg.AllowedModels) == 0 {
+			return "model switching is disabled: ALLOWED_MODELS is empty."
+		}
+		return "model " + strconv.Quote(value) + " is not allowed. allowed: " + strings.Join(cfg.AllowedModels, ", ")
+	}
+	err := saveChatSetting(cfg, msg, "model", provider+"="+value, func(s *chatSettings) {
+		if s.Models == nil {
+			s.Models = map[string]string{}
+		}
+		s.Models[provider] = value
+	})
+	if err != nil {
+		return "failed to save setting: " + err.Error()
+	}
+	return "model for " + provider + " set to " + value + "."
+}
+
+func handleSandboxSetting(cfg bridgeConfig, msg telegramMessage, value string) string {
+	current := chatConfig(cfg, msg.Chat.ID).CodexSandbox
+	switch {
+	case value == "":
+		return fmt.Sprintf("sandbox: %s\nallowed: %s\nchange with /sandbox <mode>, reset with /sandbox default", current, strings.Join(cfg.AllowedSandboxes, ", "))
+	case value == "default":
+		if err := saveChatSetting(cfg, msg, "sandbox", "default", func(s *chatSettings) { s.Sandbox = "" }); err != nil {
+			return "failed to save setting: " + err.Error()
+		}
+		return "sandbox reset to the default (" + cfg.CodexSandbox + ")."
+	case !isAllowedSandbox(cfg, value):
+		return "sandbox " + strconv.Quote(value) + " is not allowed. allowed: " + strings.Join(cfg.AllowedSandboxes, ", ")
+	}
+	if err := saveChatSetting(cfg, msg, "sandbox", value, func(s *chatSettings) { s.Sandbox = value }); err != nil {
+		return "failed to save setting: " + err.Error()
+	}
+	return "sandbox set to " + value + "."
+}
+
+func handleTimeoutSetting(cfg bridgeConfig, msg telegramMessage, value string) string {
+	current := chatConfig(cfg, msg.Chat.ID).TimeoutSec
+	if value == "" {
+		return fmt.Sprintf("timeout: %d s (allowed %d-%d s)\nchange with /timeout <seconds>, reset with /timeout default", current, minChatTimeoutSec, cfg.ChatMaxTimeoutSec)
+	}
+	if value == "default" {
+		if err := saveChatSetting(cfg, msg, "timeout", "default", func(s *chatSettings) { s.TimeoutSec = 0 }); err != nil {
+			return "failed to save setting: " + err.Error()
+		}
+		return fmt.Sprintf("timeout reset to the default (%d s).", cfg.TimeoutSec)
+	}
+	sec, err := strconv.Atoi(strings.TrimSuffix(value, "s"))
+	if err != nil || sec < minChatTimeoutSec || sec > cfg.ChatMaxTimeoutSec {
+		return fmt.Sprintf("timeout must be a number of seconds between %d and %d.", minChatTimeoutSec, cfg.ChatMaxTimeoutSec)
+	}
+	if err := saveChatSetting(cfg, msg, "timeout", strconv.Itoa(sec), func(s *chatSettings) { s.TimeoutSec = sec }); err != nil {
+		return "failed to save setting: " + err.Error()
+	}
+	return fmt.Sprintf("timeout set to %d s.", sec)
+}
+
+// requestSandboxConfirmation asks for an explicit tap before a chat may run
+// agents without any sandbox.
+func requestSandboxConfirmation(cfg bridgeConfig, msg telegramMessage) {
+	sandboxConfirmMu.Lock()
+	pendingSandboxConfirm[msg.Chat.ID] = time.Now().Add(sandboxConfirmWindow)
+	sandboxConfirmMu.Unlock()
+
+	reply := "danger-full-access lets the agent run any command without a sandbox. confirm within 2 minutes to switch this chat."
+	keyboard := telegramInlineKeyboard{InlineKeyboard: [][]telegramInlineButton{{
+		{Text: "Confirm danger-full-access", CallbackData: sandboxConfirmCallbackData},
+		{Text: "Keep current", CallbackData: sandboxAbortCallbackData},
+	}}}
+	if _, err := sendMessageWithKeyboard(cfg, msg.Chat.ID, reply, keyboard); err != nil {
+		_ = sendMessage(cfg, msg.Chat.ID, "failed to ask for confirmation: "+err.Error())
+	}
+	appendChatLog(cfg, msg, reply, "setting_sandbox_confirm")
+}
+
+func takeSandboxConfirmation(chatID int64, now time.Time) bool {
+	sandboxConfirmMu.Lock()
+	defer sandboxConfirmMu.Unlock()
+	deadline, ok := pendingSandboxConfirm[chatID]
+	delete(pendingSandboxConfirm, chatID)
+	return ok && now.Before(deadline)
+}
+
+func handleSandboxConfirmCallback(cfg bridgeConfig, cq telegramCallbackQuery, confirmed bool) {
+	chatID := cq.Message.Chat.ID
+	pending := takeSandboxConfirmation(chatID, time.Now())
+	if !confirmed {
+		_ = answerCallbackQuery(cfg, cq.ID, "sandbox unchanged.")
+		return
+	}
+	if !pending {
+		_ = answerCallbackQuery(cfg, cq.ID, "confirmation expired. send /sandbox danger-full-access again.")
+		return
+	}
+	msg := telegramMessage{From: cq.From, Chat: cq.Message.Chat}
+	reply := handleSandboxSetting(cfg, msg, sandboxDangerFullAccess)
+	_ = answerCallbackQuery(cfg, cq.ID, "")
+	_ = sendMessage(cfg, chatID, reply)
+	appendChatLog(cfg, msg, reply, "setting_sandbox")
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSettingCommand(t *testing.T) {
+	t.Parallel()
+
+	cmd, ok := parseSettingCommand("/model gpt-5-mini")
+	if !ok || cmd.Name != "model" || cmd.Value != "gpt-5-mini" {
+		t.Fatalf("model parse = %+v ok=%v", cmd, ok)
+	}
+	if cmd, ok := parseSettingCommand("/timeout"); !ok || cmd.Name != "timeout" || cmd.Value != "" {
+		t.Fatalf("timeout parse = %+v ok=%v", cmd, ok)
+	}
+	if _, ok := parseSettingCommand("/models"); ok {
+		t.Fatal("/models must not parse as /model")
+	}
+}
+
+func TestChatSettingOverrides(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:     "codex",
+		AgentProviders:    []string{"codex", "claude"},
+		CodexModel:        "base",
+		CodexSandbox:      "workspace-write",
+		TimeoutSec:        300,
+		AllowedModels:     []string{"fast", "smart"},
+		AllowedSandboxes:  []string{"read-only", "workspace-write"},
+		ChatMaxTimeoutSec: 900,
+		ChatSettingsFile:  filepath.Join(dir, "chat-settings.json"),
+	}
+	chatSettingsStore = map[string]chatSettings{}
+	msg := telegramMessage{Chat: telegramChat{ID: 9}}
+
+	if reply := handleModelSetting(cfg, msg, "huge"); !strings.Contains(reply, "not allowed") {
+		t.Fatalf("disallowed model reply = %q", reply)
+	}
+	if reply := handleSandboxSetting(cfg, msg, "danger-full-access"); !strings.Contains(reply, "not allowed") {
+		t.Fatalf("disallowed sandbox reply = %q", reply)
+	}
+	if reply := handleTimeoutSetting(cfg, msg, "5000"); !strings.Contains(reply, "between") {
+		t.Fatalf("out of range timeout reply = %q", reply)
+	}
+	handleModelSetting(cfg, msg, "fast")
+	handleSandboxSetting(cfg, msg, "read-only")
+	handleTimeoutSetting(cfg, msg, "600")
+
+	chatSettingsStore = map[string]chatSettings{}
+	if err := loadChatSettings(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got := chatConfig(cfg, 9)
+	if got.CodexModel != "fast" || got.CodexSandbox != "read-only" || got.TimeoutSec != 600 {
+		t.Fatalf("chatConfig = model %q sandbox %q timeout %d", got.CodexModel, got.CodexSandbox, got.TimeoutSec)
+	}
+	// The model belongs to codex and must not follow a fallback to claude.
+	if m := chatConfigForProvider(cfg, 9, "claude").AgentModel; m != "" {
+		t.Fatalf("claude model = %q", m)
+	}
+	// Overrides the admin later disallows are ignored.
+	cfg.AllowedModels = []string{"smart"}
+	if m := chatConfig(cfg, 9).CodexModel; m != "base" {
+		t.Fatalf("disallowed stored model applied: %q", m)
+	}
+
+	handleModelSetting(cfg, msg, "default")
+	handleSandboxSetting(cfg, msg, "default")
+	handleTimeoutSetting(cfg, msg, "default")
+	if s := getChatSettings(9); !s.isEmpty() {
+		t.Fatalf("settings after reset = %+v", s)
+	}
+}
+
+func TestSandboxConfirmationExpires(t *testing.T) {
+	now := time.Now()
+	sandboxConfirmMu.Lock()
+	pendingSandboxConfirm[1] = now.Add(sandboxConfirmWindow)
+	pendingSandboxConfirm[2] = now.Add(-time.Second)
+	sandboxConfirmMu.Unlock()
+
+	if !takeSandboxConfirmation(1, now) {
+		t.Fatal("pending confirmation rejected")
+	}
+	if takeSandboxConfirmation(1, now) {
+		t.Fatal("confirmation accepted twice")
+	}
+	if takeSandboxConfirmation(2, now) {
+		t.Fatal("expired confirmation accepted")
+	}
+}
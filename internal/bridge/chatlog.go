@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +17,8 @@ func trimForTelegram(s string, maxChars int) string {
 	return s[:maxChars] + "\n...[truncated]"
 }
 
+var chatLogMu sync.Mutex
+
 type chatLogRecord struct {
 	Timestamp    string `json:"timestamp"`
 	Tag          string `json:"tag"`
@@ -58,7 +61,7 @@ func appendChatLogWithOptions(cfg bridgeConfig, msg telegramMessage, botText str
 	rec := chatLogRecord{
 		Timestamp:    time.Now().Format(time.RFC3339),
 		Tag:          tag,
-		SessionID:    getChatSessionID(cfg.AgentProvider, msg.Chat.ID),
+		SessionID:    getChatSessionID(chatProvider(cfg, msg.Chat.ID), msg.Chat.ID),
 		UserID:       userID,
 		ChatID:       msg.Chat.ID,
 		MessageID:    msg.MessageID,
@@ -74,8 +77,15 @@ func appendChatLogWithOptions(cfg bridgeConfig, msg telegramMessage, botText str
 		log.Printf("chat log marshal failed: %v", err)
 		return
 	}
+	b, err = encodeChatLogLine(cfg, b)
+	if err != nil {
+		log.Printf("chat log encrypt failed: %v", err)
+		return
+	}
 
-	f, err := os.OpenFile(cfg.ChatLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	chatLogMu.Lock()
+	defer chatLogMu.Unlock()
+	f, err := os.OpenFile(cfg.ChatLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, storeFileMode(cfg))
 	if err != nil {
 		log.Printf("chat log open failed: %v", err)
 		return
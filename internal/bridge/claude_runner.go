@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// claudeRunner drives the Claude Code CLI in print mode. Output is read as
+// stream-json so the session ID is known from the first event and partial
+// text survives a cancelled run.
+type claudeRunner struct{}
+
+func (c claudeRunner) Name() string         { return "claude" }
+func (c claudeRunner) SupportsImages() bool { return true }
+
+type claudeStreamEvent struct {
+	Type         string          `json:"type"`
+	Subtype      string          `json:"subtype"`
+	SessionID    string          `json:"session_id"`
+	IsError      bool            `json:"is_error"`
+	Result       string          `json:"result"`
+	TotalCostUSD float64         `json:"total_cost_usd"`
+	NumTurns     int             `json:"num_turns"`
+	Usage        *claudeUsage    `json:"usage"`
+	Message      *claudeMessage  `json:"message"`
+	Errors       json.RawMessage `json:"errors"`
+}
+
+type claudeMessage struct {
+	Role    string               `json:"role"`
+	Content []claudeContentBlock `json:"content"`
+}
+
+type claudeContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type claudeUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+}
+
+type claudeRunSummary struct {
+	Events    int
+	SessionID string
+	Messages  []string
+	Result    *claudeStreamEvent
+}
+
+// parseClaudeOutput accepts both `--output-format stream-json` (one event per
+// line) and `--output-format json` (a single result object).
+func parseClaudeOutput(output string) claudeRunSummary {
+	summary := claudeRunSummary{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var ev claudeStreamEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil || ev.Type == "" {
+			continue
+		}
+		summary.Events++
+		if strings.TrimSpace(ev.SessionID) != "" {
+			summary.SessionID = strings.TrimSpace(ev.SessionID)
+		}
+		switch ev.Type {
+		case "assistant":
+			if ev.Message == nil {
+				continue
+			}
+			var parts []string
+			for _, block := range ev.Message.Content {
+				if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+					parts = append(parts, block.Text)
+				}
+			}
+			if len(parts) > 0 {
+				summary.Messages = append(summary.Messages, strings.Join(parts, "\n"))
+			}
+		case "result":
+			result := ev
+			summary.Result = &result
+		}
+	}
+	return summary
+}
+
+func (s claudeRunSummary) Reply() string {
+	if s.Result != nil && strings.TrimSpace(s.Result.Result) != "" {
+		return strings.TrimSpace(s.Result.Result)
+	}
+	if len(s.Messages) > 0 {
+		return strings.TrimSpace(s.Messages[len(s.Messages)-1])
+	}
+	return ""
+}
+
+func (s claudeRunSummary) PartialReply() string {
+	return strings.TrimSpace(strings.Join(s.Messages, "\n\n"))
+}
+
+func (s claudeRunSummary) Usage() agentUsage {
+	if s.Result == nil {
+		return agentUsage{}
+	}
+	u := agentUsage{CostUSD: s.Result.TotalCostUSD}
+	if s.Result.Usage != nil {
+		u.InputTokens = s.Result.Usage.InputTokens + s.Result.Usage.CacheCreationInputTokens
+		u.CachedInputTokens = s.Result.Usage.CacheReadInputTokens
+		u.OutputTokens = s.Result.Usage.OutputTokens
+	}
+	return u
+}
+
+// claudePermissionArgs maps the Codex sandbox names used across the bridge to
+// Claude permission flags.
+func claudePermissionArgs(sandbox string) []string {
+	switch strings.TrimSpace(sandbox) {
+	case "read-only":
+		return []string{"--permission-mode", "plan"}
+	case "danger-full-access":
+		return []string{"--dangerously-skip-permissions"}
+	default:
+		return []string{"--permission-mode", "acceptEdits"}
+	}
+}
+
+func buildClaudeArgs(cfg bridgeConfig, prompt string, sessionID string, imagePaths []string) []string {
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	if sessionID != "" {
+		args = append(args, "--resume", sessionID)
+	}
+	if cfg.AgentModel != "" {
+		args = append(args, "--model", cfg.AgentModel)
+	}
+	args = append(args, claudePermissionArgs(cfg.CodexSandbox)...)
+
+	// Claude reads images through its file tools, so the paths go into the
+	// prompt and their directories are made accessible.
+	seenDirs := map[string]bool{}
+	var refs []string
+	for _, p := range imagePaths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		refs = append(refs, "- "+p)
+		dir := filepath.Dir(p)
+		if !seenDirs[dir] {
+			seenDirs[dir] = true
+			args = append(args, "--add-dir", dir)
+		}
+	}
+	if len(refs) > 0 {
+		prompt = prompt + "\n\nAttached images (read them from disk):\n" + strings.Join(refs, "\n")
+	}
+	return append(args, "--", prompt)
+}
+
+func (c claudeRunner) Run(parent context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
+	existingSessionID := getRunSessionID(parent, c.Name(), chatID)
+	args := buildClaudeArgs(cfg, prompt, existingSessionID, imagePaths)
+
+	ctx, cancel := context.WithTimeout(parent, time.Duration(cfg.TimeoutSec)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.ClaudeBin, args...)
+	cmd.Dir = cfg.CodexWorkdir
+	releaseGroup := startInProcessGroup(cmd, killGrace(cfg))
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	releaseGroup()
+	summary := parseClaudeOutput(stdout.String())
+	if isRunCancelled(parent) {
+		log.Printf("[claude] cancelled chat_id=%d session=%q", chatID, existingSessionID)
+		return agentRunResult{Output: summary.PartialReply()}, errRunCancelled
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("[claude] timeout chat_id=%d session=%q", chatID, existingSessionID)
+		return agentRunResult{Output: summary.PartialReply()}, newAgentTimeoutError(cfg.TimeoutSec)
+	}
+	if err != nil || (summary.Result != nil && summary.Result.IsError) {
+		detail := strings.TrimSpace(stderr.String())
+		if summary.Result != nil {
+			detail = strings.TrimSpace(strings.Join([]string{summary.Result.Subtype, summary.Result.Result, string(summary.Result.Errors), detail}, "\n"))
+		}
+		if err == nil {
+			err = errors.New("claude reported an error")
+		}
+		log.Printf("[claude] exec failed chat_id=%d session=%q args=%q stdout=%q stderr=%q err=%v", chatID, existingSessionID, args, stdout.String(), stderr.String(), err)
+		return agentRunResult{}, newAgentExecError(err, detail, detail)
+	}
+	if summary.Events == 0 {
+		log.Printf("[claude] no json output chat_id=%d stdout=%q stderr=%q", chatID, stdout.String(), stderr.String())
+		return agentRunResult{}, fmt.Errorf("claude produced no JSON output\n%s", strings.TrimSpace(stdout.String()+"\n"+stderr.String()))
+	}
+
+	sessionID := summary.SessionID
+	if sessionID == "" {
+		sessionID = existingSessionID
+	}
+	usage := summary.Usage()
+	reply := summary.Reply()
+	log.Printf("[claude] exec ok chat_id=%d session_before=%q session_after=%q events=%d tokens_in=%d tokens_cached=%d tokens_out=%d cost_usd=%.4f reply begin\n%s\n[claude] exec ok chat_id=%d reply end",
+		chatID, existingSessionID, sessionID, summary.Events, usage.InputTokens, usage.CachedInputTokens, usage.OutputTokens, usage.CostUSD, reply, chatID)
+	return agentRunResult{Output: reply, SessionID: sessionID, Usage: usage}, nil
+}
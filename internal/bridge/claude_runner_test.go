@@ -0,0 +1,61 @@
+package bridge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseClaudeOutput_StreamJSON(t *testing.T) {
+	t.Parallel()
+
+	stream := `{"type":"system","subtype":"init","session_id":"3f1c-sid","model":"claude-sonnet"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Looking at the file."},{"type":"tool_use","name":"Read"}]},"session_id":"3f1c-sid"}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"All done."}]},"session_id":"3f1c-sid"}
+{"type":"result","subtype":"success","is_error":false,"result":"All done.","session_id":"3f1c-sid","total_cost_usd":0.0123,"usage":{"input_tokens":10,"cache_creation_input_tokens":90,"cache_read_input_tokens":400,"output_tokens":25}}
+`
+	got := parseClaudeOutput(stream)
+	if got.SessionID != "3f1c-sid" || got.Reply() != "All done." {
+		t.Fatalf("unexpected summary: session=%q reply=%q", got.SessionID, got.Reply())
+	}
+	if got.PartialReply() != "Looking at the file.\n\nAll done." {
+		t.Fatalf("partial reply = %q", got.PartialReply())
+	}
+	want := agentUsage{InputTokens: 100, CachedInputTokens: 400, OutputTokens: 25, CostUSD: 0.0123}
+	if got.Usage() != want {
+		t.Fatalf("usage = %+v, want %+v", got.Usage(), want)
+	}
+}
+
+func TestParseClaudeOutput_SingleJSON(t *testing.T) {
+	t.Parallel()
+
+	got := parseClaudeOutput(`{"type":"result","subtype":"success","result":"hi","session_id":"s-1","total_cost_usd":0.5}`)
+	if got.SessionID != "s-1" || got.Reply() != "hi" || got.Usage().CostUSD != 0.5 {
+		t.Fatalf("unexpected summary: %+v", got)
+	}
+}
+
+func TestBuildClaudeArgs(t *testing.T) {
+	t.Parallel()
+
+	cfg := bridgeConfig{AgentModel: "sonnet", CodexSandbox: "read-only"}
+	got := buildClaudeArgs(cfg, "describe", "sid-9", []string{"/tmp/img/a.png", "/tmp/img/b.png"})
+	want := []string{
+		"-p", "--output-format", "stream-json", "--verbose",
+		"--resume", "sid-9",
+		"--model", "sonnet",
+		"--permission-mode", "plan",
+		"--add-dir", "/tmp/img",
+		"--", "describe\n\nAttached images (read them from disk):\n- /tmp/img/a.png\n- /tmp/img/b.png",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("buildClaudeArgs mismatch\ngot : %q\nwant: %q", got, want)
+	}
+
+	if args := claudePermissionArgs("danger-full-access"); !reflect.DeepEqual(args, []string{"--dangerously-skip-permissions"}) {
+		t.Fatalf("danger-full-access args = %q", args)
+	}
+	if args := claudePermissionArgs("workspace-write"); !reflect.DeepEqual(args, []string{"--permission-mode", "acceptEdits"}) {
+		t.Fatalf("workspace-write args = %q", args)
+	}
+}
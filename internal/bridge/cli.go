@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// RunCLI handles maintenance subcommands such as `telegent audit verify`.
+// It returns the process exit code.
+func RunCLI(args []string) int {
+	return runCLI(args, os.Stdout, os.Stderr)
+}
+
+func runCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		printCLIUsage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "audit":
+		return runAuditCLI(args[1:], stdout, stderr)
+	case "store":
+		return runStoreCLI(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		printCLIUsage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		printCLIUsage(stderr)
+		return 2
+	}
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage:")
+	fmt.Fprintln(w, "  telegent                      run the bridge")
+	fmt.Fprintln(w, "  telegent audit verify [file]  verify the audit log hash chain")
+	fmt.Fprintln(w, "  telegent store keygen         print a new random store encryption key")
+	fmt.Fprintln(w, "  telegent store encrypt        encrypt chat history, session store and memory")
+	fmt.Fprintln(w, "  telegent store decrypt        decrypt them back to plaintext")
+}
+
+func runAuditCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "verify" {
+		printCLIUsage(stderr)
+		return 2
+	}
+	path := ""
+	if len(args) > 1 && strings.TrimSpace(args[1]) != "" {
+		path = strings.TrimSpace(args[1])
+	} else {
+		// The store key is not needed here, so only a failure to resolve the
+		// store locations counts.
+		cfg, err := loadStoreConfig()
+		if cfg.AuditLogFile == "" {
+			fmt.Fprintf(stderr, "audit verify failed: %v\n", err)
+			return 1
+		}
+		path = cfg.AuditLogFile
+	}
+	report, err := verifyAuditLog(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit verify failed: %v\n", err)
+		return 1
+	}
+	if !report.OK() {
+		fmt.Fprintf(stdout, "audit log %s: TAMPERED (%d entries checked)\n", path, report.Entries)
+		for _, p := range report.Problems {
+			fmt.Fprintf(stdout, "  - %s\n", p)
+		}
+		return 1
+	}
+	fmt.Fprintf(stdout, "audit log %s: OK (%d entries, head seq=%d)\n", path, report.Entries, report.LastSeq)
+	return 0
+}
+
+func runStoreCLI(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		printCLIUsage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "keygen":
+		key, err := generateStoreKey()
+		if err != nil {
+			fmt.Fprintf(stderr, "keygen failed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, key)
+		return 0
+	case "encrypt", "decrypt":
+		cfg, err := loadStoreConfig()
+		if err != nil {
+			fmt.Fprintf(stderr, "config error: %v\n", err)
+			return 1
+		}
+		done, err := migrateStores(cfg, args[0] == "encrypt")
+		for _, p := range done {
+			fmt.Fprintf(stdout, "%sed %s\n", args[0], p)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "store %s failed: %v\n", args[0], err)
+			return 1
+		}
+		return 0
+	default:
+		printCLIUsage(stderr)
+		return 2
+	}
+}
@@ -0,0 +1,183 @@
+package bridge
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Events emitted by `codex exec --json`. Newer releases emit thread/turn/item
+// events; older ones wrap everything in {"msg": {...}}. Both are decoded.
+type codexEvent struct {
+	Type     string          `json:"type"`
+	ThreadID string          `json:"thread_id"`
+	Item     *codexItem      `json:"item"`
+	Usage    *codexUsage     `json:"usage"`
+	Error    *codexError     `json:"error"`
+	Message  string          `json:"message"`
+	Msg      *codexLegacyMsg `json:"msg"`
+}
+
+type codexItem struct {
+	ID               string            `json:"id"`
+	Type             string            `json:"type"`
+	Text             string            `json:"text"`
+	Command          string            `json:"command"`
+	AggregatedOutput string            `json:"aggregated_output"`
+	ExitCode         *int              `json:"exit_code"`
+	Status           string            `json:"status"`
+	Changes          []codexFileChange `json:"changes"`
+}
+
+type codexFileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+type codexUsage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+}
+
+type codexError struct {
+	Message string `json:"message"`
+}
+
+type codexLegacyMsg struct {
+	Type             string `json:"type"`
+	SessionID        string `json:"session_id"`
+	Message          string `json:"message"`
+	LastAgentMessage string `json:"last_agent_message"`
+	codexUsage
+	Info *struct {
+		TotalTokenUsage *codexUsage `json:"total_token_usage"`
+	} `json:"info"`
+}
+
+type codexCommandExec struct {
+	Command  string
+	ExitCode *int
+	Output   string
+}
+
+// codexRunSummary is what a run produced according to its structured events.
+type codexRunSummary struct {
+	Events      int
+	SessionID   string
+	Messages    []string
+	Commands    []codexCommandExec
+	FileChanges []codexFileChange
+	Usage       agentUsage
+	Errors      []string
+}
+
+func (s codexRunSummary) FinalReply() string {
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if strings.TrimSpace(s.Messages[i]) != "" {
+			return strings.TrimSpace(s.Messages[i])
+		}
+	}
+	return ""
+}
+
+// PartialReply joins every agent message seen so far; used when a run is
+// stopped before its final answer.
+func (s codexRunSummary) PartialReply() string {
+	return strings.TrimSpace(strings.Join(s.Messages, "\n\n"))
+}
+
+func parseCodexEventStream(output string) codexRunSummary {
+	summary := codexRunSummary{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var ev codexEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			continue
+		}
+		if ev.Type == "" && ev.Msg == nil {
+			continue
+		}
+		summary.Events++
+		if ev.Msg != nil {
+			summary.applyLegacy(*ev.Msg)
+			continue
+		}
+		summary.apply(ev)
+	}
+	return summary
+}
+
+func (s *codexRunSummary) apply(ev codexEvent) {
+	switch ev.Type {
+	case "thread.started", "session.created":
+		if strings.TrimSpace(ev.ThreadID) != "" {
+			s.SessionID = strings.TrimSpace(ev.ThreadID)
+		}
+	case "item.completed":
+		if ev.Item == nil {
+			return
+		}
+		switch ev.Item.Type {
+		case "agent_message", "assistant_message":
+			s.Messages = append(s.Messages, ev.Item.Text)
+		case "command_execution":
+			s.Commands = append(s.Commands, codexCommandExec{
+				Command:  ev.Item.Command,
+				ExitCode: ev.Item.ExitCode,
+				Output:   ev.Item.AggregatedOutput,
+			})
+		case "file_change":
+			s.FileChanges = append(s.FileChanges, ev.Item.Changes...)
+		case "error":
+			s.Errors = append(s.Errors, ev.Item.Text)
+		}
+	case "turn.completed":
+		if ev.Usage != nil {
+			s.Usage.add(*ev.Usage)
+		}
+	case "turn.failed":
+		if ev.Error != nil {
+			s.Errors = append(s.Errors, ev.Error.Message)
+		}
+	case "error":
+		s.Errors = append(s.Errors, ev.Message)
+	}
+}
+
+func (s *codexRunSummary) applyLegacy(msg codexLegacyMsg) {
+	switch msg.Type {
+	case "session_configured":
+		if strings.TrimSpace(msg.SessionID) != "" {
+			s.SessionID = strings.TrimSpace(msg.SessionID)
+		}
+	case "agent_message":
+		s.Messages = append(s.Messages, msg.Message)
+	case "task_complete":
+		if strings.TrimSpace(msg.LastAgentMessage) != "" && msg.LastAgentMessage != s.FinalReply() {
+			s.Messages = append(s.Messages, msg.LastAgentMessage)
+		}
+	case "token_count":
+		// Legacy token_count events are cumulative, so keep the latest.
+		if msg.Info != nil && msg.Info.TotalTokenUsage != nil {
+			s.Usage = agentUsage{}
+			s.Usage.add(*msg.Info.TotalTokenUsage)
+		} else if msg.InputTokens > 0 || msg.OutputTokens > 0 {
+			s.Usage = agentUsage{}
+			s.Usage.add(msg.codexUsage)
+		}
+	case "error":
+		s.Errors = append(s.Errors, msg.Message)
+	}
+}
+
+// add counts c into u. Codex reports cached_input_tokens as part of
+// input_tokens, while agentUsage keeps them apart so each is counted and
+// priced once.
+func (u *agentUsage) add(c codexUsage) {
+	u.InputTokens += uncachedInput(c.InputTokens, c.CachedInputTokens)
+	u.CachedInputTokens += c.CachedInputTokens
+	u.OutputTokens += c.OutputTokens
+}
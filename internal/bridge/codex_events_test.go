@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCodexEventStream(t *testing.T) {
+	t.Parallel()
+
+	stream := `Reading prompt from stdin...
+{"type":"thread.started","thread_id":"0199a213-81c0-7800-8aa1-bbab2a035a53"}
+{"type":"turn.started"}
+{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"thinking"}}
+{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"bash -lc ls","aggregated_output":"go.mod\n","exit_code":0,"status":"completed"}}
+{"type":"item.completed","item":{"id":"item_2","type":"file_change","changes":[{"path":"main.go","kind":"update"}],"status":"completed"}}
+{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"Done. Updated main.go."}}
+{"type":"turn.completed","usage":{"input_tokens":24763,"cached_input_tokens":24448,"output_tokens":122}}
+`
+	got := parseCodexEventStream(stream)
+	if got.SessionID != "0199a213-81c0-7800-8aa1-bbab2a035a53" {
+		t.Fatalf("session id = %q", got.SessionID)
+	}
+	if reply := got.FinalReply(); reply != "Done. Updated main.go." {
+		t.Fatalf("final reply = %q", reply)
+	}
+	if len(got.Commands) != 1 || got.Commands[0].Command != "bash -lc ls" || got.Commands[0].ExitCode == nil || *got.Commands[0].ExitCode != 0 {
+		t.Fatalf("commands = %+v", got.Commands)
+	}
+	if len(got.FileChanges) != 1 || got.FileChanges[0].Path != "main.go" {
+		t.Fatalf("file changes = %+v", got.FileChanges)
+	}
+	want := agentUsage{InputTokens: 315, CachedInputTokens: 24448, OutputTokens: 122}
+	if got.Usage != want {
+		t.Fatalf("usage = %+v, want %+v", got.Usage, want)
+	}
+	// Cached tokens are part of input_tokens and must not be counted twice.
+	if total := got.Usage.Total(); total != 24885 {
+		t.Fatalf("total = %d, want 24885", total)
+	}
+	cfg := bridgeConfig{ModelPrices: map[string]modelPrice{"gpt-5": {Input: 1.25, Output: 10, CachedInput: 0.125}}}
+	cost, _ := usageCost(cfg, "codex", "gpt-5", got.Usage)
+	if want := (315*1.25 + 24448*0.125 + 122*10) / 1e6; math.Abs(cost-want) > 1e-12 {
+		t.Fatalf("cost = %v, want %v", cost, want)
+	}
+}
+
+func TestParseCodexEventStream_Legacy(t *testing.T) {
+	t.Parallel()
+
+	stream := `{"id":"0","msg":{"type":"session_configured","session_id":"legacy-sid","model":"gpt-5"}}
+{"id":"1","msg":{"type":"agent_message","message":"hello"}}
+{"id":"1","msg":{"type":"token_count","info":{"total_token_usage":{"input_tokens":10,"cached_input_tokens":2,"output_tokens":5}}}}
+{"id":"1","msg":{"type":"task_complete","last_agent_message":"hello"}}
+`
+	got := parseCodexEventStream(stream)
+	if got.SessionID != "legacy-sid" || got.FinalReply() != "hello" || len(got.Messages) != 1 {
+		t.Fatalf("unexpected summary: %+v", got)
+	}
+	if got.Usage != (agentUsage{InputTokens: 8, CachedInputTokens: 2, OutputTokens: 5}) {
+		t.Fatalf("usage = %+v", got.Usage)
+	}
+}
+
+func TestParseCodexEventStream_NoEvents(t *testing.T) {
+	t.Parallel()
+
+	got := parseCodexEventStream("OpenAI Codex v0.20\n--------\nsession id: abc\ncodex\nhi\n")
+	if got.Events != 0 {
+		t.Fatalf("expected no events, got %d", got.Events)
+	}
+}
@@ -9,6 +9,12 @@ import (
 	"strings"
 )
 
+const (
+	defaultMemoryFile       = "MEMORY.md"
+	defaultChatLogFile      = "tmp/chat-history.jsonl"
+	defaultSessionStoreFile = "tmp/codex-sessions.json"
+)
+
 func loadConfig() (bridgeConfig, error) {
 	cfg := bridgeConfig{}
 	cfg.BotToken = strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
@@ -35,37 +41,84 @@ func loadConfig() (bridgeConfig, error) {
 		cfg.ParentPID = pid
 	}
 
+	cfg.AgentProvider = strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_PROVIDER")))
+	if cfg.AgentProvider == "" {
+		cfg.AgentProvider = "codex"
+	}
+	// AGENT_BIN is the default provider's program, so the built-in providers
+	// only fall back to it when they are the default.
+	agentBin := strings.TrimSpace(os.Getenv("AGENT_BIN"))
 	cfg.CodexBin = strings.TrimSpace(os.Getenv("CODEX_BIN"))
 	if cfg.CodexBin == "" {
 		cfg.CodexBin = "codex"
+		if cfg.AgentProvider == "codex" && agentBin != "" {
+			cfg.CodexBin = agentBin
+		}
 	}
-	cfg.AgentProvider = strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_PROVIDER")))
-	if cfg.AgentProvider == "" {
-		cfg.AgentProvider = "codex"
+	cfg.AgentProviders = parseAgentProviders(os.Getenv("AGENT_PROVIDERS"), cfg.AgentProvider)
+	cfg.AgentFallback = splitProviderList(os.Getenv("AGENT_FALLBACK"))
+	for _, p := range cfg.AgentFallback {
+		if !isConfiguredProvider(cfg, p) {
+			cfg.AgentProviders = append(cfg.AgentProviders, p)
+		}
 	}
-	cfg.AgentBin = strings.TrimSpace(os.Getenv("AGENT_BIN"))
+	cfg.AgentBin = agentBin
 	if cfg.AgentBin == "" {
 		cfg.AgentBin = cfg.CodexBin
 	}
+	cfg.ClaudeBin = strings.TrimSpace(os.Getenv("CLAUDE_BIN"))
+	if cfg.ClaudeBin == "" {
+		cfg.ClaudeBin = "claude"
+		if cfg.AgentProvider == "claude" && agentBin != "" {
+			cfg.ClaudeBin = agentBin
+		}
+	}
 	cfg.AgentArgs = strings.TrimSpace(os.Getenv("AGENT_ARGS"))
+	cfg.AgentResumeArgs = strings.TrimSpace(os.Getenv("AGENT_RESUME_ARGS"))
+	cfg.AgentSessionRegex = strings.TrimSpace(os.Getenv("AGENT_SESSION_REGEX"))
+	cfg.AgentSessionJSONPath = strings.TrimSpace(os.Getenv("AGENT_SESSION_JSON_PATH"))
+	cfg.AgentReplyJSONPath = strings.TrimSpace(os.Getenv("AGENT_REPLY_JSON_PATH"))
+	if err := validateGenericOutputConfig(cfg); err != nil {
+		return cfg, err
+	}
+	cfg.AgentPromptMode = strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_PROMPT_MODE")))
+	if cfg.AgentPromptMode == "" {
+		cfg.AgentPromptMode = promptModeArgv
+	}
+	cfg.AgentPromptEnv = strings.TrimSpace(os.Getenv("AGENT_PROMPT_ENV"))
+	if cfg.AgentPromptEnv == "" {
+		cfg.AgentPromptEnv = defaultAgentPromptEnv
+	}
+	if err := validatePromptMode(cfg); err != nil {
+		return cfg, err
+	}
 	cfg.AgentModel = strings.TrimSpace(os.Getenv("AGENT_MODEL"))
-	supportsImg := strings.ToLower(strings.TrimSpace(os.Getenv("AGENT_SUPPORTS_IMAGE")))
-	switch supportsImg {
-	case "1", "true", "yes", "on":
-		cfg.AgentSupportsImage = true
-	case "0", "false", "no", "off":
-		cfg.AgentSupportsImage = false
-	default:
-		cfg.AgentSupportsImage = (cfg.AgentProvider == "codex")
+	cfg.OpenAIBaseURL = strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+	if isConfiguredProvider(cfg, "openai") && cfg.OpenAIBaseURL == "" {
+		return cfg, errors.New("OPENAI_BASE_URL is required when the openai provider is configured")
 	}
-
-	cfg.CodexWorkdir = strings.TrimSpace(os.Getenv("CODEX_WORKDIR"))
-	if cfg.CodexWorkdir == "" {
-		wd, err := os.Getwd()
-		if err != nil {
-			return cfg, fmt.Errorf("failed to get current directory: %w", err)
+	cfg.OpenAIAPIKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	cfg.OpenAIModel = strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
+	if cfg.OpenAIModel == "" {
+		cfg.OpenAIModel = cfg.AgentModel
+	}
+	cfg.OpenAIHistoryTokens = 8000
+	if budgetStr := strings.TrimSpace(os.Getenv("OPENAI_HISTORY_TOKENS")); budgetStr != "" {
+		b, err := strconv.Atoi(budgetStr)
+		if err != nil || b <= 0 {
+			return cfg, errors.New("OPENAI_HISTORY_TOKENS must be a positive integer")
 		}
-		cfg.CodexWorkdir = wd
+		cfg.OpenAIHistoryTokens = b
+	}
+	if supportsImg, ok := envBool("AGENT_SUPPORTS_IMAGE"); ok {
+		cfg.AgentSupportsImage = supportsImg
+	} else {
+		cfg.AgentSupportsImage = isBuiltinProvider(cfg.AgentProvider)
+	}
+
+	cfg.CodexWorkdir, err = resolveWorkdir()
+	if err != nil {
+		return cfg, err
 	}
 
 	cfg.CodexModel = strings.TrimSpace(os.Getenv("CODEX_MODEL"))
@@ -120,7 +173,7 @@ func loadConfig() (bridgeConfig, error) {
 	}
 	cfg.MemoryFile = strings.TrimSpace(os.Getenv("MEMORY_FILE"))
 	if cfg.MemoryFile == "" {
-		cfg.MemoryFile = "MEMORY.md"
+		cfg.MemoryFile = defaultMemoryFile
 	}
 
 	cfg.TimeoutSec = 120
@@ -132,6 +185,64 @@ func loadConfig() (bridgeConfig, error) {
 		cfg.TimeoutSec = t
 	}
 
+	cfg.AgentMaxRetries = 2
+	if retriesStr := strings.TrimSpace(os.Getenv("AGENT_MAX_RETRIES")); retriesStr != "" {
+		r, err := strconv.Atoi(retriesStr)
+		if err != nil || r < 0 {
+			return cfg, errors.New("AGENT_MAX_RETRIES must be a non-negative integer")
+		}
+		cfg.AgentMaxRetries = r
+	}
+	cfg.AgentRetryBackoffMs = 2000
+	if backoffStr := strings.TrimSpace(os.Getenv("AGENT_RETRY_BACKOFF_MS")); backoffStr != "" {
+		b, err := strconv.Atoi(backoffStr)
+		if err != nil || b < 0 {
+			return cfg, errors.New("AGENT_RETRY_BACKOFF_MS must be a non-negative integer")
+		}
+		cfg.AgentRetryBackoffMs = b
+	}
+
+	cfg.AgentKillGraceSec = 5
+	if graceStr := strings.TrimSpace(os.Getenv("AGENT_KILL_GRACE_SEC")); graceStr != "" {
+		g, err := strconv.Atoi(graceStr)
+		if err != nil || g < 0 {
+			return cfg, errors.New("AGENT_KILL_GRACE_SEC must be a non-negative integer")
+		}
+		cfg.AgentKillGraceSec = g
+	}
+
+	cfg.AllowedModels = splitSettingList(os.Getenv("ALLOWED_MODELS"))
+	cfg.AllowedSandboxes = splitSettingList(os.Getenv("ALLOWED_SANDBOXES"))
+	if len(cfg.AllowedSandboxes) == 0 {
+		cfg.AllowedSandboxes = []string{"read-only", "workspace-write"}
+	}
+	for _, sb := range cfg.AllowedSandboxes {
+		switch sb {
+		case "read-only", "workspace-write", "danger-full-access":
+		default:
+			return cfg, fmt.Errorf("ALLOWED_SANDBOXES contains unknown sandbox %q", sb)
+		}
+	}
+	cfg.ModelPrices, err = parseModelPrices(os.Getenv("MODEL_PRICES"))
+	if err != nil {
+		return cfg, err
+	}
+	if budgetStr := strings.TrimSpace(os.Getenv("DAILY_BUDGET_USD")); budgetStr != "" {
+		b, err := strconv.ParseFloat(budgetStr, 64)
+		if err != nil || b < 0 {
+			return cfg, errors.New("DAILY_BUDGET_USD must be a non-negative number")
+		}
+		cfg.DailyBudgetUSD = b
+	}
+	cfg.ChatMaxTimeoutSec = 3600
+	if maxTimeoutStr := strings.TrimSpace(os.Getenv("CHAT_MAX_TIMEOUT_SEC")); maxTimeoutStr != "" {
+		m, err := strconv.Atoi(maxTimeoutStr)
+		if err != nil || m < minChatTimeoutSec {
+			return cfg, fmt.Errorf("CHAT_MAX_TIMEOUT_SEC must be an integer >= %d", minChatTimeoutSec)
+		}
+		cfg.ChatMaxTimeoutSec = m
+	}
+
 	cfg.MaxReplyChars = 3500
 	if maxStr := strings.TrimSpace(os.Getenv("MAX_REPLY_CHARS")); maxStr != "" {
 		m, err := strconv.Atoi(maxStr)
@@ -141,14 +252,54 @@ func loadConfig() (bridgeConfig, error) {
 		cfg.MaxReplyChars = m
 	}
 
+	cfg.MaxConcurrentChats = 4
+	if concStr := strings.TrimSpace(os.Getenv("MAX_CONCURRENT_CHATS")); concStr != "" {
+		c, err := strconv.Atoi(concStr)
+		if err != nil || c <= 0 {
+			return cfg, errors.New("MAX_CONCURRENT_CHATS must be a positive integer")
+		}
+		cfg.MaxConcurrentChats = c
+	}
+
+	cfg.QueueMaxPending = 10
+	if pendingStr := strings.TrimSpace(os.Getenv("QUEUE_MAX_PENDING")); pendingStr != "" {
+		p, err := strconv.Atoi(pendingStr)
+		if err != nil || p <= 0 {
+			return cfg, errors.New("QUEUE_MAX_PENDING must be a positive integer")
+		}
+		cfg.QueueMaxPending = p
+	}
+	cfg.QueueOverflowPolicy = queueOverflowPolicy(strings.ToLower(strings.TrimSpace(os.Getenv("QUEUE_OVERFLOW_POLICY"))))
+	switch cfg.QueueOverflowPolicy {
+	case "":
+		cfg.QueueOverflowPolicy = queueOverflowReject
+	case queueOverflowReject, queueOverflowDropOldest, queueOverflowCoalesce:
+	default:
+		return cfg, errors.New("QUEUE_OVERFLOW_POLICY must be one of reject, drop_oldest, coalesce")
+	}
+
+	cfg.ShutdownTimeoutSec = 30
+	if shutdownStr := strings.TrimSpace(os.Getenv("SHUTDOWN_TIMEOUT_SEC")); shutdownStr != "" {
+		t, err := strconv.Atoi(shutdownStr)
+		if err != nil || t < 0 {
+			return cfg, errors.New("SHUTDOWN_TIMEOUT_SEC must be a non-negative integer")
+		}
+		cfg.ShutdownTimeoutSec = t
+	}
+
+	cfg.StoreKey, err = loadStoreKey()
+	if err != nil {
+		return cfg, err
+	}
+
 	cfg.ChatLogFile = strings.TrimSpace(os.Getenv("CHAT_LOG_FILE"))
 	if cfg.ChatLogFile == "" {
-		cfg.ChatLogFile = "tmp/chat-history.jsonl"
+		cfg.ChatLogFile = defaultChatLogFile
 	}
 	if err := os.MkdirAll(filepath.Dir(cfg.ChatLogFile), 0o755); err != nil {
 		return cfg, fmt.Errorf("failed to create chat log dir: %w", err)
 	}
-	f, err := os.OpenFile(cfg.ChatLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	f, err := os.OpenFile(cfg.ChatLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, storeFileMode(cfg))
 	if err != nil {
 		return cfg, fmt.Errorf("failed to initialize chat log file: %w", err)
 	}
@@ -156,17 +307,213 @@ func loadConfig() (bridgeConfig, error) {
 
 	cfg.SessionStoreFile = strings.TrimSpace(os.Getenv("SESSION_STORE_FILE"))
 	if cfg.SessionStoreFile == "" {
-		cfg.SessionStoreFile = "tmp/codex-sessions.json"
+		cfg.SessionStoreFile = defaultSessionStoreFile
 	}
 	if err := os.MkdirAll(filepath.Dir(cfg.SessionStoreFile), 0o755); err != nil {
 		return cfg, fmt.Errorf("failed to create session store dir: %w", err)
 	}
-	if err := loadSessions(cfg.SessionStoreFile); err != nil {
+	cfg.SessionStoreBackups = 3
+	if backupsStr := strings.TrimSpace(os.Getenv("SESSION_STORE_BACKUPS")); backupsStr != "" {
+		n, err := strconv.Atoi(backupsStr)
+		if err != nil || n < 0 {
+			return cfg, errors.New("SESSION_STORE_BACKUPS must be a non-negative integer")
+		}
+		cfg.SessionStoreBackups = n
+	}
+	if ttlStr := strings.TrimSpace(os.Getenv("SESSION_IDLE_TTL_SEC")); ttlStr != "" {
+		ttl, err := strconv.Atoi(ttlStr)
+		if err != nil || ttl < 0 {
+			return cfg, errors.New("SESSION_IDLE_TTL_SEC must be a non-negative integer")
+		}
+		cfg.SessionIdleTTLSec = ttl
+	}
+	if turnsStr := strings.TrimSpace(os.Getenv("SESSION_MAX_TURNS")); turnsStr != "" {
+		turns, err := strconv.Atoi(turnsStr)
+		if err != nil || turns < 0 {
+			return cfg, errors.New("SESSION_MAX_TURNS must be a non-negative integer")
+		}
+		cfg.SessionMaxTurns = turns
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("NEWSESSION_CARRY"))) {
+	case "1", "true", "yes", "on":
+		cfg.NewSessionCarry = true
+	}
+	cfg.SummarizerProvider = strings.ToLower(strings.TrimSpace(os.Getenv("SUMMARIZER_PROVIDER")))
+	if cfg.SummarizerProvider != "" && !isConfiguredProvider(cfg, cfg.SummarizerProvider) {
+		cfg.AgentProviders = append(cfg.AgentProviders, cfg.SummarizerProvider)
+	}
+	cfg.GenericAgents = map[string]genericAgentConfig{}
+	for _, p := range cfg.AgentProviders {
+		if isBuiltinProvider(p) {
+			continue
+		}
+		g := loadGenericAgentConfig(cfg, p)
+		check := cfg
+		check.AgentArgs, check.AgentResumeArgs = g.Args, g.ResumeArgs
+		if err := validatePromptMode(check); err != nil {
+			return cfg, fmt.Errorf("provider %s: %w", p, err)
+		}
+		cfg.GenericAgents[p] = g
+	}
+	if err := loadSessions(cfg); err != nil {
 		return cfg, fmt.Errorf("failed to load session store: %w", err)
 	}
+	cfg.OpenAIHistoryDir = filepath.Join(filepath.Dir(cfg.SessionStoreFile), "openai-history")
+	cfg.ChatSettingsFile = defaultChatSettingsPath(cfg)
+	if err := loadChatSettings(cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load chat settings: %w", err)
+	}
+	cfg.SessionHistoryFile = defaultSessionHistoryPath(cfg)
+	if err := loadSessionHistory(cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load session history: %w", err)
+	}
+	cfg.ScheduleFile = defaultSchedulePath(cfg)
+	cfg.ScheduleCatchup = strings.ToLower(strings.TrimSpace(os.Getenv("SCHEDULE_CATCHUP")))
+	switch cfg.ScheduleCatchup {
+	case "":
+		cfg.ScheduleCatchup = scheduleCatchupOnce
+	case scheduleCatchupOnce, scheduleCatchupSkip:
+	default:
+		return cfg, errors.New("SCHEDULE_CATCHUP must be once or skip")
+	}
+	if err := loadSchedules(cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load schedules: %w", err)
+	}
+	cfg.ReminderFile = defaultReminderPath(cfg)
+	if err := loadReminders(cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load reminders: %w", err)
+	}
+	cfg.BgTimeoutSec = 7200
+	if bgTimeoutStr := strings.TrimSpace(os.Getenv("BG_TIMEOUT_SEC")); bgTimeoutStr != "" {
+		t, err := strconv.Atoi(bgTimeoutStr)
+		if err != nil || t <= 0 {
+			return cfg, errors.New("BG_TIMEOUT_SEC must be a positive integer")
+		}
+		cfg.BgTimeoutSec = t
+	}
+	cfg.BgMaxRunning = 2
+	if bgMaxStr := strings.TrimSpace(os.Getenv("BG_MAX_RUNNING")); bgMaxStr != "" {
+		n, err := strconv.Atoi(bgMaxStr)
+		if err != nil || n <= 0 {
+			return cfg, errors.New("BG_MAX_RUNNING must be a positive integer")
+		}
+		cfg.BgMaxRunning = n
+	}
+	cfg.BgJobFile = defaultBackgroundJobPath(cfg)
+	if err := loadBackgroundJobs(cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load background jobs: %w", err)
+	}
+	cfg.UsageLogFile = defaultUsageLogPath(cfg)
+	cfg.AuditLogFile = defaultAuditLogPath(cfg)
+	if err := os.MkdirAll(filepath.Dir(cfg.AuditLogFile), 0o755); err != nil {
+		return cfg, fmt.Errorf("failed to create audit log dir: %w", err)
+	}
 	if err := ensureMemoryFile(cfg); err != nil {
 		return cfg, fmt.Errorf("failed to initialize memory file: %w", err)
 	}
+	restrictStoreFiles(cfg)
 
 	return cfg, nil
 }
+
+func defaultChatSettingsPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("CHAT_SETTINGS_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "chat-settings.json")
+}
+
+func resolveWorkdir() (string, error) {
+	wd := strings.TrimSpace(os.Getenv("CODEX_WORKDIR"))
+	if wd != "" {
+		return wd, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return wd, nil
+}
+
+// loadStoreConfig resolves only the persistent store locations and key. It is
+// used by maintenance commands that must not require Telegram credentials.
+func loadStoreConfig() (bridgeConfig, error) {
+	cfg := bridgeConfig{}
+	var err error
+	cfg.CodexWorkdir, err = resolveWorkdir()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MemoryFile = strings.TrimSpace(os.Getenv("MEMORY_FILE"))
+	if cfg.MemoryFile == "" {
+		cfg.MemoryFile = defaultMemoryFile
+	}
+	cfg.ChatLogFile = strings.TrimSpace(os.Getenv("CHAT_LOG_FILE"))
+	if cfg.ChatLogFile == "" {
+		cfg.ChatLogFile = defaultChatLogFile
+	}
+	cfg.SessionStoreFile = strings.TrimSpace(os.Getenv("SESSION_STORE_FILE"))
+	if cfg.SessionStoreFile == "" {
+		cfg.SessionStoreFile = defaultSessionStoreFile
+	}
+	cfg.OpenAIHistoryDir = filepath.Join(filepath.Dir(cfg.SessionStoreFile), "openai-history")
+	cfg.ChatSettingsFile = defaultChatSettingsPath(cfg)
+	cfg.UsageLogFile = defaultUsageLogPath(cfg)
+	cfg.SessionHistoryFile = defaultSessionHistoryPath(cfg)
+	cfg.ScheduleFile = defaultSchedulePath(cfg)
+	cfg.ReminderFile = defaultReminderPath(cfg)
+	cfg.BgJobFile = defaultBackgroundJobPath(cfg)
+	cfg.AuditLogFile = defaultAuditLogPath(cfg)
+	cfg.StoreKey, err = loadStoreKey()
+	return cfg, err
+}
+
+// envBool reads a yes/no setting; ok is false when name is unset or holds
+// something else.
+func envBool(name string) (value bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "yes", "on":
+		return true, true
+	case "0", "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// loadGenericAgentConfig reads <PROVIDER>_BIN, <PROVIDER>_ARGS,
+// <PROVIDER>_RESUME_ARGS and <PROVIDER>_SUPPORTS_IMAGE for a generic
+// provider, e.g. AIDER_BIN for "aider". Unset values fall back to the AGENT_*
+// settings; image support is off unless one of them turns it on.
+func loadGenericAgentConfig(cfg bridgeConfig, provider string) genericAgentConfig {
+	prefix := providerEnvPrefix(provider)
+	g := genericAgentConfig{Bin: cfg.AgentBin, Args: cfg.AgentArgs, ResumeArgs: cfg.AgentResumeArgs}
+	if v := strings.TrimSpace(os.Getenv(prefix + "_BIN")); v != "" {
+		g.Bin = v
+	}
+	if v := strings.TrimSpace(os.Getenv(prefix + "_ARGS")); v != "" {
+		g.Args = v
+	}
+	if v := strings.TrimSpace(os.Getenv(prefix + "_RESUME_ARGS")); v != "" {
+		g.ResumeArgs = v
+	}
+	if v, ok := envBool(prefix + "_SUPPORTS_IMAGE"); ok {
+		g.SupportsImage = v
+	} else if v, ok := envBool("AGENT_SUPPORTS_IMAGE"); ok {
+		g.SupportsImage = v
+	}
+	return g
+}
+
+// providerEnvPrefix turns a provider name into the prefix of its settings:
+// upper case, with anything but letters and digits replaced by '_'.
+func providerEnvPrefix(provider string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, provider)
+}
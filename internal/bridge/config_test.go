@@ -44,6 +44,9 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if cfg.MaxReplyChars != 3500 {
 		t.Fatalf("MaxReplyChars=%d", cfg.MaxReplyChars)
 	}
+	if cfg.MaxConcurrentChats != 4 {
+		t.Fatalf("MaxConcurrentChats=%d", cfg.MaxConcurrentChats)
+	}
 	if !strings.HasPrefix(cfg.WhisperScript, base) {
 		t.Fatalf("WhisperScript=%q, base=%q", cfg.WhisperScript, base)
 	}
@@ -56,6 +59,12 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if _, err := os.Stat(cfg.MemoryFile); err != nil {
 		t.Fatalf("memory file not initialized: %v", err)
 	}
+	if want := filepath.Join(base, "state", "audit-log.jsonl"); cfg.AuditLogFile != want {
+		t.Fatalf("AuditLogFile=%q, want %q", cfg.AuditLogFile, want)
+	}
+	if storeCfg, err := loadStoreConfig(); err != nil || storeCfg.AuditLogFile != cfg.AuditLogFile {
+		t.Fatalf("store config AuditLogFile=%q err=%v", storeCfg.AuditLogFile, err)
+	}
 }
 
 func TestLoadConfigAgentSupportsImageFallback(t *testing.T) {
@@ -81,6 +90,49 @@ func TestLoadConfigAgentSupportsImageFallback(t *testing.T) {
 	}
 }
 
+func TestLoadConfigPerProviderAgentSettings(t *testing.T) {
+	setupBaseConfigEnv(t)
+	t.Setenv("AGENT_PROVIDER", "codex")
+	t.Setenv("AGENT_PROVIDERS", "claude,aider,my-cli")
+	t.Setenv("AGENT_BIN", "/opt/codex")
+	t.Setenv("AGENT_ARGS", "--shared {{prompt}}")
+	t.Setenv("AIDER_BIN", "/opt/aider")
+	t.Setenv("AIDER_ARGS", "--message {{prompt}}")
+	t.Setenv("AIDER_RESUME_ARGS", "--restore {{session_id}} --message {{prompt}}")
+	t.Setenv("AIDER_SUPPORTS_IMAGE", "yes")
+	t.Setenv("MY_CLI_BIN", "/opt/my-cli")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error: %v", err)
+	}
+	if cfg.CodexBin != "/opt/codex" || cfg.ClaudeBin != "claude" {
+		t.Fatalf("CodexBin=%q ClaudeBin=%q", cfg.CodexBin, cfg.ClaudeBin)
+	}
+	aider := configForProvider(cfg, "aider")
+	if aider.AgentBin != "/opt/aider" || aider.AgentArgs != "--message {{prompt}}" || !strings.Contains(aider.AgentResumeArgs, "--restore") || !aider.AgentSupportsImage {
+		t.Fatalf("aider config = %q %q %q %v", aider.AgentBin, aider.AgentArgs, aider.AgentResumeArgs, aider.AgentSupportsImage)
+	}
+	if !selectRunner(aider).SupportsImages() {
+		t.Fatal("aider runner should accept images")
+	}
+	// Unset values fall back to AGENT_*, but image support is never taken
+	// from the built-in default provider.
+	mine := configForProvider(cfg, "my-cli")
+	if mine.AgentBin != "/opt/my-cli" || mine.AgentArgs != "--shared {{prompt}}" || mine.AgentSupportsImage {
+		t.Fatalf("my-cli config = %q %q %v", mine.AgentBin, mine.AgentArgs, mine.AgentSupportsImage)
+	}
+	if selectRunner(mine).SupportsImages() {
+		t.Fatal("my-cli runner should not accept images")
+	}
+
+	t.Setenv("AGENT_PROMPT_MODE", "stdin")
+	t.Setenv("AGENT_ARGS", "")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "provider aider") {
+		t.Fatalf("expected the aider template to be rejected in stdin mode, got %v", err)
+	}
+}
+
 func TestLoadConfigInvalidNumericValues(t *testing.T) {
 	setupBaseConfigEnv(t)
 
@@ -94,4 +146,10 @@ func TestLoadConfigInvalidNumericValues(t *testing.T) {
 	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "MAX_REPLY_CHARS") {
 		t.Fatalf("expected MAX_REPLY_CHARS validation error, got: %v", err)
 	}
+
+	t.Setenv("MAX_REPLY_CHARS", "3500")
+	t.Setenv("MAX_CONCURRENT_CHATS", "0")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "MAX_CONCURRENT_CHATS") {
+		t.Fatalf("expected MAX_CONCURRENT_CHATS validation error, got: %v", err)
+	}
 }
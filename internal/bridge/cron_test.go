@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	t.Parallel()
+
+	// 2026-03-06 is a Friday.
+	from := time.Date(2026, 3, 6, 9, 30, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 6, 9, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2026, 3, 9, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 6, 10, 0, 0, 0, time.UTC)},
+		{"0 12 * jun 7", time.Date(2026, 6, 7, 12, 0, 0, 0, time.UTC)},
+		{"0 8 29 2 *", time.Date(2028, 2, 29, 8, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 15th or any Monday.
+		{"0 0 15 * 1", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{"5,35 10-11 * * *", time.Date(2026, 3, 6, 10, 5, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		sched, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tc.expr, err)
+		}
+		if got := sched.Next(from); !got.Equal(tc.want) {
+			t.Fatalf("Next(%q) = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+
+	never, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.Next(from); !got.IsZero() {
+		t.Fatalf("Feb 30 matched %s", got)
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 9 * * funday"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Fatalf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type queueOverflowPolicy string
+
+const (
+	queueOverflowReject     queueOverflowPolicy = "reject"
+	queueOverflowDropOldest queueOverflowPolicy = "drop_oldest"
+	queueOverflowCoalesce   queueOverflowPolicy = "coalesce"
+)
+
+type queuedMessage struct {
+	Msg        telegramMessage
+	EnqueuedAt time.Time
+}
+
+type runningMessage struct {
+	Msg       telegramMessage
+	StartedAt time.Time
+	cancel    context.CancelCauseFunc
+}
+
+// enqueueOutcome tells the poll loop what happened to a message so it can
+// acknowledge it. Position is the 1-based place among pending messages of the
+// chat, or 0 when the message starts right away.
+type enqueueOutcome struct {
+	Accepted  bool
+	Closed    bool
+	Position  int
+	Coalesced bool
+	Dropped   []queuedMessage
+}
+
+// chatDispatcher keeps messages of one chat strictly ordered while letting
+// different chats run in parallel, bounded by a global concurrency cap.
+type chatDispatcher struct {
+	handle     func(ctx context.Context, msg telegramMessage)
+	sem        chan struct{}
+	maxPending int
+	policy     queueOverflowPolicy
+
+	mu      sync.Mutex
+	closed  bool
+	queues  map[int64][]queuedMessage
+	active  map[int64]bool
+	running map[int64]*runningMessage
+	wg      sync.WaitGroup
+}
+
+func newChatDispatcher(maxConcurrent int, maxPending int, policy queueOverflowPolicy, handle func(ctx context.Context, msg telegramMessage)) *chatDispatcher {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	if policy == "" {
+		policy = queueOverflowReject
+	}
+	return &chatDispatcher{
+		handle:     handle,
+		sem:        make(chan struct{}, maxConcurrent),
+		maxPending: maxPending,
+		policy:     policy,
+		queues:     map[int64][]queuedMessage{},
+		active:     map[int64]bool{},
+		running:    map[int64]*runningMessage{},
+	}
+}
+
+func (d *chatDispatcher) Enqueue(msg telegramMessage) enqueueOutcome {
+	chatID := msg.Chat.ID
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return enqueueOutcome{Closed: true}
+	}
+	queue := d.queues[chatID]
+	out := enqueueOutcome{Accepted: true}
+
+	if d.maxPending > 0 && len(queue) >= d.maxPending {
+		switch d.policy {
+		case queueOverflowDropOldest:
+			out.Dropped = append(out.Dropped, queue[0])
+			queue = queue[1:]
+		case queueOverflowCoalesce:
+			if last := &queue[len(queue)-1]; canCoalesce(last.Msg, msg) {
+				last.Msg.Text = strings.TrimSpace(normalizeMessageText(last.Msg)) + "\n\n" + strings.TrimSpace(normalizeMessageText(msg))
+				last.Msg.Caption = ""
+				d.mu.Unlock()
+				return enqueueOutcome{Accepted: true, Coalesced: true, Position: len(queue)}
+			}
+			d.mu.Unlock()
+			return enqueueOutcome{}
+		default:
+			d.mu.Unlock()
+			return enqueueOutcome{}
+		}
+	}
+
+	queue = append(queue, queuedMessage{Msg: msg, EnqueuedAt: time.Now()})
+	d.queues[chatID] = queue
+	if d.active[chatID] {
+		out.Position = len(queue)
+		d.mu.Unlock()
+		return out
+	}
+	d.active[chatID] = true
+	if len(d.sem) == cap(d.sem) {
+		// Every worker is busy with other chats; the message waits for a slot.
+		out.Position = 1
+	}
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go d.drain(chatID)
+	return out
+}
+
+func canCoalesce(queued telegramMessage, incoming telegramMessage) bool {
+	for _, m := range []telegramMessage{queued, incoming} {
+		if extractMediaInput(m) != nil || extractImageInput(m) != nil {
+			return false
+		}
+		if strings.TrimSpace(normalizeMessageText(m)) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *chatDispatcher) drain(chatID int64) {
+	defer d.wg.Done()
+	for {
+		d.sem <- struct{}{}
+		d.mu.Lock()
+		queue := d.queues[chatID]
+		if len(queue) == 0 {
+			delete(d.queues, chatID)
+			delete(d.active, chatID)
+			d.mu.Unlock()
+			<-d.sem
+			return
+		}
+		next := queue[0]
+		d.queues[chatID] = queue[1:]
+		d.mu.Unlock()
+
+		d.run(chatID, next.Msg)
+		<-d.sem
+	}
+}
+
+func (d *chatDispatcher) run(chatID int64, msg telegramMessage) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	d.mu.Lock()
+	d.running[chatID] = &runningMessage{Msg: msg, StartedAt: time.Now(), cancel: cancel}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.running, chatID)
+		d.mu.Unlock()
+	}()
+
+	d.handle(ctx, msg)
+}
+
+// Cancel aborts the message currently being handled for chatID. It reports
+// false when the chat has nothing in flight.
+func (d *chatDispatcher) Cancel(chatID int64) bool {
+	d.mu.Lock()
+	r, ok := d.running[chatID]
+	d.mu.Unlock()
+	if !ok {
+		return false
+	}
+	r.cancel(errRunCancelled)
+	return true
+}
+
+// Snapshot returns the running message (if any) and a copy of the pending
+// messages of chatID.
+func (d *chatDispatcher) Snapshot(chatID int64) (*runningMessage, []queuedMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var running *runningMessage
+	if r, ok := d.running[chatID]; ok {
+		copied := *r
+		running = &copied
+	}
+	pending := append([]queuedMessage(nil), d.queues[chatID]...)
+	return running, pending
+}
+
+// PendingCounts returns the number of pending messages per chat.
+func (d *chatDispatcher) PendingCounts() map[int64]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[int64]int, len(d.queues))
+	for chatID, q := range d.queues {
+		if len(q) > 0 {
+			out[chatID] = len(q)
+		}
+	}
+	return out
+}
+
+// Remove drops the pending message at the 1-based position of chatID.
+func (d *chatDispatcher) Remove(chatID int64, position int) (queuedMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queue := d.queues[chatID]
+	if position < 1 || position > len(queue) {
+		return queuedMessage{}, false
+	}
+	removed := queue[position-1]
+	d.queues[chatID] = append(queue[:position-1:position-1], queue[position:]...)
+	return removed, true
+}
+
+// Clear drops every pending message of chatID and returns how many were removed.
+func (d *chatDispatcher) Clear(chatID int64) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.queues[chatID])
+	d.queues[chatID] = nil
+	return n
+}
+
+// Wait blocks until every queued message has been handled.
+func (d *chatDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Shutdown stops accepting messages, drops everything that has not started
+// yet and waits up to timeout for in-flight runs. Runs still going after the
+// deadline are cancelled with errBridgeShutdown so their handlers can report
+// the interruption. The dropped messages are returned for notification.
+func (d *chatDispatcher) Shutdown(timeout time.Duration) []queuedMessage {
+	d.mu.Lock()
+	d.closed = true
+	var dropped []queuedMessage
+	for chatID, q := range d.queues {
+		dropped = append(dropped, q...)
+		d.queues[chatID] = nil
+	}
+	d.mu.Unlock()
+
+	if d.waitTimeout(timeout) {
+		return dropped
+	}
+
+	d.mu.Lock()
+	for chatID, r := range d.running {
+		log.Printf("shutdown: cancelling in-flight run chat_id=%d running_for=%s", chatID, time.Since(r.StartedAt).Truncate(time.Second))
+		r.cancel(errBridgeShutdown)
+	}
+	d.mu.Unlock()
+	if !d.waitTimeout(10 * time.Second) {
+		log.Printf("shutdown: handlers still running after cancellation; giving up")
+	}
+	return dropped
+}
+
+func (d *chatDispatcher) waitTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChatDispatcherKeepsPerChatOrder(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	seen := map[int64][]int64{}
+	d := newChatDispatcher(4, 0, queueOverflowReject, func(ctx context.Context, msg telegramMessage) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		seen[msg.Chat.ID] = append(seen[msg.Chat.ID], msg.MessageID)
+		mu.Unlock()
+	})
+
+	for i := int64(1); i <= 20; i++ {
+		d.Enqueue(telegramMessage{MessageID: i, Chat: telegramChat{ID: i % 3}})
+	}
+	d.Wait()
+
+	for chatID, ids := range seen {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("chat %d handled out of order: %v", chatID, ids)
+			}
+		}
+	}
+}
+
+func TestChatDispatcherRunsChatsInParallel(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	d := newChatDispatcher(2, 0, queueOverflowReject, func(ctx context.Context, msg telegramMessage) {
+		if msg.Chat.ID == 1 {
+			<-release
+			return
+		}
+		close(fastDone)
+	})
+
+	d.Enqueue(telegramMessage{Chat: telegramChat{ID: 1}})
+	d.Enqueue(telegramMessage{Chat: telegramChat{ID: 2}})
+
+	select {
+	case <-fastDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("chat 2 was blocked behind chat 1")
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestChatDispatcherRespectsConcurrencyCap(t *testing.T) {
+	t.Parallel()
+
+	var running, peak int32
+	d := newChatDispatcher(2, 0, queueOverflowReject, func(ctx context.Context, msg telegramMessage) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i := int64(0); i < 8; i++ {
+		d.Enqueue(telegramMessage{Chat: telegramChat{ID: i}})
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Fatalf("peak concurrency=%d, want <= 2", peak)
+	}
+}
+
+func TestChatDispatcherCancel(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	d := newChatDispatcher(1, 0, queueOverflowReject, func(ctx context.Context, msg telegramMessage) {
+		close(started)
+		<-ctx.Done()
+		result <- ctx.Err()
+	})
+
+	if d.Cancel(7) {
+		t.Fatal("expected Cancel to report false for idle chat")
+	}
+	d.Enqueue(telegramMessage{Chat: telegramChat{ID: 7}})
+	<-started
+	if !d.Cancel(7) {
+		t.Fatal("expected Cancel to report true for running chat")
+	}
+	d.Wait()
+	if err := <-result; err != context.Canceled {
+		t.Fatalf("handler ctx err=%v", err)
+	}
+}
+
+func newBlockedDispatcher(t *testing.T, maxPending int, policy queueOverflowPolicy) (*chatDispatcher, chan struct{}) {
+	t.Helper()
+	started := make(chan struct{}, 16)
+	release := make(chan struct{})
+	d := newChatDispatcher(1, maxPending, policy, func(ctx context.Context, msg telegramMessage) {
+		started <- struct{}{}
+		<-release
+	})
+	d.Enqueue(telegramMessage{MessageID: 1, Chat: telegramChat{ID: 5}, Text: "first"})
+	<-started
+	return d, release
+}
+
+func TestChatDispatcherOverflowReject(t *testing.T) {
+	t.Parallel()
+	d, release := newBlockedDispatcher(t, 2, queueOverflowReject)
+
+	for i, want := range []int{1, 2} {
+		out := d.Enqueue(telegramMessage{MessageID: int64(i + 2), Chat: telegramChat{ID: 5}, Text: "next"})
+		if !out.Accepted || out.Position != want {
+			t.Fatalf("enqueue %d: %+v", i, out)
+		}
+	}
+	if out := d.Enqueue(telegramMessage{MessageID: 9, Chat: telegramChat{ID: 5}, Text: "overflow"}); out.Accepted {
+		t.Fatalf("expected rejection, got %+v", out)
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestChatDispatcherOverflowDropOldest(t *testing.T) {
+	t.Parallel()
+	d, release := newBlockedDispatcher(t, 1, queueOverflowDropOldest)
+
+	d.Enqueue(telegramMessage{MessageID: 2, Chat: telegramChat{ID: 5}, Text: "old"})
+	out := d.Enqueue(telegramMessage{MessageID: 3, Chat: telegramChat{ID: 5}, Text: "new"})
+	if !out.Accepted || len(out.Dropped) != 1 || out.Dropped[0].Msg.MessageID != 2 {
+		t.Fatalf("unexpected outcome: %+v", out)
+	}
+	_, pending := d.Snapshot(5)
+	if len(pending) != 1 || pending[0].Msg.MessageID != 3 {
+		t.Fatalf("unexpected pending: %+v", pending)
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestChatDispatcherOverflowCoalesce(t *testing.T) {
+	t.Parallel()
+	d, release := newBlockedDispatcher(t, 1, queueOverflowCoalesce)
+
+	d.Enqueue(telegramMessage{MessageID: 2, Chat: telegramChat{ID: 5}, Text: "part one"})
+	out := d.Enqueue(telegramMessage{MessageID: 3, Chat: telegramChat{ID: 5}, Text: "part two"})
+	if !out.Accepted || !out.Coalesced {
+		t.Fatalf("unexpected outcome: %+v", out)
+	}
+	_, pending := d.Snapshot(5)
+	if len(pending) != 1 || pending[0].Msg.Text != "part one\n\npart two" {
+		t.Fatalf("unexpected pending: %+v", pending)
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestChatDispatcherRemoveAndClear(t *testing.T) {
+	t.Parallel()
+	d, release := newBlockedDispatcher(t, 0, queueOverflowReject)
+
+	for i := int64(2); i <= 4; i++ {
+		d.Enqueue(telegramMessage{MessageID: i, Chat: telegramChat{ID: 5}, Text: "x"})
+	}
+	if removed, ok := d.Remove(5, 2); !ok || removed.Msg.MessageID != 3 {
+		t.Fatalf("Remove returned %+v ok=%v", removed, ok)
+	}
+	if _, ok := d.Remove(5, 9); ok {
+		t.Fatal("expected out-of-range Remove to fail")
+	}
+	if n := d.Clear(5); n != 2 {
+		t.Fatalf("Clear removed %d, want 2", n)
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestChatDispatcherShutdownDropsPendingAndCancelsInFlight(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	cause := make(chan error, 1)
+	d := newChatDispatcher(1, 0, queueOverflowReject, func(ctx context.Context, msg telegramMessage) {
+		started <- struct{}{}
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+	})
+
+	d.Enqueue(telegramMessage{MessageID: 1, Chat: telegramChat{ID: 3}, Text: "running"})
+	<-started
+	d.Enqueue(telegramMessage{MessageID: 2, Chat: telegramChat{ID: 3}, Text: "pending"})
+
+	dropped := d.Shutdown(50 * time.Millisecond)
+	if len(dropped) != 1 || dropped[0].Msg.MessageID != 2 {
+		t.Fatalf("unexpected dropped messages: %+v", dropped)
+	}
+	if err := <-cause; err != errBridgeShutdown {
+		t.Fatalf("in-flight cause=%v, want errBridgeShutdown", err)
+	}
+	if out := d.Enqueue(telegramMessage{Chat: telegramChat{ID: 3}, Text: "late"}); !out.Closed {
+		t.Fatalf("expected closed dispatcher to refuse messages, got %+v", out)
+	}
+}
@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Structured output handling for the generic runner. AGENT_SESSION_REGEX and
+// AGENT_SESSION_JSON_PATH pull the agent's own session ID out of its output;
+// AGENT_REPLY_JSON_PATH pulls out the reply. JSON paths are dot separated
+// ("result.session.id", "messages.-1.text"); output may be one JSON document or
+// JSON lines, in which case the last line containing the path wins.
+
+func genericSessionExtractionEnabled(cfg bridgeConfig) bool {
+	return strings.TrimSpace(cfg.AgentSessionRegex) != "" || strings.TrimSpace(cfg.AgentSessionJSONPath) != ""
+}
+
+func validateGenericOutputConfig(cfg bridgeConfig) error {
+	if cfg.AgentSessionRegex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(cfg.AgentSessionRegex)
+	if err != nil {
+		return fmt.Errorf("invalid AGENT_SESSION_REGEX: %w", err)
+	}
+	if re.NumSubexp() > 1 {
+		return fmt.Errorf("AGENT_SESSION_REGEX must have at most one capture group")
+	}
+	return nil
+}
+
+func extractGenericSessionID(cfg bridgeConfig, output string) string {
+	if path := strings.TrimSpace(cfg.AgentSessionJSONPath); path != "" {
+		if v, ok := lookupJSONOutput(output, path); ok && v != "" {
+			return v
+		}
+	}
+	if expr := strings.TrimSpace(cfg.AgentSessionRegex); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return ""
+		}
+		m := re.FindStringSubmatch(output)
+		switch {
+		case len(m) > 1:
+			return strings.TrimSpace(m[1])
+		case len(m) == 1:
+			return strings.TrimSpace(m[0])
+		}
+	}
+	return ""
+}
+
+func extractGenericReply(cfg bridgeConfig, output string) string {
+	if path := strings.TrimSpace(cfg.AgentReplyJSONPath); path != "" {
+		if v, ok := lookupJSONOutput(output, path); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return strings.TrimSpace(output)
+}
+
+func lookupJSONOutput(output string, path string) (string, bool) {
+	var doc any
+	if err := unmarshalJSONNumbers(strings.TrimSpace(output), &doc); err == nil {
+		return lookupJSONPath(doc, path)
+	}
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") && !strings.HasPrefix(line, "[") {
+			continue
+		}
+		var doc any
+		if err := unmarshalJSONNumbers(line, &doc); err != nil {
+			continue
+		}
+		if v, ok := lookupJSONPath(doc, path); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// unmarshalJSONNumbers is json.Unmarshal with numbers kept as json.Number, so
+// a numeric session ID such as 1234567 or one beyond 2^53 comes back exactly
+// as the agent printed it.
+func unmarshalJSONNumbers(data string, v any) error {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+func lookupJSONPath(doc any, path string) (string, bool) {
+	cur := doc
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return "", false
+			}
+			if idx < 0 {
+				idx += len(node)
+			}
+			if idx < 0 || idx >= len(node) {
+				return "", false
+			}
+			cur = node[idx]
+		default:
+			return "", false
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", false
+	case json.Number:
+		return v.String(), true
+	case float64, bool:
+		return fmt.Sprint(v), true
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+}
@@ -1,6 +1,7 @@
 package bridge
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
@@ -27,35 +28,64 @@ func Run() {
 		_ = lockFile.Close()
 	}()
 
-	log.Printf("starting telegram-codex bridge. workdir=%q provider=%q agent_bin=%q codex=%q", cfg.CodexWorkdir, cfg.AgentProvider, cfg.AgentBin, cfg.CodexBin)
-	startParentWatchdog(cfg)
-	chatQueue := make(chan telegramMessage, 128)
-
-	go func() {
-		for msg := range chatQueue {
-			handleMessage(cfg, msg)
-		}
-	}()
+	log.Printf("starting telegram-codex bridge. workdir=%q provider=%q providers=%q agent_bin=%q codex=%q max_concurrent_chats=%d", cfg.CodexWorkdir, cfg.AgentProvider, cfg.AgentProviders, cfg.AgentBin, cfg.CodexBin, cfg.MaxConcurrentChats)
+	ctx, requestShutdown := context.WithCancel(context.Background())
+	defer requestShutdown()
+	watchShutdownSignals(requestShutdown)
+	startParentWatchdog(cfg, requestShutdown)
+	dispatcher := newChatDispatcher(cfg.MaxConcurrentChats, cfg.QueueMaxPending, cfg.QueueOverflowPolicy, func(ctx context.Context, msg telegramMessage) {
+		handleMessage(ctx, cfg, msg)
+	})
+	control := newControlLane(64)
+	go control.Run()
+	sched := startScheduler(cfg)
+	markInterruptedBackgroundJobs(cfg)
+
+	offset := pollUpdates(ctx, cfg, dispatcher, control)
+	shutdownBridge(cfg, dispatcher, control, sched, offset)
+}
 
+// pollUpdates long-polls Telegram until ctx is cancelled and returns the
+// offset of the first update that has not been handed out yet.
+func pollUpdates(ctx context.Context, cfg bridgeConfig, dispatcher *chatDispatcher, control *controlLane) int64 {
 	var offset int64
-	for {
-		updates, err := getUpdates(cfg, offset)
+	for ctx.Err() == nil {
+		updates, err := getUpdates(ctx, cfg, offset, 50)
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			if !isTelegramPollNoisyError(err) {
 				log.Printf("getUpdates failed: %v", err)
 			}
-			time.Sleep(3 * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
 			continue
 		}
 
 		for _, upd := range updates {
 			offset = upd.UpdateID + 1
+			if upd.CallbackQuery != nil {
+				cq := *upd.CallbackQuery
+				control.Submit(func() { handleCallbackQuery(cfg, dispatcher, cq) })
+				continue
+			}
 			if upd.Message == nil {
 				continue
 			}
-			chatQueue <- *upd.Message
+			msg := *upd.Message
+			if classifyUpdateLane(cfg, msg) == laneControl {
+				control.Submit(func() { handleControlMessage(cfg, dispatcher, msg) })
+				continue
+			}
+			if out := dispatcher.Enqueue(msg); !out.Accepted || out.Coalesced || out.Position > 0 || len(out.Dropped) > 0 {
+				control.Submit(func() { acknowledgeEnqueue(cfg, msg, out) })
+			}
 		}
 	}
+	return offset
 }
 
 func isTelegramPollNoisyError(err error) bool {
@@ -66,7 +96,7 @@ func isTelegramPollNoisyError(err error) bool {
 	return strings.HasSuffix(msg, ": eof") || strings.Contains(msg, " unexpected eof")
 }
 
-func startParentWatchdog(cfg bridgeConfig) {
+func startParentWatchdog(cfg bridgeConfig, onParentGone func()) {
 	if cfg.ParentPID <= 1 {
 		return
 	}
@@ -79,8 +109,9 @@ func startParentWatchdog(cfg bridgeConfig) {
 			if ppid == expected {
 				continue
 			}
-			log.Printf("parent watchdog: expected ppid=%d, got=%d; exiting bridge core", expected, ppid)
-			os.Exit(0)
+			log.Printf("parent watchdog: expected ppid=%d, got=%d; shutting down bridge core", expected, ppid)
+			onParentGone()
+			return
 		}
 	}()
 }
@@ -112,7 +143,7 @@ func singleInstanceLockPath(cfg bridgeConfig) string {
 	return filepath.Join(os.TempDir(), name)
 }
 
-func handleMessage(cfg bridgeConfig, msg telegramMessage) {
+func handleMessage(ctx context.Context, cfg bridgeConfig, msg telegramMessage) {
 	if msg.From == nil {
 		return
 	}
@@ -125,7 +156,7 @@ func handleMessage(cfg bridgeConfig, msg telegramMessage) {
 
 	text := normalizeMessageText(msg)
 
-	if processIncomingMedia(cfg, msg) {
+	if processIncomingMedia(ctx, cfg, msg) {
 		return
 	}
 
@@ -136,6 +167,14 @@ func handleMessage(cfg bridgeConfig, msg telegramMessage) {
 		return
 	}
 
+	if carry, ok := parseNewSessionCommand(cfg, text); ok {
+		if carry {
+			handleCarryNewSession(ctx, cfg, msg)
+		} else {
+			handleExactCommand(cfg, msg, commandNewSession)
+		}
+		return
+	}
 	if handleExactCommand(cfg, msg, classifyTextCommand(text)) {
 		return
 	}
@@ -143,5 +182,5 @@ func handleMessage(cfg bridgeConfig, msg telegramMessage) {
 		return
 	}
 
-	handleDefaultText(cfg, msg, text)
+	handleDefaultText(ctx, cfg, msg, text)
 }
@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-func runAgentWithMedia(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+func runAgentWithMedia(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
 	_ = msg
 	localPath, err := downloadTelegramFile(cfg, media.FileID, media.OriginalName)
 	if err != nil {
@@ -26,8 +26,11 @@ func runAgentWithMedia(cfg bridgeConfig, chatID int64, msg telegramMessage, medi
 
 	if media.Kind == "语音" || media.Kind == "音频" {
 		defer os.Remove(localPath)
-		transcript, err := transcribeWithFasterWhisper(cfg, localPath)
+		transcript, err := transcribeWithFasterWhisper(ctx, cfg, localPath)
 		if err != nil {
+			if errors.Is(err, errRunCancelled) {
+				return mediaProcessResult{}, err
+			}
 			return mediaProcessResult{}, fmt.Errorf("语音转写失败: %w", err)
 		}
 		userInstruction := strings.TrimSpace(media.UserHint)
@@ -40,9 +43,9 @@ func runAgentWithMedia(cfg bridgeConfig, chatID int64, msg telegramMessage, medi
 			userText = fmt.Sprintf("%s\n%s", userText, userInstruction)
 		}
 
-		out, _, err := runAgent(cfg, chatID, prompt, nil)
+		out, _, err := runAgent(ctx, cfg, chatID, prompt, nil)
 		if err != nil {
-			return mediaProcessResult{}, err
+			return mediaProcessResult{Output: out, UserText: strings.TrimSpace(userText)}, err
 		}
 		return mediaProcessResult{Output: out, UserText: strings.TrimSpace(userText)}, nil
 	}
@@ -61,14 +64,14 @@ func runAgentWithMedia(cfg bridgeConfig, chatID int64, msg telegramMessage, medi
 		userInstruction,
 	)
 
-	out, _, err := runAgent(cfg, chatID, prompt, nil)
+	out, _, err := runAgent(ctx, cfg, chatID, prompt, nil)
 	if err != nil {
-		return mediaProcessResult{}, err
+		return mediaProcessResult{Output: out}, err
 	}
 	return mediaProcessResult{Output: out}, nil
 }
 
-func transcribeWithFasterWhisper(cfg bridgeConfig, audioPath string) (string, error) {
+func transcribeWithFasterWhisper(parent context.Context, cfg bridgeConfig, audioPath string) (string, error) {
 	pythonPath, err := resolvePythonBinary(cfg.WhisperPythonBin)
 	if err != nil {
 		return "", fmt.Errorf("python not available (%s): %w", cfg.WhisperPythonBin, err)
@@ -92,15 +95,20 @@ func transcribeWithFasterWhisper(cfg bridgeConfig, audioPath string) (string, er
 		"--language", cfg.WhisperLanguage,
 		"--compute-type", cfg.WhisperCompute,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSec)*time.Second)
+	ctx, cancel := context.WithTimeout(parent, time.Duration(cfg.TimeoutSec)*time.Second)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, pythonPath, args...)
 	cmd.Dir = cfg.CodexWorkdir
+	releaseGroup := startInProcessGroup(cmd, killGrace(cfg))
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err = cmd.Run()
+	releaseGroup()
+	if isRunCancelled(parent) {
+		return "", errRunCancelled
+	}
 	if ctx.Err() == context.DeadlineExceeded {
 		return "", fmt.Errorf("faster-whisper timeout after %d seconds", cfg.TimeoutSec)
 	}
@@ -158,7 +166,7 @@ func isExecutableFile(path string) bool {
 	return info.Mode()&0o111 != 0
 }
 
-func runAgentWithImage(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+func runAgentWithImage(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
 	localPath, err := downloadTelegramFileToDir(cfg, image.FileID, "", cfg.ImageDir)
 	if err != nil {
 		return mediaProcessResult{}, fmt.Errorf("failed to download image: %w", err)
@@ -168,9 +176,9 @@ func runAgentWithImage(cfg bridgeConfig, chatID int64, image imageInput) (mediaP
 		userInstruction = "请描述这张图片并提取关键信息。"
 	}
 	prompt := "用户发送了一张图片，请根据图片内容完成用户需求。\n用户补充: " + userInstruction
-	out, _, err := runAgent(cfg, chatID, prompt, []string{localPath})
+	out, _, err := runAgent(ctx, cfg, chatID, prompt, []string{localPath})
 	if err != nil {
-		return mediaProcessResult{}, err
+		return mediaProcessResult{Output: out, MediaPath: localPath}, err
 	}
 	userText := "[图片]"
 	if strings.TrimSpace(image.UserHint) != "" {
@@ -241,10 +249,11 @@ func captureScreenshot(cfg bridgeConfig) (string, error) {
 
 func handleScreenshotRequest(cfg bridgeConfig, msg telegramMessage) error {
 	path, err := captureScreenshot(cfg)
-	if err != nil {
-		return err
+	if err == nil {
+		err = sendImageWithFallback(cfg, msg.Chat.ID, path, "")
 	}
-	if err := sendImageWithFallback(cfg, msg.Chat.ID, path, ""); err != nil {
+	appendAudit(cfg, auditActor(msg), "screenshot", map[string]string{"path": path}, auditOutcome(err))
+	if err != nil {
 		return err
 	}
 	appendChatLogWithOptions(cfg, msg, "", "screenshot_ok", chatLogOptions{UserText: "", KeepUserText: true, BotMediaPath: path})
@@ -1,6 +1,7 @@
 package bridge
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"testing"
@@ -21,13 +22,14 @@ func TestProcessIncomingMediaCore_PrioritizesMediaOverImage(t *testing.T) {
 	mediaCalled := false
 	imageCalled := false
 	env := processIncomingMediaCore(
+		context.Background(),
 		cfg,
 		msg,
-		func(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
 			mediaCalled = true
 			return mediaProcessResult{Output: "ok media"}, nil
 		},
-		func(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
 			imageCalled = true
 			return mediaProcessResult{Output: "ok image"}, nil
 		},
@@ -59,12 +61,13 @@ func TestProcessIncomingMediaCore_MediaErrorWrapped(t *testing.T) {
 	cfg := bridgeConfig{MaxReplyChars: 3500}
 
 	env := processIncomingMediaCore(
+		context.Background(),
 		cfg,
 		msg,
-		func(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
 			return mediaProcessResult{}, errors.New("boom")
 		},
-		func(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
 			t.Fatal("image handler should not be called")
 			return mediaProcessResult{}, nil
 		},
@@ -94,13 +97,14 @@ func TestProcessIncomingMediaCore_ImageErrorWrapped(t *testing.T) {
 	cfg := bridgeConfig{MaxReplyChars: 3500}
 
 	env := processIncomingMediaCore(
+		context.Background(),
 		cfg,
 		msg,
-		func(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
 			t.Fatal("media handler should not be called")
 			return mediaProcessResult{}, nil
 		},
-		func(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
 			return mediaProcessResult{}, errors.New("bad image")
 		},
 	)
@@ -131,12 +135,13 @@ func TestProcessIncomingMediaCore_PropagatesBotMediaPath(t *testing.T) {
 	cfg := bridgeConfig{MaxReplyChars: 3500}
 
 	env := processIncomingMediaCore(
+		context.Background(),
 		cfg,
 		msg,
-		func(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
 			return mediaProcessResult{Output: "ok", BotMediaPath: "/tmp/shot.png"}, nil
 		},
-		func(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
 			t.Fatal("image handler should not be called")
 			return mediaProcessResult{}, nil
 		},
@@ -149,3 +154,33 @@ func TestProcessIncomingMediaCore_PropagatesBotMediaPath(t *testing.T) {
 		t.Fatalf("unexpected bot media path: %q", env.Opts.BotMediaPath)
 	}
 }
+
+func TestProcessIncomingMediaCore_CancelledKeepsPartialOutput(t *testing.T) {
+	t.Parallel()
+
+	msg := telegramMessage{
+		Chat:  telegramChat{ID: 1},
+		Photo: []telegramPhotoSize{{FileID: "photo-file"}},
+	}
+	cfg := bridgeConfig{MaxReplyChars: 3500}
+
+	env := processIncomingMediaCore(
+		context.Background(),
+		cfg,
+		msg,
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error) {
+			t.Fatal("media handler should not be called")
+			return mediaProcessResult{}, nil
+		},
+		func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error) {
+			return mediaProcessResult{Output: "half done"}, errRunCancelled
+		},
+	)
+
+	if env.Tag != "cancelled" {
+		t.Fatalf("unexpected tag: %q", env.Tag)
+	}
+	if !strings.Contains(env.Resp, "half done") {
+		t.Fatalf("expected partial output in response: %q", env.Resp)
+	}
+}
@@ -1,8 +1,10 @@
 package bridge
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -10,12 +12,40 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+const sessionStoreVersion = 2
+
+// sessionRecord is the v2 session store entry for one provider and chat.
+type sessionRecord struct {
+	SessionID string `json:"session_id"`
+	Provider  string `json:"provider"`
+	ChatID    int64  `json:"chat_id"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	Turns     int    `json:"turns"`
+	Workdir   string `json:"workdir,omitempty"`
+	Model     string `json:"model,omitempty"`
+	// ContextHash is promptContextHash of the context last sent into the
+	// session.
+	ContextHash string `json:"context_hash,omitempty"`
+	// CarrySummary is set on a slot without a session after
+	// /newsession --carry and goes into the next session's first prompt.
+	CarrySummary string `json:"carry_summary,omitempty"`
+}
+
+type sessionStoreData struct {
+	Version  int                      `json:"version"`
+	Sessions map[string]sessionRecord `json:"sessions"`
+}
+
 var (
-	sessionMu      sync.Mutex
-	chatSessions   = map[string]string{}
+	sessionMu      sync.RWMutex
+	chatSessions   = map[string]sessionRecord{}
 	sessionIDRegex = regexp.MustCompile(`session id:\s*([0-9a-fA-F-]{36})`)
+	// memoryMu serializes the read-modify-write updates of MEMORY.md.
+	memoryMu sync.Mutex
 )
 
 func parseRememberCommand(text string) (string, bool) {
@@ -79,7 +109,7 @@ func buildPromptWithMemory(cfg bridgeConfig, userPrompt string, inject bool) str
 }
 
 func readMemoryForPrompt(cfg bridgeConfig) string {
-	raw, err := os.ReadFile(resolveMemoryPath(cfg))
+	raw, err := readStoreFile(cfg, resolveMemoryPath(cfg))
 	if err != nil {
 		return ""
 	}
@@ -122,65 +152,225 @@ func sessionKey(provider string, chatID int64) string {
 }
 
 func getChatSessionID(provider string, chatID int64) string {
-	sessionMu.Lock()
-	defer sessionMu.Unlock()
-	return chatSessions[sessionKey(provider, chatID)]
+	return getRunSessionID(context.Background(), provider, chatID)
+}
+
+func getChatSession(provider string, chatID int64) (sessionRecord, bool) {
+	return getRunSession(context.Background(), provider, chatID)
+}
+
+type sessionScopeKey struct{}
+
+// withSessionScope gives agent runs under ctx a session slot of their own
+// beside the chat's, so e.g. a scheduled job neither resumes nor replaces
+// the session the user is talking to.
+func withSessionScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, sessionScopeKey{}, scope)
+}
+
+// runSessionKey is sessionKey with the scope of ctx, if any, appended.
+func runSessionKey(ctx context.Context, provider string, chatID int64) string {
+	key := sessionKey(provider, chatID)
+	if scope, _ := ctx.Value(sessionScopeKey{}).(string); scope != "" {
+		key += "#" + scope
+	}
+	return key
+}
+
+func isScopedSession(ctx context.Context) bool {
+	scope, _ := ctx.Value(sessionScopeKey{}).(string)
+	return scope != ""
+}
+
+func getRunSessionID(ctx context.Context, provider string, chatID int64) string {
+	rec, _ := getRunSession(ctx, provider, chatID)
+	return rec.SessionID
+}
+
+func getRunSession(ctx context.Context, provider string, chatID int64) (sessionRecord, bool) {
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+	rec, ok := chatSessions[runSessionKey(ctx, provider, chatID)]
+	return rec, ok && rec.SessionID != ""
+}
+
+// bindSessionLocked points the provider's slot of the chat at sid, keeping
+// the record when the session is unchanged.
+func bindSessionLocked(cfg bridgeConfig, key string, provider string, chatID int64, sid string, now string) sessionRecord {
+	rec := chatSessions[key]
+	if rec.SessionID != sid {
+		normalized, _, _ := strings.Cut(sessionKey(provider, chatID), ":")
+		rec = sessionRecord{
+			SessionID: sid,
+			Provider:  normalized,
+			ChatID:    chatID,
+			CreatedAt: now,
+			Workdir:   cfg.CodexWorkdir,
+		}
+	}
+	rec.UpdatedAt = now
+	return rec
 }
 
 func setChatSessionID(cfg bridgeConfig, provider string, chatID int64, sid string) {
 	sessionMu.Lock()
-	chatSessions[sessionKey(provider, chatID)] = sid
-	err := saveSessionsLocked(cfg.SessionStoreFile)
+	key := sessionKey(provider, chatID)
+	chatSessions[key] = bindSessionLocked(cfg, key, provider, chatID, sid, time.Now().Format(time.RFC3339))
+	err := saveSessionsLocked(cfg)
+	sessionMu.Unlock()
+	if err != nil {
+		log.Printf("failed to save session store: %v", err)
+	}
+}
+
+// recordSessionTurn binds sid like setChatSessionID and counts one completed
+// agent turn in it, remembering the context hash the session now knows.
+// started is the slot's record when the run began; when /newsession, /resume
+// or the like replaced it meanwhile, the slot is left alone and false is
+// returned.
+func recordSessionTurn(ctx context.Context, cfg bridgeConfig, provider string, chatID int64, started sessionRecord, sid string, contextHash string) bool {
+	sessionMu.Lock()
+	key := runSessionKey(ctx, provider, chatID)
+	if chatSessions[key] != started {
+		sessionMu.Unlock()
+		log.Printf("[session] slot %s changed during the run; not binding session %q", key, sid)
+		return false
+	}
+	rec := bindSessionLocked(cfg, key, provider, chatID, sid, time.Now().Format(time.RFC3339))
+	rec.Turns++
+	rec.ContextHash = contextHash
+	if m := agentModelName(cfg); m != "" {
+		rec.Model = m
+	}
+	chatSessions[key] = rec
+	err := saveSessionsLocked(cfg)
 	sessionMu.Unlock()
 	if err != nil {
 		log.Printf("failed to save session store: %v", err)
 	}
+	return true
 }
 
 func clearChatSessionID(cfg bridgeConfig, provider string, chatID int64) {
+	clearRunSession(context.Background(), cfg, provider, chatID)
+}
+
+func clearRunSession(ctx context.Context, cfg bridgeConfig, provider string, chatID int64) {
 	sessionMu.Lock()
-	delete(chatSessions, sessionKey(provider, chatID))
-	err := saveSessionsLocked(cfg.SessionStoreFile)
+	delete(chatSessions, runSessionKey(ctx, provider, chatID))
+	err := saveSessionsLocked(cfg)
 	sessionMu.Unlock()
 	if err != nil {
 		log.Printf("failed to save session store: %v", err)
 	}
 }
 
-func loadSessions(path string) error {
+// clearSessionScope forgets every provider's session of a scope, e.g. when
+// the scheduled job that owned it is removed.
+func clearSessionScope(cfg bridgeConfig, scope string) {
+	sessionMu.Lock()
+	for key := range chatSessions {
+		if strings.HasSuffix(key, "#"+scope) {
+			delete(chatSessions, key)
+		}
+	}
+	err := saveSessionsLocked(cfg)
+	sessionMu.Unlock()
+	if err != nil {
+		log.Printf("failed to save session store: %v", err)
+	}
+}
+
+func flushSessions(cfg bridgeConfig) error {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return saveSessionsLocked(cfg)
+}
+
+// loadSessions reads the session store, falling back to the newest readable
+// backup when the file is damaged, and upgrades the v1 flat map format.
+func loadSessions(cfg bridgeConfig) error {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
-	raw, err := os.ReadFile(path)
+	sessions, migrated, err := readSessionStore(cfg, cfg.SessionStoreFile)
+	if err != nil && !os.IsNotExist(err) {
+		for i := 1; i <= cfg.SessionStoreBackups; i++ {
+			backup := storeBackupPath(cfg.SessionStoreFile, i)
+			restored, m, bakErr := readSessionStore(cfg, backup)
+			if bakErr == nil {
+				log.Printf("[session] store %s unreadable (%v); restored from %s", cfg.SessionStoreFile, err, backup)
+				sessions, migrated, err = restored, m, nil
+				break
+			}
+		}
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
-			chatSessions = map[string]string{}
-			return saveSessionsLocked(path)
+			chatSessions = map[string]sessionRecord{}
+			return saveSessionsLocked(cfg)
 		}
 		return err
 	}
+	chatSessions = sessions
+	if migrated {
+		log.Printf("[session] migrated %s to version %d (%d sessions)", cfg.SessionStoreFile, sessionStoreVersion, len(sessions))
+		return saveSessionsLocked(cfg)
+	}
+	return nil
+}
+
+// readSessionStore parses one session store file. migrated reports a v1
+// file, a flat map of "provider:chat_id" to session ID.
+func readSessionStore(cfg bridgeConfig, path string) (map[string]sessionRecord, bool, error) {
+	raw, err := readStoreFile(cfg, path)
+	if err != nil {
+		return nil, false, err
+	}
 	if len(strings.TrimSpace(string(raw))) == 0 {
-		chatSessions = map[string]string{}
-		return nil
+		return map[string]sessionRecord{}, false, nil
 	}
 
-	var parsed map[string]string
-	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return err
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, false, err
 	}
-	if parsed == nil {
-		parsed = map[string]string{}
+	if _, ok := probe["version"]; ok {
+		var data sessionStoreData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, false, err
+		}
+		if data.Version > sessionStoreVersion {
+			return nil, false, fmt.Errorf("session store version %d is newer than supported version %d", data.Version, sessionStoreVersion)
+		}
+		if data.Sessions == nil {
+			data.Sessions = map[string]sessionRecord{}
+		}
+		return data.Sessions, false, nil
 	}
-	chatSessions = parsed
-	return nil
+
+	var flat map[string]string
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		return nil, false, err
+	}
+	sessions := make(map[string]sessionRecord, len(flat))
+	for key, sid := range flat {
+		if strings.TrimSpace(sid) == "" {
+			continue
+		}
+		provider, chat, _ := strings.Cut(key, ":")
+		chatID, _ := strconv.ParseInt(chat, 10, 64)
+		sessions[key] = sessionRecord{SessionID: sid, Provider: provider, ChatID: chatID}
+	}
+	return sessions, true, nil
 }
 
-func saveSessionsLocked(path string) error {
-	data, err := json.MarshalIndent(chatSessions, "", "  ")
+func saveSessionsLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(sessionStoreData{Version: sessionStoreVersion, Sessions: chatSessions}, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	return writeStoreFileWithBackups(cfg, cfg.SessionStoreFile, data, cfg.SessionStoreBackups)
 }
 
 func resolveMemoryPath(cfg bridgeConfig) string {
@@ -191,6 +381,8 @@ func resolveMemoryPath(cfg bridgeConfig) string {
 }
 
 func ensureMemoryFile(cfg bridgeConfig) error {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
 	memoryPath := resolveMemoryPath(cfg)
 	legacyPath := filepath.Join(cfg.CodexWorkdir, "memory.md")
 
@@ -202,7 +394,7 @@ func ensureMemoryFile(cfg bridgeConfig) error {
 			return nil
 		}
 	}
-	return os.WriteFile(memoryPath, []byte(defaultMemoryTemplate()), 0o644)
+	return writeStoreFileAtomic(cfg, memoryPath, []byte(defaultMemoryTemplate()))
 }
 
 func defaultMemoryTemplate() string {
@@ -218,7 +410,7 @@ func defaultMemoryTemplate() string {
 }
 
 func readMemory(cfg bridgeConfig) (string, error) {
-	raw, err := os.ReadFile(resolveMemoryPath(cfg))
+	raw, err := readStoreFile(cfg, resolveMemoryPath(cfg))
 	if err != nil {
 		return "", err
 	}
@@ -231,7 +423,9 @@ func appendMemoryItem(cfg bridgeConfig, item string) error {
 		return errors.New("empty memory item")
 	}
 	path := resolveMemoryPath(cfg)
-	content, err := os.ReadFile(path)
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	content, err := readStoreFile(cfg, path)
 	if err != nil {
 		return err
 	}
@@ -240,9 +434,11 @@ func appendMemoryItem(cfg bridgeConfig, item string) error {
 		text += "\n\n## User Memory Items"
 	}
 	text += "\n- " + item + "\n"
-	return os.WriteFile(path, []byte(text), 0o644)
+	return writeStoreFileAtomic(cfg, path, []byte(text))
 }
 
 func resetMemory(cfg bridgeConfig) error {
-	return os.WriteFile(resolveMemoryPath(cfg), []byte(defaultMemoryTemplate()), 0o644)
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+	return writeStoreFileAtomic(cfg, resolveMemoryPath(cfg), []byte(defaultMemoryTemplate()))
 }
@@ -1,9 +1,12 @@
 package bridge
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -26,19 +29,19 @@ func TestSessionStoreRoundTrip(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "sessions.json")
 
-	chatSessions = map[string]string{}
-	if err := loadSessions(path); err != nil {
+	cfg := bridgeConfig{SessionStoreFile: path}
+	chatSessions = map[string]sessionRecord{}
+	if err := loadSessions(cfg); err != nil {
 		t.Fatalf("loadSessions create failed: %v", err)
 	}
 
-	cfg := bridgeConfig{SessionStoreFile: path}
 	setChatSessionID(cfg, "codex", 42, "sid-42")
 	if got := getChatSessionID("codex", 42); got != "sid-42" {
 		t.Fatalf("session mismatch: %q", got)
 	}
 
-	chatSessions = map[string]string{}
-	if err := loadSessions(path); err != nil {
+	chatSessions = map[string]sessionRecord{}
+	if err := loadSessions(cfg); err != nil {
 		t.Fatalf("loadSessions reload failed: %v", err)
 	}
 	if got := getChatSessionID("codex", 42); got != "sid-42" {
@@ -46,6 +49,90 @@ func TestSessionStoreRoundTrip(t *testing.T) {
 	}
 }
 
+func TestSessionStoreMigratesV1AndKeepsBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sessions.json")
+	if err := os.WriteFile(path, []byte(`{"codex:42":"sid-old","claude:7":"c-1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := bridgeConfig{SessionStoreFile: path, SessionStoreBackups: 2, CodexWorkdir: dir, CodexModel: "m1"}
+	chatSessions = map[string]sessionRecord{}
+	if err := loadSessions(cfg); err != nil {
+		t.Fatalf("loadSessions v1: %v", err)
+	}
+	rec, ok := getChatSession("claude", 7)
+	if !ok || rec.SessionID != "c-1" || rec.Provider != "claude" || rec.ChatID != 7 {
+		t.Fatalf("migrated record = %+v", rec)
+	}
+	raw, _ := os.ReadFile(path)
+	if !strings.Contains(string(raw), `"version": 2`) {
+		t.Fatalf("store not rewritten as v2:\n%s", raw)
+	}
+	if raw, _ := os.ReadFile(storeBackupPath(path, 1)); !strings.Contains(string(raw), `"sid-old"`) || strings.Contains(string(raw), "version") {
+		t.Fatalf("v1 file not kept as backup:\n%s", raw)
+	}
+
+	for i := 0; i < 2; i++ {
+		started, _ := getChatSession("codex", 42)
+		if !recordSessionTurn(context.Background(), cfg, "codex", 42, started, "sid-new", "h1") {
+			t.Fatalf("turn %d not recorded", i)
+		}
+	}
+	rec, _ = getChatSession("codex", 42)
+	if rec.Turns != 2 || rec.Workdir != dir || rec.Model != "m1" || rec.CreatedAt == "" {
+		t.Fatalf("record after turns = %+v", rec)
+	}
+	if _, err := os.Stat(storeBackupPath(path, 3)); !os.IsNotExist(err) {
+		t.Fatalf("more backups than configured: %v", err)
+	}
+
+	// A torn write is recovered from the newest readable backup.
+	if err := os.WriteFile(path, []byte(`{"version": 2, "sess`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	chatSessions = map[string]sessionRecord{}
+	if err := loadSessions(cfg); err != nil {
+		t.Fatalf("loadSessions corrupt: %v", err)
+	}
+	if rec, _ := getChatSession("codex", 42); rec.SessionID != "sid-new" || rec.Turns < 1 {
+		t.Fatalf("restored record = %+v", rec)
+	}
+}
+
+func TestRecordSessionTurnKeepsSlotChangedDuringRun(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := bridgeConfig{SessionStoreFile: filepath.Join(dir, "sessions.json"), CodexWorkdir: dir}
+	ctx := withSessionScope(context.Background(), "cas-test")
+
+	key := runSessionKey(ctx, "codex", 43)
+	sessionMu.Lock()
+	chatSessions[key] = sessionRecord{SessionID: "sid-old", Provider: "codex", ChatID: 43, Turns: 3}
+	sessionMu.Unlock()
+	started, _ := getRunSession(ctx, "codex", 43)
+
+	// /newsession while the run is still going.
+	clearRunSession(ctx, cfg, "codex", 43)
+	if recordSessionTurn(ctx, cfg, "codex", 43, started, "sid-old", "h") {
+		t.Fatal("recordSessionTurn bound a session over a reset slot")
+	}
+	if rec, ok := getRunSession(ctx, "codex", 43); ok {
+		t.Fatalf("reset slot was overwritten: %+v", rec)
+	}
+
+	// /resume while the run is still going.
+	started, _ = getRunSession(ctx, "codex", 43)
+	sessionMu.Lock()
+	chatSessions[key] = sessionRecord{SessionID: "sid-resumed", Provider: "codex", ChatID: 43}
+	sessionMu.Unlock()
+	if recordSessionTurn(ctx, cfg, "codex", 43, started, "sid-run", "h") {
+		t.Fatal("recordSessionTurn bound a session over a resumed one")
+	}
+	if got := getRunSessionID(ctx, "codex", 43); got != "sid-resumed" {
+		t.Fatalf("resumed session replaced by %q", got)
+	}
+}
+
 func TestMemoryAppendAndReset(t *testing.T) {
 	t.Parallel()
 	dir := t.TempDir()
@@ -77,3 +164,33 @@ func TestMemoryAppendAndReset(t *testing.T) {
 		t.Fatalf("reset template invalid: %q", string(raw))
 	}
 }
+
+func TestConcurrentMemoryAppendsKeepEveryItem(t *testing.T) {
+	t.Parallel()
+	cfg := bridgeConfig{CodexWorkdir: t.TempDir(), MemoryFile: "MEMORY.md"}
+	if err := ensureMemoryFile(cfg); err != nil {
+		t.Fatalf("ensureMemoryFile failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := appendMemoryItem(cfg, fmt.Sprintf("item %02d", i)); err != nil {
+				t.Errorf("appendMemoryItem %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mem, err := readMemory(cfg)
+	if err != nil {
+		t.Fatalf("readMemory failed: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if !strings.Contains(mem, fmt.Sprintf("- item %02d", i)) {
+			t.Fatalf("item %02d lost:\n%s", i, mem)
+		}
+	}
+}
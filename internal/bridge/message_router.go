@@ -1,7 +1,10 @@
 package bridge
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -17,16 +20,18 @@ const (
 	commandMemory
 	commandForget
 	commandScreenshot
+	commandCancel
 )
 
-type runMediaFunc func(cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error)
-type runImageFunc func(cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error)
+type runMediaFunc func(ctx context.Context, cfg bridgeConfig, chatID int64, msg telegramMessage, media mediaInput) (mediaProcessResult, error)
+type runImageFunc func(ctx context.Context, cfg bridgeConfig, chatID int64, image imageInput) (mediaProcessResult, error)
 
 type mediaProcessEnvelope struct {
-	Handled bool
-	Resp    string
-	Tag     string
-	Opts    chatLogOptions
+	Handled   bool
+	Resp      string
+	Tag       string
+	Opts      chatLogOptions
+	DetailsID string
 }
 
 func normalizeMessageText(msg telegramMessage) string {
@@ -56,6 +61,8 @@ func classifyTextCommand(text string) textCommand {
 		return commandForget
 	case "/screenshot", "截图":
 		return commandScreenshot
+	case "/cancel":
+		return commandCancel
 	default:
 		return commandNone
 	}
@@ -67,8 +74,17 @@ func handleExactCommand(cfg bridgeConfig, msg telegramMessage, cmd textCommand)
 		help := "Commands:\n" +
 			"/ping - health check\n" +
 			"/cwd - show CODEX_WORKDIR\n" +
-			"/newsession - reset Agent session for this chat\n" +
+			"/newsession - reset Agent session for this chat (--carry keeps a summary)\n" +
 			"/session - show bound Agent session id\n" +
+			"/sessions - list earlier sessions (/resume <n>, /rename [n] <name>)\n" +
+			"/cancel - abort the running agent request\n" +
+			"/queue - list queued messages (/queue rm <n>, /queue clear)\n" +
+			"/provider - list agent providers (/provider <name> to switch)\n" +
+			"/model, /sandbox, /timeout - show or change this chat's agent settings\n" +
+			"/usage [today|week|month] - token usage and cost\n" +
+			"/schedule add \"<cron>\" <prompt> - run a prompt on a schedule (/schedule list, /schedule rm <id>)\n" +
+			"/at <time> <prompt>, /in <duration> <prompt> - run a prompt later, or \"remind me to ...\" (/at list, /at rm <id>)\n" +
+			"/bg <prompt> - run a long prompt as a background job (/jobs, /job <id> [cancel])\n" +
 			"/screenshot - take a local screenshot and send back\n" +
 			"/memory - show persistent memory\n" +
 			"/remember <text> - append memory item\n" +
@@ -91,17 +107,20 @@ func handleExactCommand(cfg bridgeConfig, msg telegramMessage, cmd textCommand)
 		appendChatLog(cfg, msg, reply, "cwd")
 		return true
 	case commandSession:
-		sid := getChatSessionID(cfg.AgentProvider, msg.Chat.ID)
+		provider := chatProvider(cfg, msg.Chat.ID)
+		sid := getChatSessionID(provider, msg.Chat.ID)
 		reply := "session: (none)"
 		if sid != "" {
-			reply = "provider=" + cfg.AgentProvider + " session: " + sid
+			reply = "provider=" + provider + " session: " + sid
 		}
 		_ = sendMessage(cfg, msg.Chat.ID, reply)
 		appendChatLog(cfg, msg, reply, "session")
 		return true
 	case commandNewSession:
-		clearChatSessionID(cfg, cfg.AgentProvider, msg.Chat.ID)
-		reply := "session reset. next message will start a new " + cfg.AgentProvider + " session."
+		provider := chatProvider(cfg, msg.Chat.ID)
+		clearChatSessionID(cfg, provider, msg.Chat.ID)
+		appendAudit(cfg, auditActor(msg), "session_reset", map[string]string{"provider": provider, "chat_id": strconv.FormatInt(msg.Chat.ID, 10)}, "ok")
+		reply := "session reset. next message will start a new " + provider + " session. /sessions lists earlier ones."
 		_ = sendMessage(cfg, msg.Chat.ID, reply)
 		appendChatLog(cfg, msg, reply, "new_session")
 		return true
@@ -118,7 +137,9 @@ func handleExactCommand(cfg bridgeConfig, msg telegramMessage, cmd textCommand)
 		appendChatLog(cfg, msg, reply, "memory_view")
 		return true
 	case commandForget:
-		if err := resetMemory(cfg); err != nil {
+		err := resetMemory(cfg)
+		appendAudit(cfg, auditActor(msg), "memory_reset", nil, auditOutcome(err))
+		if err != nil {
 			reply := "failed to reset memory: " + err.Error()
 			_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
 			appendChatLog(cfg, msg, reply, "memory_error")
@@ -135,6 +156,13 @@ func handleExactCommand(cfg bridgeConfig, msg telegramMessage, cmd textCommand)
 			appendChatLog(cfg, msg, reply, "screenshot_error")
 		}
 		return true
+	case commandCancel:
+		// Cancellation is normally handled on the control lane by
+		// handleControlMessage; this only answers stray calls.
+		reply := "nothing to cancel."
+		_ = sendMessage(cfg, msg.Chat.ID, reply)
+		appendChatLog(cfg, msg, reply, "cancel")
+		return true
 	default:
 		return false
 	}
@@ -145,7 +173,9 @@ func handleRememberCommand(cfg bridgeConfig, msg telegramMessage, text string) b
 	if !ok {
 		return false
 	}
-	if err := appendMemoryItem(cfg, remembered); err != nil {
+	err := appendMemoryItem(cfg, remembered)
+	appendAudit(cfg, auditActor(msg), "memory_append", map[string]string{"item": remembered}, auditOutcome(err))
+	if err != nil {
 		reply := "failed to update memory: " + err.Error()
 		_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
 		appendChatLog(cfg, msg, reply, "memory_error")
@@ -157,8 +187,13 @@ func handleRememberCommand(cfg bridgeConfig, msg telegramMessage, text string) b
 	return true
 }
 
-func processIncomingMedia(cfg bridgeConfig, msg telegramMessage) bool {
-	envelope := processIncomingMediaCore(cfg, msg, runAgentWithMedia, runAgentWithImage)
+func processIncomingMedia(ctx context.Context, cfg bridgeConfig, msg telegramMessage) bool {
+	if extractMediaInput(msg) == nil && extractImageInput(msg) == nil {
+		return false
+	}
+	stopProgress := startRunProgress(cfg, msg.Chat.ID)
+	envelope := processIncomingMediaCore(ctx, cfg, msg, runAgentWithMedia, runAgentWithImage)
+	stopProgress()
 	if !envelope.Handled {
 		return false
 	}
@@ -167,14 +202,33 @@ func processIncomingMedia(cfg bridgeConfig, msg telegramMessage) bool {
 			_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram("发送执行截图失败: "+err.Error(), cfg.MaxReplyChars))
 		}
 	}
-	_ = sendMessage(cfg, msg.Chat.ID, envelope.Resp)
+	sendAgentErrorReply(cfg, msg.Chat.ID, envelope.Resp, envelope.DetailsID)
 	appendChatLogWithOptions(cfg, msg, envelope.Resp, envelope.Tag, envelope.Opts)
 	return true
 }
 
-func processIncomingMediaCore(cfg bridgeConfig, msg telegramMessage, runMedia runMediaFunc, runImage runImageFunc) mediaProcessEnvelope {
+func processIncomingMediaCore(ctx context.Context, cfg bridgeConfig, msg telegramMessage, runMedia runMediaFunc, runImage runImageFunc) mediaProcessEnvelope {
 	if media := extractMediaInput(msg); media != nil {
-		mediaRes, err := runMedia(cfg, msg.Chat.ID, msg, *media)
+		mediaRes, err := runMedia(ctx, cfg, msg.Chat.ID, msg, *media)
+		if errors.Is(err, errRunCancelled) {
+			resp, tag := cancelledResponse(ctx, cfg, mediaRes.Output)
+			return mediaProcessEnvelope{
+				Handled: true,
+				Resp:    resp,
+				Tag:     tag,
+				Opts:    chatLogOptions{UserText: mediaRes.UserText},
+			}
+		}
+		if isAgentError(err) {
+			resp, detailsID := agentErrorReply(cfg, err, mediaRes.Output)
+			return mediaProcessEnvelope{
+				Handled:   true,
+				Resp:      resp,
+				Tag:       "media_error",
+				Opts:      chatLogOptions{UserText: mediaRes.UserText},
+				DetailsID: detailsID,
+			}
+		}
 		if err != nil {
 			resp := fmt.Sprintf("media process error:\n%s", trimForTelegram(err.Error(), cfg.MaxReplyChars))
 			return mediaProcessEnvelope{
@@ -200,7 +254,26 @@ func processIncomingMediaCore(cfg bridgeConfig, msg telegramMessage, runMedia ru
 		}
 	}
 	if image := extractImageInput(msg); image != nil {
-		imgRes, err := runImage(cfg, msg.Chat.ID, *image)
+		imgRes, err := runImage(ctx, cfg, msg.Chat.ID, *image)
+		if errors.Is(err, errRunCancelled) {
+			resp, tag := cancelledResponse(ctx, cfg, imgRes.Output)
+			return mediaProcessEnvelope{
+				Handled: true,
+				Resp:    resp,
+				Tag:     tag,
+				Opts:    chatLogOptions{MediaPath: imgRes.MediaPath},
+			}
+		}
+		if isAgentError(err) {
+			resp, detailsID := agentErrorReply(cfg, err, imgRes.Output)
+			return mediaProcessEnvelope{
+				Handled:   true,
+				Resp:      resp,
+				Tag:       "image_error",
+				Opts:      chatLogOptions{MediaPath: imgRes.MediaPath},
+				DetailsID: detailsID,
+			}
+		}
 		if err != nil {
 			resp := fmt.Sprintf("image process error:\n%s", trimForTelegram(err.Error(), cfg.MaxReplyChars))
 			return mediaProcessEnvelope{
@@ -229,7 +302,7 @@ func processIncomingMediaCore(cfg bridgeConfig, msg telegramMessage, runMedia ru
 	return mediaProcessEnvelope{}
 }
 
-func handleDefaultText(cfg bridgeConfig, msg telegramMessage, text string) {
+func handleDefaultText(ctx context.Context, cfg bridgeConfig, msg telegramMessage, text string) {
 	if isScreenshotRequest(text) {
 		if err := handleScreenshotRequest(cfg, msg); err != nil {
 			reply := "screenshot failed: " + err.Error()
@@ -239,7 +312,21 @@ func handleDefaultText(cfg bridgeConfig, msg telegramMessage, text string) {
 		return
 	}
 
-	out, _, agentErr := runAgent(cfg, msg.Chat.ID, text, nil)
+	stopProgress := startRunProgress(cfg, msg.Chat.ID)
+	out, _, agentErr := runAgent(ctx, cfg, msg.Chat.ID, text, nil)
+	stopProgress()
+	if errors.Is(agentErr, errRunCancelled) {
+		resp, tag := cancelledResponse(ctx, cfg, out)
+		_ = sendMessage(cfg, msg.Chat.ID, resp)
+		appendChatLog(cfg, msg, resp, tag)
+		return
+	}
+	if isAgentError(agentErr) {
+		resp, detailsID := agentErrorReply(cfg, agentErr, out)
+		sendAgentErrorReply(cfg, msg.Chat.ID, resp, detailsID)
+		appendChatLog(cfg, msg, resp, "agent_error")
+		return
+	}
 	if agentErr != nil {
 		resp := fmt.Sprintf("agent error:\n%s", trimForTelegram(agentErr.Error(), cfg.MaxReplyChars))
 		_ = sendMessage(cfg, msg.Chat.ID, resp)
@@ -53,3 +53,26 @@ func TestClassifyTextCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestParseQueueCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  queueCommand
+		ok    bool
+	}{
+		{"/queue", queueCommand{Action: "list"}, true},
+		{"/queue rm 2", queueCommand{Action: "rm", Position: 2}, true},
+		{"/queue clear", queueCommand{Action: "clear"}, true},
+		{"/queue rm x", queueCommand{Action: "usage"}, true},
+		{"/queued", queueCommand{}, false},
+		{"hello", queueCommand{}, false},
+	}
+	for _, tc := range tests {
+		got, ok := parseQueueCommand(tc.input)
+		if ok != tc.ok || got != tc.want {
+			t.Fatalf("parseQueueCommand(%q)=%+v,%v want %+v,%v", tc.input, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// openAIRunner talks to any server implementing /v1/chat/completions
+// (llama.cpp server, Ollama, vLLM, ...). Those servers are stateless, so the
+// bridge keeps the conversation itself: one history file per session ID,
+// where the session ID is what the session store maps the chat to.
+type openAIRunner struct{}
+
+func (o openAIRunner) Name() string         { return "openai" }
+func (o openAIRunner) SupportsImages() bool { return true }
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// openAIHistoryMessage is what gets persisted. Images are kept as a short text
+// note so history files stay small and old turns never resend image bytes.
+type openAIHistoryMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIHistory struct {
+	Messages []openAIHistoryMessage `json:"messages"`
+}
+
+type openAIUsage struct {
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var openAISessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func newOpenAISessionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "oai-" + hex.EncodeToString(b), nil
+}
+
+func openAIHistoryPath(cfg bridgeConfig, sessionID string) (string, error) {
+	if !openAISessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	return filepath.Join(cfg.OpenAIHistoryDir, sessionID+".json"), nil
+}
+
+func loadOpenAIHistory(cfg bridgeConfig, sessionID string) (openAIHistory, error) {
+	h := openAIHistory{}
+	path, err := openAIHistoryPath(cfg, sessionID)
+	if err != nil {
+		return h, err
+	}
+	raw, err := readStoreFile(cfg, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return h, err
+	}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return h, fmt.Errorf("corrupt history %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// deleteOpenAIHistory removes the stored history of a session that will not
+// be resumed.
+func deleteOpenAIHistory(cfg bridgeConfig, sessionID string) {
+	path, err := openAIHistoryPath(cfg, sessionID)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("[openai] failed to remove history session=%q: %v", sessionID, err)
+	}
+}
+
+func saveOpenAIHistory(cfg bridgeConfig, sessionID string, h openAIHistory) error {
+	path, err := openAIHistoryPath(cfg, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, path, b)
+}
+
+// estimateTokens is a rough count (about four characters per token) that is
+// good enough to keep requests inside a context window without a tokenizer.
+func estimateTokens(s string) int {
+	return len([]rune(s))/4 + 4
+}
+
+// trimOpenAIHistory drops the oldest messages until the history fits budget
+// tokens. The history never starts with an assistant reply, and a budget at
+// or below zero (the new prompt alone fills it) leaves no history at all.
+func trimOpenAIHistory(messages []openAIHistoryMessage, budget int) []openAIHistoryMessage {
+	if budget <= 0 {
+		return nil
+	}
+	total := 0
+	start := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += estimateTokens(messages[i].Content)
+		if total > budget {
+			break
+		}
+		start = i
+	}
+	for start < len(messages) && messages[start].Role != "user" {
+		start++
+	}
+	return messages[start:]
+}
+
+func openAIImagePart(path string) (openAIContentPart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return openAIContentPart{}, err
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		mime = "image/jpeg"
+	}
+	return openAIContentPart{
+		Type:     "image_url",
+		ImageURL: &openAIImageURL{URL: "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)},
+	}, nil
+}
+
+func buildOpenAIUserMessage(prompt string, imagePaths []string) (openAIChatMessage, openAIHistoryMessage, error) {
+	stored := openAIHistoryMessage{Role: "user", Content: prompt}
+	var parts []openAIContentPart
+	var notes []string
+	for _, p := range imagePaths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		part, err := openAIImagePart(p)
+		if err != nil {
+			return openAIChatMessage{}, stored, fmt.Errorf("failed to read image %s: %w", p, err)
+		}
+		parts = append(parts, part)
+		notes = append(notes, "[image: "+filepath.Base(p)+"]")
+	}
+	if len(parts) == 0 {
+		return openAIChatMessage{Role: "user", Content: prompt}, stored, nil
+	}
+	stored.Content = strings.TrimSpace(prompt + "\n" + strings.Join(notes, " "))
+	parts = append([]openAIContentPart{{Type: "text", Text: prompt}}, parts...)
+	return openAIChatMessage{Role: "user", Content: parts}, stored, nil
+}
+
+func (o openAIRunner) Run(parent context.Context, cfg bridgeConfig, chatID int64, prompt string, imagePaths []string) (agentRunResult, error) {
+	sessionID := getRunSessionID(parent, o.Name(), chatID)
+	if sessionID == "" {
+		var err error
+		if sessionID, err = newOpenAISessionID(); err != nil {
+			return agentRunResult{}, err
+		}
+	}
+	history, err := loadOpenAIHistory(cfg, sessionID)
+	if err != nil {
+		return agentRunResult{}, err
+	}
+	userMsg, storedUser, err := buildOpenAIUserMessage(prompt, imagePaths)
+	if err != nil {
+		return agentRunResult{}, err
+	}
+
+	budget := cfg.OpenAIHistoryTokens - estimateTokens(storedUser.Content)
+	past := trimOpenAIHistory(history.Messages, budget)
+	messages := make([]openAIChatMessage, 0, len(past)+1)
+	for _, m := range past {
+		messages = append(messages, openAIChatMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, userMsg)
+
+	ctx, cancel := context.WithTimeout(parent, time.Duration(cfg.TimeoutSec)*time.Second)
+	defer cancel()
+	reply, usage, err := streamOpenAIChat(ctx, cfg, messages)
+	if isRunCancelled(parent) {
+		log.Printf("[openai] cancelled chat_id=%d session=%q", chatID, sessionID)
+		return agentRunResult{Output: reply}, errRunCancelled
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("[openai] timeout chat_id=%d session=%q", chatID, sessionID)
+		return agentRunResult{Output: reply}, newAgentTimeoutError(cfg.TimeoutSec)
+	}
+	if err != nil {
+		log.Printf("[openai] request failed chat_id=%d session=%q err=%v", chatID, sessionID, err)
+		return agentRunResult{}, err
+	}
+
+	history.Messages = append(past, storedUser, openAIHistoryMessage{Role: "assistant", Content: reply})
+	if err := saveOpenAIHistory(cfg, sessionID, history); err != nil {
+		log.Printf("[openai] history save failed chat_id=%d session=%q err=%v", chatID, sessionID, err)
+	}
+	log.Printf("[openai] ok chat_id=%d session=%q history=%d tokens_in=%d tokens_out=%d", chatID, sessionID, len(history.Messages), usage.InputTokens, usage.OutputTokens)
+	return agentRunResult{Output: reply, SessionID: sessionID, Usage: usage}, nil
+}
+
+// streamOpenAIChat sends a streaming chat completion and returns the text
+// received so far even when the stream breaks off.
+func streamOpenAIChat(ctx context.Context, cfg bridgeConfig, messages []openAIChatMessage) (string, agentUsage, error) {
+	payload := map[string]any{
+		"messages":       messages,
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+	}
+	if cfg.OpenAIModel != "" {
+		payload["model"] = cfg.OpenAIModel
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", agentUsage{}, err
+	}
+	endpoint := strings.TrimRight(cfg.OpenAIBaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", agentUsage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if cfg.OpenAIAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.OpenAIAPIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", agentUsage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", agentUsage{}, newOpenAIStatusError(resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	// Servers that ignore "stream" answer with a single JSON document.
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var full openAIChunk
+		if err := json.NewDecoder(resp.Body).Decode(&full); err != nil {
+			return "", agentUsage{}, fmt.Errorf("invalid chat completion response: %w", err)
+		}
+		if full.Error != nil {
+			return "", agentUsage{}, errors.New(full.Error.Message)
+		}
+		if len(full.Choices) == 0 {
+			return "", agentUsage{}, errors.New("chat completion returned no choices")
+		}
+		return strings.TrimSpace(full.Choices[0].Message.Content), openAIUsageToAgent(full.Usage), nil
+	}
+
+	var reply strings.Builder
+	usage := agentUsage{}
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				break
+			}
+			var chunk openAIChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err == nil {
+				if chunk.Error != nil {
+					return strings.TrimSpace(reply.String()), usage, errors.New(chunk.Error.Message)
+				}
+				for _, c := range chunk.Choices {
+					reply.WriteString(c.Delta.Content)
+				}
+				if chunk.Usage != nil {
+					usage = openAIUsageToAgent(chunk.Usage)
+				}
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			return strings.TrimSpace(reply.String()), usage, readErr
+		}
+	}
+	return strings.TrimSpace(reply.String()), usage, nil
+}
+
+func openAIUsageToAgent(u *openAIUsage) agentUsage {
+	if u == nil {
+		return agentUsage{}
+	}
+	out := agentUsage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+	if u.PromptTokensDetails != nil {
+		// Cached tokens are included in prompt_tokens.
+		out.CachedInputTokens = u.PromptTokensDetails.CachedTokens
+		out.InputTokens = uncachedInput(u.PromptTokens, out.CachedInputTokens)
+	}
+	return out
+}
+
+func newOpenAIStatusError(status int, body string) *agentError {
+	e := &agentError{ExitCode: -1, Detail: body, Err: fmt.Errorf("chat completions returned status %d", status)}
+	switch {
+	case classifyAgentErrorText(body) == agentErrQuota:
+		// OpenAI reports an exhausted quota as a 429 with insufficient_quota.
+		e.Class = agentErrQuota
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Class = agentErrAuth
+	case status == http.StatusTooManyRequests:
+		e.Class = agentErrRateLimited
+	case status >= 500:
+		e.Class = agentErrTransient
+	default:
+		e.Class = classifyAgentErrorText(body)
+		if e.Class == agentErrNone {
+			e.Class = agentErrOther
+		}
+	}
+	return e
+}
@@ -0,0 +1,167 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newMockChatServer serves /v1/chat/completions as an SSE stream that replies
+// "echo: <last user text>" and records every request body.
+func newMockChatServer(t *testing.T) (*httptest.Server, func() []map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+
+		msgs := body["messages"].([]any)
+		last := msgs[len(msgs)-1].(map[string]any)
+		text, ok := last["content"].(string)
+		if !ok {
+			text = last["content"].([]any)[0].(map[string]any)["text"].(string)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"echo: ", text} {
+			b, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": piece}}}})
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, `data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]map[string]any(nil), requests...)
+	}
+}
+
+func TestOpenAIRunnerKeepsHistory(t *testing.T) {
+	srv, requests := newMockChatServer(t)
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		OpenAIBaseURL:       srv.URL + "/v1",
+		OpenAIAPIKey:        "test-key",
+		OpenAIModel:         "local-model",
+		OpenAIHistoryTokens: 8000,
+		OpenAIHistoryDir:    filepath.Join(dir, "openai-history"),
+		SessionStoreFile:    filepath.Join(dir, "sessions.json"),
+		TimeoutSec:          10,
+	}
+	imgPath := filepath.Join(dir, "pic.png")
+	if err := os.WriteFile(imgPath, []byte("\x89PNG\r\n\x1a\nfake"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	chatSessions = map[string]sessionRecord{}
+	runner := openAIRunner{}
+	first, err := runner.Run(context.Background(), cfg, 7, "hello", []string{imgPath})
+	if err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	if first.Output != "echo: hello" || first.SessionID == "" {
+		t.Fatalf("unexpected first result: %+v", first)
+	}
+	if first.Usage.InputTokens != 12 || first.Usage.OutputTokens != 3 {
+		t.Fatalf("usage = %+v", first.Usage)
+	}
+	setChatSessionID(cfg, "openai", 7, first.SessionID)
+
+	second, err := runner.Run(context.Background(), cfg, 7, "again", nil)
+	if err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if second.SessionID != first.SessionID {
+		t.Fatalf("session changed: %q -> %q", first.SessionID, second.SessionID)
+	}
+
+	reqs := requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if reqs[0]["model"] != "local-model" || reqs[0]["stream"] != true {
+		t.Fatalf("unexpected request: %v", reqs[0])
+	}
+	parts := reqs[0]["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	url := parts[1].(map[string]any)["image_url"].(map[string]any)["url"].(string)
+	if !strings.HasPrefix(url, "data:image/png;base64,") {
+		t.Fatalf("image part url = %q", url)
+	}
+	msgs := reqs[1]["messages"].([]any)
+	if len(msgs) != 3 {
+		t.Fatalf("second request should carry history, got %d messages", len(msgs))
+	}
+	if got := msgs[0].(map[string]any)["content"]; got != "hello\n[image: pic.png]" {
+		t.Fatalf("stored user turn = %q", got)
+	}
+	if got := msgs[1].(map[string]any)["content"]; got != "echo: hello" {
+		t.Fatalf("stored assistant turn = %q", got)
+	}
+}
+
+func TestTrimOpenAIHistory(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 400)
+	msgs := []openAIHistoryMessage{
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "short"},
+		{Role: "assistant", Content: "short"},
+	}
+	got := trimOpenAIHistory(msgs, 150)
+	if len(got) != 2 || got[0].Content != "short" {
+		t.Fatalf("unexpected trim: %+v", got)
+	}
+	// A budget that cuts between a user turn and its reply must not leave a
+	// dangling assistant message at the start.
+	got = trimOpenAIHistory(msgs, 120)
+	if len(got) != 2 || got[0].Role != "user" {
+		t.Fatalf("history must start with a user turn: %+v", got)
+	}
+	if got := trimOpenAIHistory(msgs, 5); len(got) != 0 {
+		t.Fatalf("expected empty history, got %+v", got)
+	}
+	// A prompt that alone exceeds the budget leaves nothing for history.
+	for _, budget := range []int{0, -40} {
+		if got := trimOpenAIHistory(msgs, budget); len(got) != 0 {
+			t.Fatalf("budget %d: expected empty history, got %+v", budget, got)
+		}
+	}
+}
+
+func TestOpenAIUsageExcludesCachedFromInput(t *testing.T) {
+	t.Parallel()
+
+	var u openAIUsage
+	if err := json.Unmarshal([]byte(`{"prompt_tokens":24763,"completion_tokens":122,"prompt_tokens_details":{"cached_tokens":24448}}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	got := openAIUsageToAgent(&u)
+	if want := (agentUsage{InputTokens: 315, CachedInputTokens: 24448, OutputTokens: 122}); got != want {
+		t.Fatalf("usage = %+v, want %+v", got, want)
+	}
+	if total := got.Total(); total != 24885 {
+		t.Fatalf("total = %d, want 24885", total)
+	}
+}
@@ -0,0 +1,147 @@
+package bridge
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type updateLane int
+
+const (
+	laneWork updateLane = iota
+	laneControl
+)
+
+// classifyUpdateLane decides on arrival whether a message is agent work
+// (prompts and media, queued per chat) or a control message that must be
+// answered right away even while an agent is busy.
+func classifyUpdateLane(cfg bridgeConfig, msg telegramMessage) updateLane {
+	if msg.From == nil || msg.From.ID != cfg.AllowedUserID {
+		return laneControl
+	}
+	if extractMediaInput(msg) != nil || extractImageInput(msg) != nil {
+		return laneWork
+	}
+	text := normalizeMessageText(msg)
+	if strings.TrimSpace(text) == "" {
+		return laneControl
+	}
+	if carry, ok := parseNewSessionCommand(cfg, text); ok {
+		// Summarizing the outgoing session is an agent run, so it waits in
+		// the chat's queue like any prompt.
+		if carry {
+			return laneWork
+		}
+		return laneControl
+	}
+	switch classifyTextCommand(text) {
+	case commandNone:
+	case commandScreenshot:
+		// Capturing and uploading takes a while; /cancel and /ping must
+		// not wait behind it.
+		return laneWork
+	default:
+		return laneControl
+	}
+	if _, ok := parseRememberCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseQueueCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseProviderCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseSettingCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseUsageCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseSessionCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseScheduleCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseReminderCommand(text); ok {
+		return laneControl
+	}
+	if _, ok := parseBackgroundCommand(text); ok {
+		// /bg only starts the job; it never waits in the chat's queue.
+		return laneControl
+	}
+	return laneWork
+}
+
+// controlLane runs control handlers one at a time on a path that never waits
+// behind agent work.
+type controlLane struct {
+	tasks chan func()
+	done  chan struct{}
+}
+
+func newControlLane(size int) *controlLane {
+	return &controlLane{tasks: make(chan func(), size), done: make(chan struct{})}
+}
+
+func (l *controlLane) Run() {
+	defer close(l.done)
+	for task := range l.tasks {
+		task()
+	}
+}
+
+func (l *controlLane) Submit(task func()) {
+	l.tasks <- task
+}
+
+// Close stops accepting tasks and waits up to timeout for queued ones.
+func (l *controlLane) Close(timeout time.Duration) {
+	close(l.tasks)
+	select {
+	case <-l.done:
+	case <-time.After(timeout):
+	}
+}
+
+func handleControlMessage(cfg bridgeConfig, d *chatDispatcher, msg telegramMessage) {
+	if isCancelRequest(cfg, msg) {
+		handleCancelCommand(cfg, d, msg)
+		return
+	}
+	if cmd, ok := parseQueueCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleQueueCommand(cfg, d, msg, cmd)
+		return
+	}
+	if name, ok := parseProviderCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleProviderCommand(cfg, msg, name)
+		return
+	}
+	if cmd, ok := parseSettingCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleSettingCommand(cfg, msg, cmd)
+		return
+	}
+	if period, ok := parseUsageCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleUsageCommand(cfg, msg, period)
+		return
+	}
+	if cmd, ok := parseSessionCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleSessionCommand(cfg, msg, cmd)
+		return
+	}
+	if cmd, ok := parseScheduleCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleScheduleCommand(cfg, msg, cmd)
+		return
+	}
+	if cmd, ok := parseReminderCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleReminderCommand(cfg, msg, cmd)
+		return
+	}
+	if cmd, ok := parseBackgroundCommand(normalizeMessageText(msg)); ok && msg.From != nil && msg.From.ID == cfg.AllowedUserID {
+		handleBackgroundCommand(cfg, msg, cmd)
+		return
+	}
+	handleMessage(context.Background(), cfg, msg)
+}
@@ -0,0 +1,37 @@
+package bridge
+
+import "testing"
+
+func TestClassifyUpdateLane(t *testing.T) {
+	t.Parallel()
+
+	cfg := bridgeConfig{AllowedUserID: 1}
+	owner := &telegramUser{ID: 1}
+	tests := []struct {
+		name string
+		msg  telegramMessage
+		want updateLane
+	}{
+		{"ping", telegramMessage{From: owner, Text: "/ping"}, laneControl},
+		{"session", telegramMessage{From: owner, Text: "/session"}, laneControl},
+		{"cancel", telegramMessage{From: owner, Text: "/cancel"}, laneControl},
+		{"help", telegramMessage{From: owner, Text: "/help"}, laneControl},
+		{"remember", telegramMessage{From: owner, Text: "记住 明天开会"}, laneControl},
+		{"empty", telegramMessage{From: owner}, laneControl},
+		{"unauthorized prompt", telegramMessage{From: &telegramUser{ID: 2}, Text: "hello"}, laneControl},
+		{"prompt", telegramMessage{From: owner, Text: "refactor main.go"}, laneWork},
+		{"screenshot", telegramMessage{From: owner, Text: "/screenshot"}, laneWork},
+		{"photo with command caption", telegramMessage{From: owner, Caption: "/ping", Photo: []telegramPhotoSize{{FileID: "p"}}}, laneWork},
+		{"voice", telegramMessage{From: owner, Voice: &telegramFileRef{FileID: "v"}}, laneWork},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := classifyUpdateLane(cfg, tc.msg); got != tc.want {
+				t.Fatalf("classifyUpdateLane()=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errRunCancelled = errors.New("run cancelled")
+
+// startInProcessGroup makes cmd the leader of a new process group so that
+// cancelling its context stops the agent together with every child it
+// spawned: the group gets SIGTERM first and SIGKILL once grace has passed.
+//
+// The returned release must be called once Wait (or Run) has returned. When
+// the whole group is gone by then, it calls off the pending SIGKILL, whose
+// process group ID could otherwise be reused by an unrelated group within
+// the grace period. It reports whether a pending SIGKILL was called off.
+func startInProcessGroup(cmd *exec.Cmd, grace time.Duration) (release func() bool) {
+	var mu sync.Mutex
+	var killTimer *time.Timer
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		pgid := cmd.Process.Pid
+		if grace <= 0 {
+			return syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+		err := syscall.Kill(-pgid, syscall.SIGTERM)
+		// The leader may exit on SIGTERM while children ignore it, so the
+		// group is killed after the grace period unless release finds it
+		// gone.
+		mu.Lock()
+		killTimer = time.AfterFunc(grace, func() { _ = syscall.Kill(-pgid, syscall.SIGKILL) })
+		mu.Unlock()
+		return err
+	}
+	// Grandchildren may keep stdout open after the group is signalled; do not
+	// let them block Wait for longer than the grace period.
+	cmd.WaitDelay = grace + 2*time.Second
+	return func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if killTimer == nil || cmd.Process == nil {
+			return false
+		}
+		if err := syscall.Kill(-cmd.Process.Pid, 0); !errors.Is(err, syscall.ESRCH) {
+			// Members of the group are still alive and hold on to its ID.
+			return false
+		}
+		return killTimer.Stop()
+	}
+}
+
+func killGrace(cfg bridgeConfig) time.Duration {
+	return time.Duration(cfg.AgentKillGraceSec) * time.Second
+}
+
+// isRunCancelled reports whether ctx was cancelled by the user rather than by
+// its own deadline.
+func isRunCancelled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// lockedBuffer is a bytes.Buffer that is safe to write from the stdout and
+// stderr copy goroutines of one command at the same time.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
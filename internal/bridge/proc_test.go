@@ -0,0 +1,131 @@
+package bridge
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartInProcessGroupKillsChildren(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 30 & echo $!; wait")
+	startInProcessGroup(cmd, 0)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 32)
+	n, _ := stdout.Read(buf)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		t.Fatalf("bad child pid output %q", buf[:n])
+	}
+
+	cancel()
+	_ = cmd.Wait()
+	if !isRunCancelled(ctx) {
+		t.Fatal("expected ctx to be reported as cancelled")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("grandchild pid=%d survived group kill", pid)
+}
+
+func TestStartInProcessGroupTermThenKill(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// The shell and its child ignore SIGTERM, so only the SIGKILL that
+	// follows the grace period can stop them.
+	cmd := exec.CommandContext(ctx, "sh", "-c", `trap "" TERM; sleep 30 & echo $!; wait`)
+	startInProcessGroup(cmd, 300*time.Millisecond)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 32)
+	n, _ := stdout.Read(buf)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		t.Fatalf("bad child pid output %q", buf[:n])
+	}
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Fatalf("child pid=%d died before the grace period: %v", pid, err)
+	}
+	_ = cmd.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("child pid=%d survived SIGKILL after grace", pid)
+}
+
+func TestStartInProcessGroupCallsOffKillOnceGroupIsGone(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "sleep", "30")
+	release := startInProcessGroup(cmd, 10*time.Second)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_ = cmd.Wait()
+	// sleep exits on SIGTERM, so no SIGKILL may follow: by the time it would
+	// fire the group ID may belong to someone else.
+	if !release() {
+		t.Fatal("pending SIGKILL not called off after the group exited")
+	}
+	if release() {
+		t.Fatal("release reported a second pending SIGKILL")
+	}
+}
+
+func TestGenericRunnerTimeoutKeepsPartialOutput(t *testing.T) {
+	cfg := bridgeConfig{
+		AgentBin:          "/bin/sh",
+		AgentArgs:         `-c 'echo partial line; sleep 30' sh`,
+		AgentPromptMode:   promptModeStdin,
+		AgentKillGraceSec: 1,
+		TimeoutSec:        1,
+	}
+	start := time.Now()
+	res, err := genericRunner{name: "generic"}.Run(context.Background(), cfg, 31, "hi", nil)
+	if classifyAgentError(err) != agentErrTimeout {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if res.Output != "partial line" {
+		t.Fatalf("partial output = %q", res.Output)
+	}
+	if elapsed := time.Since(start); elapsed > 6*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+	if got := friendlyAgentError(err); !strings.HasPrefix(got, "timed out after 1 s.") {
+		t.Fatalf("banner = %q", got)
+	}
+}
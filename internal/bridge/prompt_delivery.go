@@ -0,0 +1,83 @@
+package bridge
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// How the generic runner hands the prompt to the agent. argv is visible to
+// every local user through ps and is bounded by ARG_MAX, so long or private
+// prompts should use one of the other modes.
+const (
+	promptModeArgv  = "argv"
+	promptModeStdin = "stdin"
+	promptModeFile  = "file"
+	promptModeEnv   = "env"
+)
+
+const defaultAgentPromptEnv = "TELEGENT_PROMPT"
+
+func validatePromptMode(cfg bridgeConfig) error {
+	switch cfg.AgentPromptMode {
+	case promptModeArgv:
+		return nil
+	case promptModeStdin, promptModeFile, promptModeEnv:
+	default:
+		return fmt.Errorf("AGENT_PROMPT_MODE must be one of argv, stdin, file, env")
+	}
+	templates := []struct{ name, value string }{{"AGENT_ARGS", cfg.AgentArgs}, {"AGENT_RESUME_ARGS", cfg.AgentResumeArgs}}
+	for _, t := range templates {
+		name, template := t.name, t.value
+		if strings.Contains(template, "{{prompt}}") {
+			return fmt.Errorf("%s must not use {{prompt}} when AGENT_PROMPT_MODE=%s", name, cfg.AgentPromptMode)
+		}
+		if cfg.AgentPromptMode != promptModeFile && strings.Contains(template, "{{prompt_file}}") {
+			return fmt.Errorf("%s uses {{prompt_file}}, which requires AGENT_PROMPT_MODE=file", name)
+		}
+	}
+	return nil
+}
+
+// writePromptFile stores the prompt in a private temp file; the caller removes
+// it once the agent has exited.
+func writePromptFile(cfg bridgeConfig, prompt string) (string, error) {
+	dir := cfg.TmpDir
+	if strings.TrimSpace(dir) == "" {
+		dir = os.TempDir()
+	}
+	f, err := os.CreateTemp(dir, "agent-prompt-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	path := f.Name()
+	if err := f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to restrict prompt file: %w", err)
+	}
+	if _, err := f.WriteString(prompt); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func attachPromptInput(cmd *exec.Cmd, cfg bridgeConfig, prompt string) {
+	switch cfg.AgentPromptMode {
+	case promptModeStdin:
+		cmd.Stdin = strings.NewReader(prompt)
+	case promptModeEnv:
+		name := cfg.AgentPromptEnv
+		if name == "" {
+			name = defaultAgentPromptEnv
+		}
+		cmd.Env = append(os.Environ(), name+"="+prompt)
+	}
+}
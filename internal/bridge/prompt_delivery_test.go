@@ -0,0 +1,84 @@
+package bridge
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenericRunnerPromptModes(t *testing.T) {
+	base := bridgeConfig{AgentBin: "/bin/sh", TmpDir: t.TempDir(), TimeoutSec: 10}
+	prompt := "secret prompt\nwith two lines"
+
+	cases := []struct {
+		mode string
+		args string
+	}{
+		{promptModeStdin, `-c 'cat'`},
+		{promptModeEnv, `-c 'printf %s "$TELEGENT_PROMPT"'`},
+		{promptModeFile, `-c 'cat "$1"' sh {{prompt_file}}`},
+		{promptModeFile, `-c 'cat "$1"' sh`},
+	}
+	for _, tc := range cases {
+		cfg := base
+		cfg.AgentPromptMode = tc.mode
+		cfg.AgentPromptEnv = defaultAgentPromptEnv
+		cfg.AgentArgs = tc.args
+		if err := validatePromptMode(cfg); err != nil {
+			t.Fatalf("mode %s: validate: %v", tc.mode, err)
+		}
+		res, err := genericRunner{name: "generic"}.Run(context.Background(), cfg, 9001, prompt, nil)
+		if err != nil {
+			t.Fatalf("mode %s args %s: run failed: %v", tc.mode, tc.args, err)
+		}
+		if res.Output != prompt {
+			t.Fatalf("mode %s args %s: output = %q", tc.mode, tc.args, res.Output)
+		}
+	}
+
+	leftovers, err := os.ReadDir(base.TmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 0 {
+		t.Fatalf("prompt files were not removed: %v", leftovers)
+	}
+}
+
+func TestWritePromptFileIsPrivate(t *testing.T) {
+	t.Parallel()
+
+	path, err := writePromptFile(bridgeConfig{TmpDir: t.TempDir()}, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("prompt file mode = %v", info.Mode().Perm())
+	}
+}
+
+func TestValidatePromptMode(t *testing.T) {
+	t.Parallel()
+
+	bad := []bridgeConfig{
+		{AgentPromptMode: "pipe"},
+		{AgentPromptMode: promptModeStdin, AgentArgs: `--msg "{{prompt}}"`},
+		{AgentPromptMode: promptModeEnv, AgentResumeArgs: `--file {{prompt_file}}`},
+	}
+	for _, cfg := range bad {
+		if err := validatePromptMode(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+	if err := validatePromptMode(bridgeConfig{AgentPromptMode: promptModeArgv, AgentArgs: `--msg "{{prompt}}"`}); err != nil {
+		t.Fatalf("argv mode rejected: %v", err)
+	}
+	if _, err := buildGenericRunnerArgs(bridgeConfig{AgentPromptMode: promptModeStdin, AgentArgs: `-p {{prompt}}`}, "x", "", "", false, nil); err == nil || !strings.Contains(err.Error(), "AGENT_PROMPT_MODE") {
+		t.Fatalf("expected prompt mode error, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"strconv"
+	"strings"
+)
+
+// chatProvider returns the provider the chat switched to, or the default one
+// when the chat never switched or its choice is no longer configured.
+func chatProvider(cfg bridgeConfig, chatID int64) string {
+	if p := getChatSettings(chatID).Provider; p != "" && isConfiguredProvider(cfg, p) {
+		return p
+	}
+	return cfg.AgentProvider
+}
+
+func isConfiguredProvider(cfg bridgeConfig, name string) bool {
+	for _, p := range cfg.AgentProviders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAgentProviders reads the AGENT_PROVIDERS list. The default provider is
+// always part of it, first.
+func parseAgentProviders(raw string, defaultProvider string) []string {
+	out := []string{defaultProvider}
+	for _, p := range splitProviderList(raw) {
+		if p != defaultProvider {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// splitProviderList parses a comma or space separated list of provider names,
+// lowercased and without duplicates.
+func splitProviderList(raw string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' }) {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	return out
+}
+
+func parseProviderCommand(text string) (string, bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || fields[0] != "/provider" {
+		return "", false
+	}
+	if len(fields) == 1 {
+		return "", true
+	}
+	return strings.ToLower(fields[1]), true
+}
+
+func handleProviderCommand(cfg bridgeConfig, msg telegramMessage, name string) {
+	chatID := msg.Chat.ID
+	current := chatProvider(cfg, chatID)
+	var reply string
+	switch {
+	case name == "":
+		var b strings.Builder
+		b.WriteString("providers:")
+		for _, p := range cfg.AgentProviders {
+			b.WriteString("\n")
+			if p == current {
+				b.WriteString("* ")
+			} else {
+				b.WriteString("  ")
+			}
+			b.WriteString(p)
+			if p == cfg.AgentProvider {
+				b.WriteString(" (default)")
+			}
+		}
+		b.WriteString("\nswitch with /provider <name>")
+		reply = b.String()
+	case !isConfiguredProvider(cfg, name):
+		reply = "unknown provider " + strconv.Quote(name) + ". configured: " + strings.Join(cfg.AgentProviders, ", ")
+	case name == current:
+		reply = "already using " + name + "."
+	default:
+		err := updateChatSettings(cfg, chatID, func(s *chatSettings) {
+			s.Provider = name
+			if name == cfg.AgentProvider {
+				s.Provider = ""
+			}
+		})
+		appendAudit(cfg, auditActor(msg), "provider_switch", map[string]string{"from": current, "to": name, "chat_id": strconv.FormatInt(chatID, 10)}, auditOutcome(err))
+		if err != nil {
+			reply = "failed to switch provider: " + err.Error()
+			break
+		}
+		reply = "provider switched to " + name + "."
+		if sid := getChatSessionID(name, chatID); sid != "" {
+			reply += " resuming its session " + sid + "."
+		} else {
+			reply += " next message starts a new session."
+		}
+	}
+	_ = sendMessage(cfg, chatID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "provider")
+}
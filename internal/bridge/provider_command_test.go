@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseAgentProviders(t *testing.T) {
+	t.Parallel()
+
+	got := parseAgentProviders(" Claude, codex,openai claude ", "codex")
+	want := []string{"codex", "claude", "openai"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseAgentProviders = %v, want %v", got, want)
+	}
+	if got := parseAgentProviders("", "generic"); !reflect.DeepEqual(got, []string{"generic"}) {
+		t.Fatalf("empty list = %v", got)
+	}
+}
+
+func TestParseProviderCommand(t *testing.T) {
+	t.Parallel()
+
+	if name, ok := parseProviderCommand("/provider"); !ok || name != "" {
+		t.Fatalf("list parse: ok=%v name=%q", ok, name)
+	}
+	if name, ok := parseProviderCommand("/provider Claude"); !ok || name != "claude" {
+		t.Fatalf("switch parse: ok=%v name=%q", ok, name)
+	}
+	if _, ok := parseProviderCommand("/providers"); ok {
+		t.Fatal("/providers must not parse as /provider")
+	}
+}
+
+func TestChatProviderPersists(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:    "codex",
+		AgentProviders:   []string{"codex", "claude"},
+		ChatSettingsFile: filepath.Join(dir, "chat-settings.json"),
+	}
+	chatSettingsStore = map[string]chatSettings{}
+	if err := loadChatSettings(cfg); err != nil {
+		t.Fatalf("loadChatSettings: %v", err)
+	}
+	if got := chatProvider(cfg, 5); got != "codex" {
+		t.Fatalf("default provider = %q", got)
+	}
+	if err := updateChatSettings(cfg, 5, func(s *chatSettings) { s.Provider = "claude" }); err != nil {
+		t.Fatalf("updateChatSettings: %v", err)
+	}
+
+	chatSettingsStore = map[string]chatSettings{}
+	if err := loadChatSettings(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := chatProvider(cfg, 5); got != "claude" {
+		t.Fatalf("persisted provider = %q", got)
+	}
+	if got := chatConfig(cfg, 5).AgentProvider; got != "claude" {
+		t.Fatalf("chatConfig provider = %q", got)
+	}
+	if got := chatProvider(cfg, 6); got != "codex" {
+		t.Fatalf("other chat provider = %q", got)
+	}
+
+	// A choice that is no longer configured falls back to the default.
+	cfg.AgentProviders = []string{"codex"}
+	if got := chatProvider(cfg, 5); got != "codex" {
+		t.Fatalf("unconfigured provider fallback = %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+package bridge
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type queueCommand struct {
+	Action   string
+	Position int
+}
+
+func parseQueueCommand(text string) (queueCommand, bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || fields[0] != "/queue" {
+		return queueCommand{}, false
+	}
+	if len(fields) == 1 {
+		return queueCommand{Action: "list"}, true
+	}
+	switch fields[1] {
+	case "list":
+		return queueCommand{Action: "list"}, true
+	case "clear":
+		return queueCommand{Action: "clear"}, true
+	case "rm", "remove", "del":
+		if len(fields) == 3 {
+			if n, err := strconv.Atoi(fields[2]); err == nil {
+				return queueCommand{Action: "rm", Position: n}, true
+			}
+		}
+	}
+	return queueCommand{Action: "usage"}, true
+}
+
+func handleQueueCommand(cfg bridgeConfig, d *chatDispatcher, msg telegramMessage, cmd queueCommand) {
+	chatID := msg.Chat.ID
+	var reply string
+	switch cmd.Action {
+	case "list":
+		reply = formatQueueStatus(d, chatID, time.Now())
+	case "clear":
+		reply = fmt.Sprintf("removed %d queued message(s).", d.Clear(chatID))
+	case "rm":
+		removed, ok := d.Remove(chatID, cmd.Position)
+		if !ok {
+			reply = fmt.Sprintf("no queued message at position %d.", cmd.Position)
+		} else {
+			reply = "removed from queue: " + queueItemLabel(removed.Msg)
+		}
+	default:
+		reply = "usage: /queue | /queue rm <n> | /queue clear"
+	}
+	_ = sendMessage(cfg, chatID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "queue")
+}
+
+func formatQueueStatus(d *chatDispatcher, chatID int64, now time.Time) string {
+	running, pending := d.Snapshot(chatID)
+	var b strings.Builder
+	if running == nil && len(pending) == 0 {
+		b.WriteString("queue is empty.")
+	} else {
+		if running != nil {
+			fmt.Fprintf(&b, "running (%s): %s\n", formatQueueAge(now.Sub(running.StartedAt)), queueItemLabel(running.Msg))
+		}
+		for i, item := range pending {
+			fmt.Fprintf(&b, "%d. (%s) %s\n", i+1, formatQueueAge(now.Sub(item.EnqueuedAt)), queueItemLabel(item.Msg))
+		}
+		if len(pending) > 0 {
+			b.WriteString("remove with /queue rm <n> or /queue clear")
+		}
+	}
+
+	counts := d.PendingCounts()
+	others := make([]int64, 0, len(counts))
+	for id := range counts {
+		if id != chatID {
+			others = append(others, id)
+		}
+	}
+	if len(others) > 0 {
+		sort.Slice(others, func(i, j int) bool { return others[i] < others[j] })
+		b.WriteString("\nother chats:")
+		for _, id := range others {
+			fmt.Fprintf(&b, "\n- chat %d: %d pending", id, counts[id])
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func formatQueueAge(d time.Duration) string {
+	return d.Truncate(time.Second).String()
+}
+
+func queueItemLabel(msg telegramMessage) string {
+	text := strings.TrimSpace(normalizeMessageText(msg))
+	if mediaType := detectMediaType(msg); mediaType != "" {
+		text = strings.TrimSpace("[" + mediaType + "] " + text)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > 60 {
+		text = string(r[:60]) + "..."
+	}
+	return text
+}
+
+// acknowledgeEnqueue tells the user when a message could not start right away
+// or was affected by the overflow policy.
+func acknowledgeEnqueue(cfg bridgeConfig, msg telegramMessage, out enqueueOutcome) {
+	for _, dropped := range out.Dropped {
+		reply := "queue full: dropped oldest queued message: " + queueItemLabel(dropped.Msg)
+		_ = sendMessage(cfg, msg.Chat.ID, reply)
+		appendChatLog(cfg, dropped.Msg, reply, "queue_dropped")
+	}
+	switch {
+	case out.Closed:
+		reply := "the bridge is shutting down; please resend this after restart."
+		_ = sendMessage(cfg, msg.Chat.ID, reply)
+		appendChatLog(cfg, msg, reply, "interrupted")
+	case !out.Accepted:
+		reply := fmt.Sprintf("queue full (%d pending). message rejected; use /queue to inspect or remove items.", cfg.QueueMaxPending)
+		_ = sendMessage(cfg, msg.Chat.ID, reply)
+		appendChatLog(cfg, msg, reply, "queue_rejected")
+	case out.Coalesced:
+		_ = sendMessage(cfg, msg.Chat.ID, fmt.Sprintf("queue full: merged into queued message at position %d.", out.Position))
+	case out.Position > 0:
+		_ = sendMessage(cfg, msg.Chat.ID, fmt.Sprintf("queued, position %d.", out.Position))
+	}
+}
@@ -0,0 +1,325 @@
+package bridge
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Time expressions understood by /at and /in, in English and Chinese:
+//
+//	2h, 1h30m, 45 min, in 3 days, 2小时后, 半小时, 三天后
+//	18:30, 9am, 9:30pm, tomorrow 8:00, fri 17:00, 2026-11-01 10:00
+//	明天9点, 下午3点半, 今晚8点, 周五 17:00, 11月1日 10点
+
+var (
+	enDelayRe     = regexp.MustCompile(`^(?i)(?:in\s+)?((?:\d+\s*(?:days?|hours?|hrs?|minutes?|mins?|seconds?|secs?|d|h|m|s)\s*)+)`)
+	enDelayPartRe = regexp.MustCompile(`(?i)(\d+)\s*([a-z]+)`)
+	zhDelayPart   = `(?:([0-9零〇一二两三四五六七八九十]+)\s*个?\s*(半)?|(半)\s*个?)\s*(天|小时|钟头|分钟|分|秒)`
+	zhDelayRe     = regexp.MustCompile(`^((?:` + zhDelayPart + `\s*)+)(?:以后|之后|后)?`)
+	zhDelayPartRe = regexp.MustCompile(zhDelayPart)
+
+	isoDateRe   = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})`)
+	shortDateRe = regexp.MustCompile(`^(\d{1,2})[-/](\d{1,2})\b`)
+	zhDateRe    = regexp.MustCompile(`^(\d{1,2})月(\d{1,2})[日号]`)
+
+	enClockRe = regexp.MustCompile(`^(?i)(?:at\s+)?(\d{1,2})(?:[:：](\d{2}))?(?:\s*(am|pm))?`)
+	zhClockRe = regexp.MustCompile(`^([0-9零〇一二两三四五六七八九十]+)\s*[点時时]\s*(?:(半)|(一刻)|(三刻)|([0-9零〇一二两三四五六七八九十]+)\s*分?)?`)
+)
+
+var zhDigits = map[rune]int{'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+
+// parseZhNumber reads Arabic digits or a Chinese numeral below 100.
+func parseZhNumber(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return 0, false
+	}
+	tens, units, seenTen := 0, 0, false
+	for _, r := range runes {
+		if r == '十' {
+			if seenTen {
+				return 0, false
+			}
+			seenTen = true
+			tens = units
+			if tens == 0 {
+				tens = 1
+			}
+			units = 0
+			continue
+		}
+		d, ok := zhDigits[r]
+		if !ok {
+			return 0, false
+		}
+		units = units*10 + d
+	}
+	if seenTen {
+		return tens*10 + units, units < 10
+	}
+	return units, true
+}
+
+// parseReminderDelay reads a leading duration such as "2h30m", "in 10 min"
+// or "半小时后" and returns it with the rest of the text.
+func parseReminderDelay(s string) (time.Duration, string, bool) {
+	if m := enDelayRe.FindStringSubmatchIndex(s); m != nil {
+		rest := s[m[1]:]
+		units := s[m[2]:m[3]]
+		if rest != "" && strings.TrimRightFunc(units, unicode.IsSpace) == units && !isHanPrefix(rest) {
+			// "30 seconds" is a delay, "30 sec-ish things" is not.
+			return 0, s, false
+		}
+		var total time.Duration
+		for _, part := range enDelayPartRe.FindAllStringSubmatch(units, -1) {
+			n, _ := strconv.Atoi(part[1])
+			switch unit := strings.ToLower(part[2]); {
+			case strings.HasPrefix(unit, "d"):
+				total += time.Duration(n) * 24 * time.Hour
+			case strings.HasPrefix(unit, "h"):
+				total += time.Duration(n) * time.Hour
+			case strings.HasPrefix(unit, "m"):
+				total += time.Duration(n) * time.Minute
+			default:
+				total += time.Duration(n) * time.Second
+			}
+		}
+		return total, rest, total > 0
+	}
+	if m := zhDelayRe.FindStringSubmatchIndex(s); m != nil {
+		var total time.Duration
+		for _, part := range zhDelayPartRe.FindAllStringSubmatch(s[m[2]:m[3]], -1) {
+			var unit time.Duration
+			switch part[4] {
+			case "天":
+				unit = 24 * time.Hour
+			case "小时", "钟头":
+				unit = time.Hour
+			case "分钟", "分":
+				unit = time.Minute
+			default:
+				unit = time.Second
+			}
+			if part[1] != "" {
+				n, ok := parseZhNumber(part[1])
+				if !ok {
+					return 0, s, false
+				}
+				total += time.Duration(n) * unit
+			}
+			if part[2] != "" || part[3] != "" {
+				total += unit / 2
+			}
+		}
+		return total, s[m[1]:], total > 0
+	}
+	return 0, s, false
+}
+
+var enWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var zhWeekdays = map[rune]time.Weekday{
+	'日': time.Sunday, '天': time.Sunday, '一': time.Monday, '二': time.Tuesday,
+	'三': time.Wednesday, '四': time.Thursday, '五': time.Friday, '六': time.Saturday,
+}
+
+// clockHint is the part of the day named before or after a clock time.
+type clockHint int
+
+const (
+	hintNone clockHint = iota
+	hintAM
+	hintNoon
+	hintPM
+)
+
+// parseReminderDay reads a leading day such as "tomorrow", "明天", "fri",
+// "周五" or a date. explicit reports whether a day was named at all and
+// weekly whether it was a weekday, which moves on a week once passed.
+func parseReminderDay(s string, now time.Time) (day time.Time, hint clockHint, rest string, explicit bool, weekly bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	lower := strings.ToLower(s)
+
+	words := []struct {
+		word string
+		days int
+		hint clockHint
+	}{
+		{"today", 0, hintNone}, {"tonight", 0, hintPM}, {"tomorrow", 1, hintNone},
+		{"今天", 0, hintNone}, {"今晚", 0, hintPM}, {"今早", 0, hintAM},
+		{"明天", 1, hintNone}, {"明晚", 1, hintPM}, {"明早", 1, hintAM}, {"后天", 2, hintNone},
+	}
+	for _, w := range words {
+		if strings.HasPrefix(lower, w.word) {
+			return today.AddDate(0, 0, w.days), w.hint, strings.TrimSpace(s[len(w.word):]), true, false
+		}
+	}
+
+	if m := isoDateRe.FindStringSubmatch(s); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		return time.Date(y, time.Month(mo), d, 0, 0, 0, 0, now.Location()), hintNone, strings.TrimSpace(s[len(m[0]):]), true, false
+	}
+	for _, re := range []*regexp.Regexp{zhDateRe, shortDateRe} {
+		if m := re.FindStringSubmatch(s); m != nil {
+			mo, _ := strconv.Atoi(m[1])
+			d, _ := strconv.Atoi(m[2])
+			day = time.Date(now.Year(), time.Month(mo), d, 0, 0, 0, 0, now.Location())
+			if day.Before(today) {
+				day = day.AddDate(1, 0, 0)
+			}
+			return day, hintNone, strings.TrimSpace(s[len(m[0]):]), true, false
+		}
+	}
+
+	if word, after, _ := strings.Cut(lower, " "); enWeekdays[word] != 0 || word == "sun" || word == "sunday" {
+		return nextWeekday(today, enWeekdays[word]), hintNone, strings.TrimSpace(s[len(s)-len(after):]), true, true
+	}
+	for _, prefix := range []string{"星期", "礼拜", "周"} {
+		if !strings.HasPrefix(s, prefix) {
+			continue
+		}
+		r := []rune(strings.TrimPrefix(s, prefix))
+		if len(r) > 0 {
+			if wd, ok := zhWeekdays[r[0]]; ok {
+				return nextWeekday(today, wd), hintNone, strings.TrimSpace(string(r[1:])), true, true
+			}
+		}
+	}
+	return today, hintNone, s, false, false
+}
+
+// nextWeekday is the next wd from today on, so "fri 17:00" on a Friday
+// morning means today.
+func nextWeekday(today time.Time, wd time.Weekday) time.Time {
+	return today.AddDate(0, 0, (int(wd)-int(today.Weekday())+7)%7)
+}
+
+// parseReminderClock reads a clock time such as "18:30", "9pm", "下午3点半"
+// and returns the hour and minute with the rest of the text.
+func parseReminderClock(s string, hint clockHint) (hour, minute int, rest string, ok bool) {
+	periods := []struct {
+		word string
+		hint clockHint
+	}{
+		{"凌晨", hintAM}, {"早上", hintAM}, {"早晨", hintAM}, {"上午", hintAM},
+		{"中午", hintNoon}, {"下午", hintPM}, {"傍晚", hintPM}, {"晚上", hintPM},
+	}
+	for _, p := range periods {
+		if strings.HasPrefix(s, p.word) {
+			s, hint = strings.TrimSpace(strings.TrimPrefix(s, p.word)), p.hint
+			break
+		}
+	}
+
+	if m := zhClockRe.FindStringSubmatch(s); m != nil {
+		h, okH := parseZhNumber(m[1])
+		if !okH {
+			return 0, 0, s, false
+		}
+		mins := 0
+		switch {
+		case m[2] != "":
+			mins = 30
+		case m[3] != "":
+			mins = 15
+		case m[4] != "":
+			mins = 45
+		case m[5] != "":
+			if mins, okH = parseZhNumber(m[5]); !okH {
+				return 0, 0, s, false
+			}
+		}
+		hour, minute, rest = h, mins, s[len(m[0]):]
+	} else if m := enClockRe.FindStringSubmatch(s); m != nil && (m[2] != "" || m[3] != "") {
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		switch strings.ToLower(m[3]) {
+		case "am":
+			hint = hintAM
+		case "pm":
+			hint = hintPM
+		}
+		if m[3] != "" && (hour < 1 || hour > 12) {
+			return 0, 0, s, false
+		}
+		rest = s[len(m[0]):]
+		if rest != "" && !unicode.IsSpace([]rune(rest)[0]) && !isHanPrefix(rest) {
+			return 0, 0, s, false
+		}
+	} else {
+		return 0, 0, s, false
+	}
+
+	switch hint {
+	case hintAM:
+		if hour == 12 {
+			hour = 0
+		}
+	case hintNoon:
+		if hour < 6 {
+			hour += 12
+		}
+	case hintPM:
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, s, false
+	}
+	return hour, minute, strings.TrimSpace(rest), true
+}
+
+func isHanPrefix(s string) bool {
+	r := []rune(s)
+	return len(r) > 0 && unicode.Is(unicode.Han, r[0])
+}
+
+// parseReminderTime reads the time at the start of the text of /at or /in
+// and returns when the item is due and the rest of the text. A clock time
+// without a day that has already passed today means tomorrow.
+func parseReminderTime(s string, now time.Time) (time.Time, string, error) {
+	s = strings.TrimSpace(s)
+	if d, rest, ok := parseReminderDelay(s); ok {
+		return now.Add(d), strings.TrimSpace(rest), nil
+	}
+
+	day, hint, rest, explicitDay, weekly := parseReminderDay(s, now)
+	hour, minute, rest, ok := parseReminderClock(rest, hint)
+	if !ok {
+		if explicitDay {
+			return time.Time{}, s, errors.New("add a time of day, e.g. tomorrow 9:00 or 明天9点")
+		}
+		return time.Time{}, s, errors.New("could not read the time; try 18:30, 9pm, tomorrow 8:00, 2h, 30m, 明天9点 or 2小时后")
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+	if !due.After(now) {
+		if weekly {
+			return due.AddDate(0, 0, 7), rest, nil
+		}
+		if explicitDay {
+			return time.Time{}, s, errors.New("that time has already passed")
+		}
+		due = due.AddDate(0, 0, 1)
+	}
+	return due, rest, nil
+}
@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminderTime(t *testing.T) {
+	t.Parallel()
+
+	// Friday 2026-03-06 14:20.
+	now := time.Date(2026, 3, 6, 14, 20, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+	cases := []struct {
+		in   string
+		want time.Time
+		rest string
+	}{
+		{"2h check deploy", now.Add(2 * time.Hour), "check deploy"},
+		{"1h30m x", now.Add(90 * time.Minute), "x"},
+		{"in 10 minutes x", now.Add(10 * time.Minute), "x"},
+		{"45 min remind me to stretch", now.Add(45 * time.Minute), "remind me to stretch"},
+		{"2小时后提醒我开会", now.Add(2 * time.Hour), "提醒我开会"},
+		{"半小时后 x", now.Add(30 * time.Minute), "x"},
+		{"一个半小时 x", now.Add(90 * time.Minute), "x"},
+		{"三天后 x", now.Add(72 * time.Hour), "x"},
+		{"18:30 check deploy status", at(6, 18, 30), "check deploy status"},
+		{"9am standup", at(7, 9, 0), "standup"},
+		{"9:15pm x", at(6, 21, 15), "x"},
+		{"tomorrow 8:00 x", at(7, 8, 0), "x"},
+		{"tonight 8pm x", at(6, 20, 0), "x"},
+		{"fri 17:00 x", at(6, 17, 0), "x"},
+		{"fri 9:00 x", at(13, 9, 0), "x"},
+		{"mon 09:30 x", at(9, 9, 30), "x"},
+		{"2026-03-10 10:00 x", at(10, 10, 0), "x"},
+		{"明天9点 x", at(7, 9, 0), "x"},
+		{"下午3点半 x", at(6, 15, 30), "x"},
+		{"今晚八点提醒我收衣服", at(6, 20, 0), "提醒我收衣服"},
+		{"周五 17:00 x", at(6, 17, 0), "x"},
+		{"3月8日 10点 x", at(8, 10, 0), "x"},
+		{"十二点十五分 x", at(7, 12, 15), "x"},
+	}
+	for _, tc := range cases {
+		got, rest, err := parseReminderTime(tc.in, now)
+		if err != nil || !got.Equal(tc.want) || rest != tc.rest {
+			t.Fatalf("parseReminderTime(%q) = %s, %q, %v; want %s, %q", tc.in, got, rest, err, tc.want, tc.rest)
+		}
+	}
+
+	for _, in := range []string{"check deploy", "30 seconds-ish", "tomorrow check", "today 9:00 x", "25:00 x", "13pm x"} {
+		if got, _, err := parseReminderTime(in, now); err == nil {
+			t.Fatalf("parseReminderTime(%q) = %s, want an error", in, got)
+		}
+	}
+}
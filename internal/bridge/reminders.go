@@ -0,0 +1,392 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reminderModeAgent = "agent"
+	reminderModeNote  = "note"
+
+	maxRemindersPerChat = 50
+)
+
+// reminderItem is a one-shot /at or /in item: a prompt for the agent or a
+// note sent back as is.
+type reminderItem struct {
+	ID     int    `json:"id"`
+	ChatID int64  `json:"chat_id"`
+	Mode   string `json:"mode"`
+	Text   string `json:"text"`
+	// Times are RFC3339.
+	DueAt     string `json:"due_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (r reminderItem) label() string {
+	if r.Mode == reminderModeNote {
+		return "[reminder #" + strconv.Itoa(r.ID) + "]"
+	}
+	return "[at #" + strconv.Itoa(r.ID) + "]"
+}
+
+type reminderStoreData struct {
+	NextID int            `json:"next_id"`
+	Items  []reminderItem `json:"items"`
+}
+
+var (
+	reminderMu sync.Mutex
+	reminders  = reminderStoreData{NextID: 1}
+
+	// A note starts with "remind me (to)" or "提醒我"; anything else is a
+	// prompt for the agent unless --note or --run says otherwise.
+	reminderNoteRe = regexp.MustCompile(`^(?i)(?:remind\s+me\s+(?:to\s+|that\s+|about\s+)?|提醒我?\s*[:：,，]?\s*)`)
+)
+
+func defaultReminderPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("REMINDER_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "reminders.json")
+}
+
+func loadReminders(cfg bridgeConfig) error {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+
+	reminders = reminderStoreData{NextID: 1}
+	raw, err := readStoreFile(cfg, cfg.ReminderFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return nil
+	}
+	var parsed reminderStoreData
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	for _, r := range parsed.Items {
+		if r.ID >= parsed.NextID {
+			parsed.NextID = r.ID + 1
+		}
+	}
+	if parsed.NextID < 1 {
+		parsed.NextID = 1
+	}
+	reminders = parsed
+	return nil
+}
+
+func saveRemindersLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(reminders, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, cfg.ReminderFile, data)
+}
+
+type reminderCommand struct {
+	Name   string
+	Action string
+	Args   string
+}
+
+func parseReminderCommand(text string) (reminderCommand, bool) {
+	text = strings.TrimSpace(text)
+	name, rest, _ := strings.Cut(text, " ")
+	switch name {
+	case "/at", "/in":
+	default:
+		return reminderCommand{}, false
+	}
+	cmd := reminderCommand{Name: strings.TrimPrefix(name, "/"), Action: "add", Args: strings.TrimSpace(rest)}
+	action, args, _ := strings.Cut(cmd.Args, " ")
+	switch action {
+	case "", "list", "ls":
+		cmd.Action, cmd.Args = "list", ""
+	case "rm", "cancel", "del", "delete":
+		cmd.Action, cmd.Args = "rm", strings.TrimSpace(args)
+	}
+	return cmd, true
+}
+
+// parseReminderBody splits what follows the time into the mode and the text.
+func parseReminderBody(body string) (mode string, text string) {
+	body = strings.TrimSpace(body)
+	if flag, rest, _ := strings.Cut(body, " "); flag == "--note" || flag == "--run" {
+		mode = reminderModeNote
+		if flag == "--run" {
+			mode = reminderModeAgent
+		}
+		return mode, strings.TrimSpace(rest)
+	}
+	if loc := reminderNoteRe.FindStringIndex(body); loc != nil && loc[1] > 0 && loc[1] < len(body) {
+		return reminderModeNote, strings.TrimSpace(body[loc[1]:])
+	}
+	return reminderModeAgent, body
+}
+
+func handleReminderCommand(cfg bridgeConfig, msg telegramMessage, cmd reminderCommand) {
+	var reply string
+	switch cmd.Action {
+	case "list":
+		reply = formatReminderList(msg.Chat.ID, time.Now())
+	case "rm":
+		reply = cancelReminder(cfg, msg, cmd.Args)
+	default:
+		reply = addReminder(cfg, msg, cmd, time.Now())
+	}
+	_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "reminder_"+cmd.Action)
+}
+
+func addReminder(cfg bridgeConfig, msg telegramMessage, cmd reminderCommand, now time.Time) string {
+	due, body, err := parseReminderTime(cmd.Args, now)
+	if err != nil {
+		return err.Error() + "\nusage: /" + cmd.Name + " <time|duration> <prompt>, or /" + cmd.Name + " <time> remind me to <note>"
+	}
+	mode, text := parseReminderBody(body)
+	if text == "" {
+		return "what should happen then? e.g. /" + cmd.Name + " " + strings.TrimSpace(cmd.Args) + " check deploy status"
+	}
+
+	reminderMu.Lock()
+	count := 0
+	for _, r := range reminders.Items {
+		if r.ChatID == msg.Chat.ID {
+			count++
+		}
+	}
+	if count >= maxRemindersPerChat {
+		reminderMu.Unlock()
+		return fmt.Sprintf("this chat already has %d pending items; cancel one first.", count)
+	}
+	item := reminderItem{
+		ID:        reminders.NextID,
+		ChatID:    msg.Chat.ID,
+		Mode:      mode,
+		Text:      text,
+		DueAt:     due.Format(time.RFC3339),
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	reminders.NextID++
+	reminders.Items = append(reminders.Items, item)
+	err = saveRemindersLocked(cfg)
+	reminderMu.Unlock()
+
+	appendAudit(cfg, auditActor(msg), "reminder_add", map[string]string{
+		"id":      strconv.Itoa(item.ID),
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+		"mode":    mode,
+		"due_at":  item.DueAt,
+	}, auditOutcome(err))
+	if err != nil {
+		return "failed to save: " + err.Error()
+	}
+	what := "the agent will run it"
+	if mode == reminderModeNote {
+		what = "you will be reminded"
+	}
+	return fmt.Sprintf("#%d set for %s (in %s); %s. cancel with /at rm %d", item.ID, due.Format("Mon 01-02 15:04"), formatDelay(due.Sub(now)), what, item.ID)
+}
+
+func formatDelay(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	days := int(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	var parts []string
+	if days > 0 {
+		parts = append(parts, strconv.Itoa(days)+"d")
+	}
+	if h := int(d / time.Hour); h > 0 {
+		parts = append(parts, strconv.Itoa(h)+"h")
+	}
+	if m := int(d % time.Hour / time.Minute); m > 0 {
+		parts = append(parts, strconv.Itoa(m)+"m")
+	}
+	return strings.Join(parts, " ")
+}
+
+func cancelReminder(cfg bridgeConfig, msg telegramMessage, args string) string {
+	id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(args), "#"))
+	if err != nil {
+		return "usage: /at rm <id>. send /at list for the ids."
+	}
+
+	reminderMu.Lock()
+	found := false
+	for i, r := range reminders.Items {
+		if r.ID == id && r.ChatID == msg.Chat.ID {
+			reminders.Items = append(reminders.Items[:i], reminders.Items[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		reminderMu.Unlock()
+		return fmt.Sprintf("no pending item #%d in this chat.", id)
+	}
+	err = saveRemindersLocked(cfg)
+	reminderMu.Unlock()
+
+	appendAudit(cfg, auditActor(msg), "reminder_cancel", map[string]string{
+		"id":      strconv.Itoa(id),
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+	}, auditOutcome(err))
+	if err != nil {
+		return "failed to save: " + err.Error()
+	}
+	return fmt.Sprintf("#%d cancelled.", id)
+}
+
+func listChatReminders(chatID int64) []reminderItem {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+	var out []reminderItem
+	for _, r := range reminders.Items {
+		if r.ChatID == chatID {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].DueAt < out[k].DueAt })
+	return out
+}
+
+func formatReminderList(chatID int64, now time.Time) string {
+	items := listChatReminders(chatID)
+	if len(items) == 0 {
+		return "nothing pending. add one with /at 18:30 <prompt> or /in 2h remind me to <note>"
+	}
+	var b strings.Builder
+	b.WriteString("pending:")
+	for _, r := range items {
+		kind := "run"
+		if r.Mode == reminderModeNote {
+			kind = "note"
+		}
+		due := r.DueAt
+		if t, err := time.Parse(time.RFC3339, r.DueAt); err == nil {
+			due = t.In(now.Location()).Format("Mon 01-02 15:04")
+		}
+		fmt.Fprintf(&b, "\n#%d  %s  [%s]  %s", r.ID, due, kind, sessionTitle(r.Text))
+	}
+	b.WriteString("\ncancel with /at rm <id>")
+	return b.String()
+}
+
+// dueReminders returns the items of the given mode due at now, oldest first.
+// They stay in the store until delivered, so a restart during an agent run
+// repeats it.
+func dueReminders(now time.Time, mode string) []reminderItem {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+	var due []reminderItem
+	for _, r := range reminders.Items {
+		if r.Mode != mode {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, r.DueAt)
+		if err != nil || !t.After(now) {
+			due = append(due, r)
+		}
+	}
+	sort.Slice(due, func(i, k int) bool { return due[i].DueAt < due[k].DueAt })
+	return due
+}
+
+// takeReminder removes a delivered item. It reports false when the item was
+// cancelled in the meantime.
+func takeReminder(cfg bridgeConfig, id int) bool {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+	for i, r := range reminders.Items {
+		if r.ID == id {
+			reminders.Items = append(reminders.Items[:i], reminders.Items[i+1:]...)
+			if err := saveRemindersLocked(cfg); err != nil {
+				log.Printf("[reminder] failed to save reminders: %v", err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func reminderStillPending(id int) bool {
+	reminderMu.Lock()
+	defer reminderMu.Unlock()
+	for _, r := range reminders.Items {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// reminderLateNote marks an item that came due before the bridge started,
+// i.e. while it was down. Items that only waited for the next tick are not
+// late.
+func reminderLateNote(item reminderItem, bridgeStarted time.Time) string {
+	due, err := time.Parse(time.RFC3339, item.DueAt)
+	if err != nil || !due.Before(bridgeStarted) {
+		return ""
+	}
+	return "\n(late: was due " + due.In(bridgeStarted.Location()).Format("Mon 01-02 15:04") + " while the bridge was down)"
+}
+
+// deliverReminder sends a note, or runs a prompt in a fresh session of its
+// own, and records the delivery in the chat log.
+func deliverReminder(ctx context.Context, cfg bridgeConfig, item reminderItem, bridgeStarted time.Time) {
+	if !reminderStillPending(item.ID) {
+		return
+	}
+	late := reminderLateNote(item, bridgeStarted)
+	log.Printf("[reminder] delivering #%d chat_id=%d mode=%s", item.ID, item.ChatID, item.Mode)
+
+	if item.Mode == reminderModeNote {
+		reply := trimForTelegram(item.label()+" "+item.Text+late, cfg.MaxReplyChars)
+		if err := sendMessage(cfg, item.ChatID, reply); err != nil {
+			// Telegram is unreachable; keep the item for the next tick.
+			log.Printf("[reminder] failed to send #%d chat_id=%d: %v", item.ID, item.ChatID, err)
+			return
+		}
+		takeReminder(cfg, item.ID)
+		appendChatLogWithOptions(cfg, telegramMessage{Chat: telegramChat{ID: item.ChatID}}, reply, "reminder_delivered", chatLogOptions{UserText: item.label() + " " + item.Text})
+		return
+	}
+
+	scope := "at-" + strconv.Itoa(item.ID)
+	clearSessionScope(cfg, scope)
+	_, status := runDetachedPrompt(ctx, cfg, detachedRun{
+		ChatID: item.ChatID,
+		Scope:  scope,
+		Label:  item.label(),
+		Header: item.label() + " " + sessionTitle(item.Text) + late,
+		Prompt: item.Text,
+		Tag:    "at",
+	})
+	clearSessionScope(cfg, scope)
+	if status == "interrupted" {
+		return
+	}
+	takeReminder(cfg, item.ID)
+	log.Printf("[reminder] #%d chat_id=%d finished: %s", item.ID, item.ChatID, status)
+}
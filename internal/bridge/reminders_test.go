@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReminderBody(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in, mode, text string
+	}{
+		{"check deploy status", reminderModeAgent, "check deploy status"},
+		{"remind me to call Alex", reminderModeNote, "call Alex"},
+		{"Remind me about the demo", reminderModeNote, "the demo"},
+		{"提醒我：收衣服", reminderModeNote, "收衣服"},
+		{"--note stand up", reminderModeNote, "stand up"},
+		{"--run remind me to summarize the logs", reminderModeAgent, "remind me to summarize the logs"},
+	}
+	for _, tc := range cases {
+		mode, text := parseReminderBody(tc.in)
+		if mode != tc.mode || text != tc.text {
+			t.Fatalf("parseReminderBody(%q) = %q, %q", tc.in, mode, text)
+		}
+	}
+}
+
+func TestParseReminderCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want reminderCommand
+	}{
+		{"/at", reminderCommand{Name: "at", Action: "list"}},
+		{"/in list", reminderCommand{Name: "in", Action: "list"}},
+		{"/at rm 3", reminderCommand{Name: "at", Action: "rm", Args: "3"}},
+		{"/at cancel #4", reminderCommand{Name: "at", Action: "rm", Args: "#4"}},
+		{"/in 2h check", reminderCommand{Name: "in", Action: "add", Args: "2h check"}},
+	}
+	for _, tc := range cases {
+		got, ok := parseReminderCommand(tc.in)
+		if !ok || got != tc.want {
+			t.Fatalf("parseReminderCommand(%q) = %+v, %v", tc.in, got, ok)
+		}
+	}
+	if _, ok := parseReminderCommand("/attach"); ok {
+		t.Fatal("/attach parsed as /at")
+	}
+}
+
+func TestRemindersPersistUntilDelivered(t *testing.T) {
+	cfg := bridgeConfig{ReminderFile: filepath.Join(t.TempDir(), "reminders.json"), MaxReplyChars: 3500}
+	reminders = reminderStoreData{NextID: 1}
+	now := time.Date(2026, 3, 6, 14, 20, 0, 0, time.Local)
+	msg := telegramMessage{Chat: telegramChat{ID: 61}}
+
+	addReminder(cfg, msg, reminderCommand{Name: "in", Args: "10m remind me to stretch"}, now)
+	addReminder(cfg, msg, reminderCommand{Name: "at", Args: "18:00 check deploy"}, now)
+	if err := loadReminders(cfg); err != nil {
+		t.Fatal(err)
+	}
+	items := listChatReminders(61)
+	if len(items) != 2 || items[0].Mode != reminderModeNote || items[0].Text != "stretch" || items[1].Mode != reminderModeAgent {
+		t.Fatalf("items after reload = %+v", items)
+	}
+
+	if due := dueReminders(now.Add(5*time.Minute), reminderModeNote); len(due) != 0 {
+		t.Fatalf("due too early: %+v", due)
+	}
+	if due := dueReminders(now.Add(4*time.Hour), reminderModeNote); len(due) != 1 || due[0].ID != 1 {
+		t.Fatalf("due notes = %+v", due)
+	}
+	if due := dueReminders(now.Add(4*time.Hour), reminderModeAgent); len(due) != 1 || due[0].ID != 2 {
+		t.Fatalf("due agent items = %+v", due)
+	}
+	if !takeReminder(cfg, 1) || takeReminder(cfg, 1) {
+		t.Fatal("takeReminder did not remove the item exactly once")
+	}
+	if reply := cancelReminder(cfg, telegramMessage{Chat: telegramChat{ID: 99}}, "2"); reply != "no pending item #2 in this chat." {
+		t.Fatalf("cancel from another chat: %q", reply)
+	}
+	if err := loadReminders(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if items := listChatReminders(61); len(items) != 1 || items[0].ID != 2 || reminders.NextID != 3 {
+		t.Fatalf("items = %+v next=%d", items, reminders.NextID)
+	}
+}
+
+func TestReminderLateOnlyAfterDowntime(t *testing.T) {
+	t.Parallel()
+	started := time.Date(2026, 3, 6, 14, 0, 0, 0, time.Local)
+	before := reminderItem{DueAt: started.Add(-time.Hour).Format(time.RFC3339)}
+	if note := reminderLateNote(before, started); !strings.Contains(note, "while the bridge was down") {
+		t.Fatalf("item due while down: note = %q", note)
+	}
+	// Due while the bridge was up, even if delivered long after.
+	after := reminderItem{DueAt: started.Add(time.Minute).Format(time.RFC3339)}
+	if note := reminderLateNote(after, started); note != "" {
+		t.Fatalf("item due while up: note = %q", note)
+	}
+}
@@ -0,0 +1,579 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	scheduleSessionFresh     = "fresh"
+	scheduleSessionDedicated = "dedicated"
+
+	scheduleCatchupOnce = "once"
+	scheduleCatchupSkip = "skip"
+
+	maxSchedulesPerChat = 20
+)
+
+// scheduleTickInterval is how often the scheduler looks for due jobs.
+var scheduleTickInterval = 20 * time.Second
+
+// scheduledJob is a prompt run on a cron schedule on behalf of a chat.
+type scheduledJob struct {
+	ID      int    `json:"id"`
+	ChatID  int64  `json:"chat_id"`
+	Cron    string `json:"cron"`
+	Prompt  string `json:"prompt"`
+	Session string `json:"session"`
+	// Times are RFC3339; NextRunAt is the next time the job is due.
+	CreatedAt  string `json:"created_at"`
+	NextRunAt  string `json:"next_run_at"`
+	LastRunAt  string `json:"last_run_at,omitempty"`
+	LastStatus string `json:"last_status,omitempty"`
+}
+
+// sessionScope is the session slot of a job in dedicated session mode.
+func (j scheduledJob) sessionScope() string {
+	return "schedule-" + strconv.Itoa(j.ID)
+}
+
+type scheduleStoreData struct {
+	NextID int            `json:"next_id"`
+	Jobs   []scheduledJob `json:"jobs"`
+}
+
+var (
+	scheduleMu sync.Mutex
+	schedules  = scheduleStoreData{NextID: 1}
+)
+
+func defaultSchedulePath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("SCHEDULE_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "schedules.json")
+}
+
+func loadSchedules(cfg bridgeConfig) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	schedules = scheduleStoreData{NextID: 1}
+	raw, err := readStoreFile(cfg, cfg.ScheduleFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return nil
+	}
+	var parsed scheduleStoreData
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	for _, j := range parsed.Jobs {
+		if j.ID >= parsed.NextID {
+			parsed.NextID = j.ID + 1
+		}
+	}
+	if parsed.NextID < 1 {
+		parsed.NextID = 1
+	}
+	schedules = parsed
+	return nil
+}
+
+func saveSchedulesLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, cfg.ScheduleFile, data)
+}
+
+type scheduleCommand struct {
+	Action string
+	Args   string
+}
+
+func parseScheduleCommand(text string) (scheduleCommand, bool) {
+	text = strings.TrimSpace(text)
+	name, rest, _ := strings.Cut(text, " ")
+	if name != "/schedule" && name != "/schedules" {
+		return scheduleCommand{}, false
+	}
+	action, args, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	switch action {
+	case "", "list", "ls":
+		action = "list"
+	case "rm", "del", "delete", "remove":
+		action = "rm"
+	}
+	return scheduleCommand{Action: action, Args: strings.TrimSpace(args)}, true
+}
+
+// parseScheduleAdd splits the arguments of /schedule add: a quoted cron
+// expression (or a bare @macro), an optional --fresh or --dedicated flag and
+// the prompt.
+func parseScheduleAdd(args string) (expr string, session string, prompt string, err error) {
+	args = strings.TrimSpace(args)
+	switch {
+	case strings.HasPrefix(args, "@"):
+		expr, args, _ = strings.Cut(args, " ")
+	case args != "" && strings.ContainsRune(`"“'`, []rune(args)[0]):
+		open := []rune(args)[0]
+		closeQuote := open
+		if open == '“' {
+			closeQuote = '”'
+		}
+		body := args[len(string(open)):]
+		end := strings.IndexRune(body, closeQuote)
+		if end < 0 {
+			return "", "", "", errors.New("missing closing quote around the cron expression")
+		}
+		expr, args = body[:end], body[end+len(string(closeQuote)):]
+	default:
+		return "", "", "", errors.New(`put the cron expression in quotes, e.g. /schedule add "0 9 * * 1-5" summarize overnight CI failures`)
+	}
+
+	session = scheduleSessionFresh
+	args = strings.TrimSpace(args)
+	if flag, rest, _ := strings.Cut(args, " "); flag == "--fresh" || flag == "--dedicated" {
+		session = strings.TrimPrefix(flag, "--")
+		args = strings.TrimSpace(rest)
+	}
+	if args == "" {
+		return "", "", "", errors.New("the prompt is missing")
+	}
+	return strings.TrimSpace(expr), session, args, nil
+}
+
+func handleScheduleCommand(cfg bridgeConfig, msg telegramMessage, cmd scheduleCommand) {
+	var reply string
+	switch cmd.Action {
+	case "list":
+		reply = formatScheduleList(msg.Chat.ID, time.Now())
+	case "add":
+		reply = addSchedule(cfg, msg, cmd.Args, time.Now())
+	case "rm":
+		reply = removeSchedule(cfg, msg, cmd.Args)
+	default:
+		reply = "usage:\n/schedule add \"<cron>\" [--dedicated] <prompt>\n/schedule list\n/schedule rm <id>"
+	}
+	_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "schedule_"+cmd.Action)
+}
+
+func addSchedule(cfg bridgeConfig, msg telegramMessage, args string, now time.Time) string {
+	expr, session, prompt, err := parseScheduleAdd(args)
+	if err != nil {
+		return "could not add the schedule: " + err.Error()
+	}
+	sched, err := parseCron(expr)
+	if err != nil {
+		return "invalid cron expression: " + err.Error()
+	}
+	next := sched.Next(now)
+	if next.IsZero() {
+		return "the cron expression " + strconv.Quote(expr) + " never matches."
+	}
+
+	scheduleMu.Lock()
+	count := 0
+	for _, j := range schedules.Jobs {
+		if j.ChatID == msg.Chat.ID {
+			count++
+		}
+	}
+	if count >= maxSchedulesPerChat {
+		scheduleMu.Unlock()
+		return fmt.Sprintf("this chat already has %d schedules; remove one first.", count)
+	}
+	job := scheduledJob{
+		ID:        schedules.NextID,
+		ChatID:    msg.Chat.ID,
+		Cron:      expr,
+		Prompt:    prompt,
+		Session:   session,
+		CreatedAt: now.Format(time.RFC3339),
+		NextRunAt: next.Format(time.RFC3339),
+	}
+	schedules.NextID++
+	schedules.Jobs = append(schedules.Jobs, job)
+	err = saveSchedulesLocked(cfg)
+	scheduleMu.Unlock()
+
+	appendAudit(cfg, auditActor(msg), "schedule_add", map[string]string{
+		"id":      strconv.Itoa(job.ID),
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+		"cron":    expr,
+		"session": session,
+	}, auditOutcome(err))
+	if err != nil {
+		return "failed to save the schedule: " + err.Error()
+	}
+	return fmt.Sprintf("schedule #%d added (%s session). next run: %s", job.ID, session, next.Format("Mon 2006-01-02 15:04"))
+}
+
+func removeSchedule(cfg bridgeConfig, msg telegramMessage, args string) string {
+	id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(args), "#"))
+	if err != nil {
+		return "usage: /schedule rm <id>. send /schedule list for the ids."
+	}
+
+	scheduleMu.Lock()
+	var removed *scheduledJob
+	for i, j := range schedules.Jobs {
+		if j.ID == id && j.ChatID == msg.Chat.ID {
+			job := j
+			removed = &job
+			schedules.Jobs = append(schedules.Jobs[:i], schedules.Jobs[i+1:]...)
+			break
+		}
+	}
+	if removed == nil {
+		scheduleMu.Unlock()
+		return fmt.Sprintf("no schedule #%d in this chat.", id)
+	}
+	err = saveSchedulesLocked(cfg)
+	scheduleMu.Unlock()
+
+	clearSessionScope(cfg, removed.sessionScope())
+	appendAudit(cfg, auditActor(msg), "schedule_rm", map[string]string{
+		"id":      strconv.Itoa(id),
+		"chat_id": strconv.FormatInt(msg.Chat.ID, 10),
+	}, auditOutcome(err))
+	if err != nil {
+		return "failed to save schedules: " + err.Error()
+	}
+	return fmt.Sprintf("schedule #%d removed.", id)
+}
+
+func listChatSchedules(chatID int64) []scheduledJob {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	var out []scheduledJob
+	for _, j := range schedules.Jobs {
+		if j.ChatID == chatID {
+			out = append(out, j)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].ID < out[k].ID })
+	return out
+}
+
+func formatScheduleList(chatID int64, now time.Time) string {
+	jobs := listChatSchedules(chatID)
+	if len(jobs) == 0 {
+		return "no schedules. add one with /schedule add \"<cron>\" <prompt>"
+	}
+	var b strings.Builder
+	b.WriteString("schedules (times are " + now.Format("MST") + "):")
+	for _, j := range jobs {
+		fmt.Fprintf(&b, "\n#%d  %s  [%s]\n    %s", j.ID, j.Cron, j.Session, sessionTitle(j.Prompt))
+		if next, err := time.Parse(time.RFC3339, j.NextRunAt); err == nil {
+			b.WriteString("\n    next: " + next.In(now.Location()).Format("Mon 01-02 15:04"))
+		}
+		if j.LastRunAt != "" {
+			if last, err := time.Parse(time.RFC3339, j.LastRunAt); err == nil {
+				b.WriteString(", last: " + last.In(now.Location()).Format("Mon 01-02 15:04") + " " + j.LastStatus)
+			}
+		}
+	}
+	b.WriteString("\nremove with /schedule rm <id>")
+	return b.String()
+}
+
+// scheduledRun is a due job together with the runs it missed.
+type scheduledRun struct {
+	Job    scheduledJob
+	Missed int
+}
+
+// dueSchedules returns the jobs due at now. A job is only advanced to its
+// next run when it actually starts (see beginScheduledRun), so a due job that
+// never got to run is still due after a restart. Runs whose time passed
+// before the bridge started were missed; they are coalesced into one run, or
+// dropped with SCHEDULE_CATCHUP=skip. A job that is merely late because an
+// earlier job ran long is not counted as missed.
+func dueSchedules(cfg bridgeConfig, now, bridgeStarted time.Time) []scheduledRun {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	var due []scheduledRun
+	changed := false
+	for i, j := range schedules.Jobs {
+		nextAt, err := time.Parse(time.RFC3339, j.NextRunAt)
+		if err == nil && nextAt.After(now) {
+			continue
+		}
+		sched, perr := parseCron(j.Cron)
+		if perr != nil {
+			log.Printf("[schedule] job %d has an invalid cron expression %q: %v", j.ID, j.Cron, perr)
+			continue
+		}
+		if err != nil {
+			changed = true
+			schedules.Jobs[i].NextRunAt = sched.Next(now).Format(time.RFC3339)
+			continue
+		}
+		missed := 0
+		for t := nextAt; !t.IsZero() && t.Before(bridgeStarted) && missed < 1000; t = sched.Next(t) {
+			missed++
+		}
+		if missed > 0 && cfg.ScheduleCatchup == scheduleCatchupSkip {
+			log.Printf("[schedule] skipping missed run of job %d chat_id=%d due=%s", j.ID, j.ChatID, j.NextRunAt)
+			changed = true
+			schedules.Jobs[i].NextRunAt = sched.Next(now).Format(time.RFC3339)
+			schedules.Jobs[i].LastStatus = "skipped (missed)"
+			continue
+		}
+		due = append(due, scheduledRun{Job: j, Missed: missed})
+	}
+	if changed {
+		if err := saveSchedulesLocked(cfg); err != nil {
+			log.Printf("[schedule] failed to save schedules: %v", err)
+		}
+	}
+	return due
+}
+
+// beginScheduledRun advances a job that is about to start to its next run
+// after now. It reports false when the job was removed in the meantime.
+func beginScheduledRun(cfg bridgeConfig, id int, now time.Time) bool {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	for i := range schedules.Jobs {
+		if schedules.Jobs[i].ID != id {
+			continue
+		}
+		sched, err := parseCron(schedules.Jobs[i].Cron)
+		if err != nil {
+			return false
+		}
+		schedules.Jobs[i].NextRunAt = sched.Next(now).Format(time.RFC3339)
+		if err := saveSchedulesLocked(cfg); err != nil {
+			log.Printf("[schedule] failed to save schedules: %v", err)
+		}
+		return true
+	}
+	return false
+}
+
+// finishScheduledRun records the outcome of a run. An interrupted run is made
+// due again at once, so the missed-run catch-up repeats it after a restart.
+func finishScheduledRun(cfg bridgeConfig, id int, at time.Time, status string) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	for i := range schedules.Jobs {
+		if schedules.Jobs[i].ID == id {
+			schedules.Jobs[i].LastRunAt = at.Format(time.RFC3339)
+			schedules.Jobs[i].LastStatus = status
+			if status == "interrupted" {
+				schedules.Jobs[i].NextRunAt = at.Format(time.RFC3339)
+			}
+			if err := saveSchedulesLocked(cfg); err != nil {
+				log.Printf("[schedule] failed to save schedules: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// runScheduledJob runs one job through runAgent in its own session slot and
+// posts the result to the job's chat.
+func runScheduledJob(ctx context.Context, cfg bridgeConfig, run scheduledRun) {
+	job := run.Job
+	if !beginScheduledRun(cfg, job.ID, time.Now()) {
+		return
+	}
+	scope := job.sessionScope()
+	if job.Session != scheduleSessionDedicated {
+		clearSessionScope(cfg, scope)
+	}
+	log.Printf("[schedule] running job %d chat_id=%d session=%s missed=%d", job.ID, job.ChatID, job.Session, run.Missed)
+	started := time.Now()
+	label := fmt.Sprintf("[schedule #%d]", job.ID)
+	header := label + " " + sessionTitle(job.Prompt)
+	if run.Missed > 0 {
+		header += fmt.Sprintf("\n(the bridge was down; this run catches up on %d missed run(s))", run.Missed)
+	}
+	_, status := runDetachedPrompt(ctx, cfg, detachedRun{
+		ChatID: job.ChatID,
+		Scope:  scope,
+		Label:  label,
+		Header: header,
+		Prompt: job.Prompt,
+		Tag:    "schedule",
+	})
+	if job.Session != scheduleSessionDedicated {
+		clearSessionScope(cfg, scope)
+	}
+	finishScheduledRun(cfg, job.ID, started, status)
+	log.Printf("[schedule] job %d chat_id=%d finished in %s: %s", job.ID, job.ChatID, time.Since(started).Truncate(time.Second), status)
+}
+
+// detachedRun is an agent run started by the bridge itself rather than by a
+// message waiting in the chat's queue.
+type detachedRun struct {
+	ChatID int64
+	// Scope is the session slot the run uses beside the chat's own.
+	Scope string
+	// Label, e.g. "[schedule #3]", marks the run in the chat and chat log;
+	// Header is the first part of the reply.
+	Label  string
+	Header string
+	Prompt string
+	// Tag prefixes the chat log tags, e.g. "schedule" for schedule_output.
+	Tag string
+}
+
+// runDetachedPrompt runs r through runAgent and posts the reply to r.ChatID.
+// It returns the reply and a one-line status: "ok", "interrupted" or the
+// error.
+func runDetachedPrompt(ctx context.Context, cfg bridgeConfig, r detachedRun) (string, string) {
+	out, _, err := runAgent(withSessionScope(ctx, r.Scope), cfg, r.ChatID, r.Prompt, nil)
+	resp, detailsID, status, tag := detachedReply(ctx, cfg, r, out, err)
+	sendAgentErrorReply(cfg, r.ChatID, resp, detailsID)
+	appendChatLogWithOptions(cfg, telegramMessage{Chat: telegramChat{ID: r.ChatID}}, resp, tag, chatLogOptions{UserText: r.Label + " " + r.Prompt})
+	return resp, status
+}
+
+// detachedReply builds the chat reply for a finished detached run along with
+// the Details button ID, the run's status and the chat log tag.
+func detachedReply(ctx context.Context, cfg bridgeConfig, r detachedRun, out string, err error) (resp string, detailsID string, status string, tag string) {
+	status, tag = "ok", r.Tag+"_output"
+	switch {
+	case isShutdownCancel(ctx):
+		resp = r.Header + "\n\n" + interruptedReply(cfg, out)
+		status, tag = "interrupted", "interrupted"
+	case errors.Is(err, errRunCancelled):
+		resp = r.Header + "\n\n" + cancelledReply(cfg, out)
+		status, tag = "cancelled", "cancelled"
+	case isAgentError(err):
+		var friendly string
+		friendly, detailsID = agentErrorReply(cfg, err, out)
+		resp = r.Header + "\n\n" + friendly
+		status, tag = firstLine(auditOutcome(err)), r.Tag+"_error"
+	case err != nil:
+		resp = r.Header + "\n\nagent error:\n" + err.Error()
+		status, tag = firstLine(auditOutcome(err)), r.Tag+"_error"
+	default:
+		if strings.TrimSpace(out) == "" {
+			out = "(no output)"
+		}
+		resp = r.Header + "\n\n" + out
+	}
+	return trimForTelegram(resp, cfg.MaxReplyChars), detailsID, status, tag
+}
+
+// scheduler delivers due /at and /in items and runs due scheduled jobs in the
+// background. Notes have a loop of their own, so they never wait behind an
+// agent run; agent items and scheduled jobs run one at a time.
+type scheduler struct {
+	cfg    bridgeConfig
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	done   chan struct{}
+	// started is when the bridge came up; items due before it were missed
+	// while the bridge was down.
+	started time.Time
+}
+
+func startScheduler(cfg bridgeConfig) *scheduler {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s := &scheduler{cfg: cfg, ctx: ctx, cancel: cancel, stop: make(chan struct{}), done: make(chan struct{}), started: time.Now()}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.loop(s.deliverNotes)
+	}()
+	go func() {
+		defer wg.Done()
+		s.loop(s.runAgentWork)
+	}()
+	go func() {
+		wg.Wait()
+		close(s.done)
+	}()
+	return s
+}
+
+// loop calls tick at once and then every scheduleTickInterval until Shutdown.
+func (s *scheduler) loop(tick func()) {
+	ticker := time.NewTicker(scheduleTickInterval)
+	defer ticker.Stop()
+	for {
+		tick()
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *scheduler) deliverNotes() {
+	for _, item := range dueReminders(time.Now(), reminderModeNote) {
+		if s.stopping() {
+			return
+		}
+		deliverReminder(s.ctx, s.cfg, item, s.started)
+	}
+}
+
+func (s *scheduler) runAgentWork() {
+	for _, item := range dueReminders(time.Now(), reminderModeAgent) {
+		if s.stopping() {
+			return
+		}
+		deliverReminder(s.ctx, s.cfg, item, s.started)
+	}
+	for _, run := range dueSchedules(s.cfg, time.Now(), s.started) {
+		if s.stopping() {
+			return
+		}
+		runScheduledJob(s.ctx, s.cfg, run)
+	}
+}
+
+func (s *scheduler) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops starting jobs and waits up to timeout for a running one
+// before cancelling it.
+func (s *scheduler) Shutdown(timeout time.Duration) {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return
+	case <-time.After(timeout):
+	}
+	log.Printf("shutdown: cancelling running scheduled job")
+	s.cancel(errBridgeShutdown)
+	select {
+	case <-s.done:
+	case <-time.After(10 * time.Second):
+		log.Printf("shutdown: scheduled job still running after cancellation; giving up")
+	}
+}
@@ -0,0 +1,129 @@
+package bridge
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleAdd(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		args, expr, session, prompt string
+	}{
+		{`"0 9 * * 1-5" summarize overnight CI failures`, "0 9 * * 1-5", "fresh", "summarize overnight CI failures"},
+		{`“*/30 * * * *” --dedicated check the deploy`, "*/30 * * * *", "dedicated", "check the deploy"},
+		{`@daily --fresh report`, "@daily", "fresh", "report"},
+	}
+	for _, tc := range cases {
+		expr, session, prompt, err := parseScheduleAdd(tc.args)
+		if err != nil || expr != tc.expr || session != tc.session || prompt != tc.prompt {
+			t.Fatalf("parseScheduleAdd(%q) = %q, %q, %q, %v", tc.args, expr, session, prompt, err)
+		}
+	}
+	for _, args := range []string{`0 9 * * * report`, `"0 9 * * * report`, `"0 9 * * *"`} {
+		if _, _, _, err := parseScheduleAdd(args); err == nil {
+			t.Fatalf("parseScheduleAdd(%q) succeeded", args)
+		}
+	}
+}
+
+func TestDueSchedulesCoalescesMissedRuns(t *testing.T) {
+	cfg := bridgeConfig{ScheduleFile: filepath.Join(t.TempDir(), "schedules.json"), ScheduleCatchup: scheduleCatchupOnce}
+	now := time.Date(2026, 3, 6, 12, 0, 10, 0, time.Local)
+	started := now.Add(-5 * time.Second)
+	schedules = scheduleStoreData{NextID: 5, Jobs: []scheduledJob{
+		// Due at 09:00, three hourly runs missed during downtime.
+		{ID: 1, ChatID: 5, Cron: "0 * * * *", Prompt: "a", NextRunAt: now.Add(-3*time.Hour - 10*time.Second).Format(time.RFC3339)},
+		// Due this minute: an ordinary run.
+		{ID: 2, ChatID: 5, Cron: "* * * * *", Prompt: "b", NextRunAt: now.Add(-2 * time.Second).Format(time.RFC3339)},
+		{ID: 3, ChatID: 5, Cron: "0 * * * *", Prompt: "c", NextRunAt: now.Add(time.Hour).Format(time.RFC3339)},
+	}}
+
+	due := dueSchedules(cfg, now, started)
+	if len(due) != 2 || due[0].Job.ID != 1 || due[0].Missed != 4 || due[1].Job.ID != 2 || due[1].Missed != 0 {
+		t.Fatalf("due = %+v", due)
+	}
+	// Nothing is advanced until a job starts, so a crash before then keeps
+	// the run due.
+	if len(dueSchedules(cfg, now, started)) != 2 {
+		t.Fatal("due jobs were advanced before they started")
+	}
+	if !beginScheduledRun(cfg, 1, now) {
+		t.Fatal("beginScheduledRun did not find job 1")
+	}
+	if due := dueSchedules(cfg, now, started); len(due) != 1 || due[0].Job.ID != 2 {
+		t.Fatalf("started job is still due: %+v", due)
+	}
+	if err := loadSchedules(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := schedules.Jobs[0].NextRunAt; got != time.Date(2026, 3, 6, 13, 0, 0, 0, time.Local).Format(time.RFC3339) {
+		t.Fatalf("next run of job 1 = %s", got)
+	}
+	if beginScheduledRun(cfg, 99, now) {
+		t.Fatal("beginScheduledRun started a removed job")
+	}
+
+	cfg.ScheduleCatchup = scheduleCatchupSkip
+	schedules.Jobs[0].NextRunAt = now.Add(-time.Hour).Format(time.RFC3339)
+	if due := dueSchedules(cfg, now, started); len(due) != 1 || due[0].Job.ID != 2 || schedules.Jobs[0].LastStatus != "skipped (missed)" {
+		t.Fatalf("skip policy ran %+v, status %q", due, schedules.Jobs[0].LastStatus)
+	}
+}
+
+func TestDueSchedulesLateWhileRunningIsNotMissed(t *testing.T) {
+	cfg := bridgeConfig{ScheduleFile: filepath.Join(t.TempDir(), "schedules.json"), ScheduleCatchup: scheduleCatchupSkip}
+	now := time.Date(2026, 3, 6, 12, 30, 0, 0, time.Local)
+	// The bridge has been up for hours; the job is only late because an
+	// earlier job ran for half an hour.
+	started := now.Add(-5 * time.Hour)
+	schedules = scheduleStoreData{NextID: 2, Jobs: []scheduledJob{
+		{ID: 1, ChatID: 5, Cron: "0 * * * *", Prompt: "a", NextRunAt: now.Add(-30 * time.Minute).Format(time.RFC3339)},
+	}}
+	due := dueSchedules(cfg, now, started)
+	if len(due) != 1 || due[0].Missed != 0 || schedules.Jobs[0].LastStatus != "" {
+		t.Fatalf("late job treated as missed: %+v, status %q", due, schedules.Jobs[0].LastStatus)
+	}
+}
+
+func TestScopedSessionLeavesChatSessionAlone(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:    "generic",
+		AgentProviders:   []string{"generic"},
+		AgentBin:         "/bin/sh",
+		AgentArgs:        `-c 'cat' sh`,
+		AgentPromptMode:  promptModeStdin,
+		SessionStoreFile: filepath.Join(dir, "sessions.json"),
+		CodexWorkdir:     dir,
+		MemoryFile:       "MEMORY.md",
+		TimeoutSec:       10,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	setChatSessionID(cfg, "generic", 51, "chat-sid")
+
+	job := scheduledJob{ID: 9, ChatID: 51}
+	ctx := withSessionScope(context.Background(), job.sessionScope())
+	if _, _, err := runAgent(ctx, cfg, 51, "report", nil); err != nil {
+		t.Fatalf("runAgent: %v", err)
+	}
+	scoped := getRunSessionID(ctx, "generic", 51)
+	if scoped == "" || scoped == "chat-sid" {
+		t.Fatalf("scoped session = %q", scoped)
+	}
+	if sid := getChatSessionID("generic", 51); sid != "chat-sid" {
+		t.Fatalf("chat session changed to %q", sid)
+	}
+
+	clearSessionScope(cfg, job.sessionScope())
+	if sid := getRunSessionID(ctx, "generic", 51); sid != "" {
+		t.Fatalf("scoped session survived: %q", sid)
+	}
+	if sid := getChatSessionID("generic", 51); sid != "chat-sid" {
+		t.Fatalf("clearing the scope removed the chat session: %q", sid)
+	}
+}
@@ -0,0 +1,442 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxSessionHistoryPerChat = 30
+	maxSessionTitleRunes     = 48
+	sessionResumeCallback    = "resume:"
+)
+
+// sessionHistoryEntry remembers one agent session a chat has used, so it can
+// be resumed after /newsession or a provider switch.
+type sessionHistoryEntry struct {
+	Provider   string `json:"provider"`
+	SessionID  string `json:"session_id"`
+	Title      string `json:"title,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Workdir    string `json:"workdir,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	// ContextHash and Turns are the session's sessionRecord fields as of its
+	// last turn, restored on /resume together with CreatedAt.
+	ContextHash string `json:"context_hash,omitempty"`
+	Turns       int    `json:"turns,omitempty"`
+}
+
+func (e sessionHistoryEntry) label() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	if e.Title != "" {
+		return e.Title
+	}
+	return "(untitled)"
+}
+
+var (
+	sessionHistoryMu sync.RWMutex
+	// sessionHistory is keyed by chat ID.
+	sessionHistory = map[string][]sessionHistoryEntry{}
+)
+
+func defaultSessionHistoryPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("SESSION_HISTORY_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "session-history.json")
+}
+
+func loadSessionHistory(cfg bridgeConfig) error {
+	sessionHistoryMu.Lock()
+	defer sessionHistoryMu.Unlock()
+
+	raw, err := readStoreFile(cfg, cfg.SessionHistoryFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			sessionHistory = map[string][]sessionHistoryEntry{}
+			return nil
+		}
+		return err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		sessionHistory = map[string][]sessionHistoryEntry{}
+		return nil
+	}
+	var parsed map[string][]sessionHistoryEntry
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	if parsed == nil {
+		parsed = map[string][]sessionHistoryEntry{}
+	}
+	sessionHistory = parsed
+	return nil
+}
+
+func saveSessionHistoryLocked(cfg bridgeConfig) error {
+	data, err := json.MarshalIndent(sessionHistory, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStoreFileAtomic(cfg, cfg.SessionHistoryFile, data)
+}
+
+// sessionTitle derives a title from the first line of the prompt that
+// started a session.
+func sessionTitle(prompt string) string {
+	title := strings.TrimSpace(prompt)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	if utf8.RuneCountInString(title) > maxSessionTitleRunes {
+		runes := []rune(title)
+		title = strings.TrimSpace(string(runes[:maxSessionTitleRunes])) + "…"
+	}
+	return title
+}
+
+// recordSessionUse adds sid to the chat's history, or bumps its last use.
+// The prompt only matters for a new entry, where it becomes the title; an
+// empty contextHash keeps the one already stored. While sid is bound to the
+// chat, its turn count and creation time are copied from the session store.
+func recordSessionUse(cfg bridgeConfig, provider string, chatID int64, sid string, prompt string, contextHash string) {
+	if strings.TrimSpace(cfg.SessionHistoryFile) == "" || sid == "" {
+		return
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	key := strconv.FormatInt(chatID, 10)
+	rec, bound := getChatSession(provider, chatID)
+	bound = bound && rec.SessionID == sid
+
+	sessionHistoryMu.Lock()
+	defer sessionHistoryMu.Unlock()
+	entries := append([]sessionHistoryEntry(nil), sessionHistory[key]...)
+	found := false
+	for i := range entries {
+		if entries[i].Provider == provider && entries[i].SessionID == sid {
+			entries[i].LastUsedAt = now
+			if contextHash != "" {
+				entries[i].ContextHash = contextHash
+			}
+			if bound {
+				entries[i].Turns = rec.Turns
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		entry := sessionHistoryEntry{
+			Provider:    provider,
+			SessionID:   sid,
+			Title:       sessionTitle(prompt),
+			Workdir:     cfg.CodexWorkdir,
+			CreatedAt:   now,
+			LastUsedAt:  now,
+			ContextHash: contextHash,
+		}
+		if bound {
+			entry.Turns = rec.Turns
+			if rec.CreatedAt != "" {
+				entry.CreatedAt = rec.CreatedAt
+			}
+		}
+		entries = append(entries, entry)
+		if len(entries) > maxSessionHistoryPerChat {
+			sortSessionsByLastUse(entries)
+			entries = entries[:maxSessionHistoryPerChat]
+		}
+	}
+	sessionHistory[key] = entries
+	if err := saveSessionHistoryLocked(cfg); err != nil {
+		log.Printf("failed to save session history: %v", err)
+	}
+}
+
+func sortSessionsByLastUse(entries []sessionHistoryEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, entries[i].LastUsedAt)
+		tj, _ := time.Parse(time.RFC3339Nano, entries[j].LastUsedAt)
+		return ti.After(tj)
+	})
+}
+
+// listChatSessions returns the chat's sessions, most recently used first.
+// /sessions numbers them in this order.
+func listChatSessions(chatID int64) []sessionHistoryEntry {
+	sessionHistoryMu.RLock()
+	entries := append([]sessionHistoryEntry(nil), sessionHistory[strconv.FormatInt(chatID, 10)]...)
+	sessionHistoryMu.RUnlock()
+	sortSessionsByLastUse(entries)
+	return entries
+}
+
+// findChatSession resolves a /sessions number, a session ID or a unique
+// session ID prefix.
+func findChatSession(chatID int64, ref string) (sessionHistoryEntry, error) {
+	entries := listChatSessions(chatID)
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), "#")
+	// Exact IDs win over list numbers, since generic sessions may be numeric.
+	for _, e := range entries {
+		if e.SessionID == ref {
+			return e, nil
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(entries) {
+		return entries[n-1], nil
+	}
+	var matches []sessionHistoryEntry
+	for _, e := range entries {
+		if ref != "" && strings.HasPrefix(e.SessionID, ref) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return sessionHistoryEntry{}, fmt.Errorf("no session %q. send /sessions for the list", ref)
+	default:
+		return sessionHistoryEntry{}, fmt.Errorf("%q matches %d sessions; use more characters", ref, len(matches))
+	}
+}
+
+func renameChatSession(cfg bridgeConfig, chatID int64, provider string, sid string, name string) error {
+	key := strconv.FormatInt(chatID, 10)
+	sessionHistoryMu.Lock()
+	defer sessionHistoryMu.Unlock()
+	entries := append([]sessionHistoryEntry(nil), sessionHistory[key]...)
+	for i := range entries {
+		if entries[i].Provider == provider && entries[i].SessionID == sid {
+			entries[i].Name = name
+			sessionHistory[key] = entries
+			return saveSessionHistoryLocked(cfg)
+		}
+	}
+	return fmt.Errorf("session %s is not in this chat's history yet", sid)
+}
+
+type sessionCommand struct {
+	Name string
+	Args string
+}
+
+func parseSessionCommand(text string) (sessionCommand, bool) {
+	text = strings.TrimSpace(text)
+	name, args, _ := strings.Cut(text, " ")
+	switch name {
+	case "/sessions", "/resume", "/rename":
+		return sessionCommand{Name: strings.TrimPrefix(name, "/"), Args: strings.TrimSpace(args)}, true
+	}
+	return sessionCommand{}, false
+}
+
+func handleSessionCommand(cfg bridgeConfig, msg telegramMessage, cmd sessionCommand) {
+	chatID := msg.Chat.ID
+	var reply string
+	switch cmd.Name {
+	case "sessions":
+		text, keyboard := formatSessionList(cfg, chatID)
+		if len(keyboard.InlineKeyboard) > 0 {
+			if _, err := sendMessageWithKeyboard(cfg, chatID, trimForTelegram(text, cfg.MaxReplyChars), keyboard); err == nil {
+				appendChatLog(cfg, msg, text, "sessions")
+				return
+			}
+		}
+		reply = text
+	case "resume":
+		if cmd.Args == "" {
+			reply = "usage: /resume <n|session id>. send /sessions for the list."
+			break
+		}
+		reply = resumeChatSession(cfg, msg, cmd.Args)
+	case "rename":
+		reply = handleRenameSession(cfg, msg, cmd.Args)
+	}
+	_ = sendMessage(cfg, chatID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, cmd.Name)
+}
+
+func formatSessionList(cfg bridgeConfig, chatID int64) (string, telegramInlineKeyboard) {
+	entries := listChatSessions(chatID)
+	keyboard := telegramInlineKeyboard{}
+	if len(entries) == 0 {
+		return "no sessions yet.", keyboard
+	}
+	provider := chatProvider(cfg, chatID)
+	current := getChatSessionID(provider, chatID)
+	var b strings.Builder
+	b.WriteString("sessions (most recent first):")
+	var row []telegramInlineButton
+	for i, e := range entries {
+		marker := "  "
+		if e.Provider == provider && e.SessionID == current {
+			marker = "* "
+		}
+		fmt.Fprintf(&b, "\n%s%d. %s\n   %s %s, last used %s", marker, i+1, e.label(), e.Provider, shortSessionID(e.SessionID), formatSessionTime(e.LastUsedAt))
+		if e.Workdir != "" && e.Workdir != cfg.CodexWorkdir {
+			b.WriteString(", workdir " + e.Workdir)
+		}
+		data := sessionResumeCallback + e.Provider + ":" + e.SessionID
+		if i < 10 && marker == "  " && len(data) <= 64 {
+			row = append(row, telegramInlineButton{Text: strconv.Itoa(i + 1), CallbackData: data})
+			if len(row) == 5 {
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+				row = nil
+			}
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	b.WriteString("\n\nresume with /resume <n> or a button; label with /rename [n] <name>")
+	return b.String(), keyboard
+}
+
+func shortSessionID(sid string) string {
+	if len(sid) > 13 {
+		return sid[:13]
+	}
+	return sid
+}
+
+func formatSessionTime(ts string) string {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ts
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// resumeChatSession binds the chat to a session from its history, switching
+// provider when the session belongs to another one.
+func resumeChatSession(cfg bridgeConfig, msg telegramMessage, ref string) string {
+	chatID := msg.Chat.ID
+	entry, err := findChatSession(chatID, ref)
+	if err != nil {
+		return err.Error()
+	}
+	return bindChatSession(cfg, msg, entry)
+}
+
+func bindChatSession(cfg bridgeConfig, msg telegramMessage, entry sessionHistoryEntry) string {
+	chatID := msg.Chat.ID
+	if !isConfiguredProvider(cfg, entry.Provider) {
+		return "session " + shortSessionID(entry.SessionID) + " belongs to provider " + entry.Provider + ", which is no longer configured."
+	}
+	var err error
+	if entry.Provider != chatProvider(cfg, chatID) {
+		err = updateChatSettings(cfg, chatID, func(s *chatSettings) {
+			s.Provider = entry.Provider
+			if entry.Provider == cfg.AgentProvider {
+				s.Provider = ""
+			}
+		})
+	}
+	if err == nil {
+		bindResumedSession(cfg, chatID, entry)
+		recordSessionUse(cfg, entry.Provider, chatID, entry.SessionID, "", "")
+	}
+	appendAudit(cfg, auditActor(msg), "session_resume", map[string]string{
+		"provider":   entry.Provider,
+		"session_id": entry.SessionID,
+		"chat_id":    strconv.FormatInt(chatID, 10),
+	}, auditOutcome(err))
+	if err != nil {
+		return "failed to resume session: " + err.Error()
+	}
+	reply := "resumed " + entry.Provider + " session " + shortSessionID(entry.SessionID) + ": " + entry.label()
+	if entry.Workdir != "" && entry.Workdir != cfg.CodexWorkdir {
+		reply += "\nnote: it was started in " + entry.Workdir + ", the current workdir is " + cfg.CodexWorkdir + "."
+	}
+	return reply
+}
+
+// bindResumedSession points the chat's slot at entry's session, carrying its
+// context hash over so memory or instruction edits made since its last turn
+// are sent into it, and its turn count and creation time so SESSION_MAX_TURNS
+// still counts the turns it had. A run still going in the chat notices the
+// slot changed and leaves it alone (see recordSessionTurn).
+func bindResumedSession(cfg bridgeConfig, chatID int64, entry sessionHistoryEntry) {
+	sessionMu.Lock()
+	key := sessionKey(entry.Provider, chatID)
+	alreadyBound := chatSessions[key].SessionID == entry.SessionID
+	rec := bindSessionLocked(cfg, key, entry.Provider, chatID, entry.SessionID, time.Now().Format(time.RFC3339))
+	if !alreadyBound {
+		rec.ContextHash = entry.ContextHash
+		rec.Turns = entry.Turns
+		if created, err := time.Parse(time.RFC3339Nano, entry.CreatedAt); err == nil {
+			rec.CreatedAt = created.Format(time.RFC3339)
+		}
+	}
+	chatSessions[key] = rec
+	err := saveSessionsLocked(cfg)
+	sessionMu.Unlock()
+	if err != nil {
+		log.Printf("failed to save session store: %v", err)
+	}
+}
+
+func handleRenameSession(cfg bridgeConfig, msg telegramMessage, args string) string {
+	chatID := msg.Chat.ID
+	if args == "" {
+		return "usage: /rename <name> for the current session, or /rename <n> <name>."
+	}
+	provider := chatProvider(cfg, chatID)
+	sid := getChatSessionID(provider, chatID)
+	name := args
+	if first, rest, ok := strings.Cut(args, " "); ok {
+		if _, err := strconv.Atoi(first); err == nil {
+			entry, err := findChatSession(chatID, first)
+			if err != nil {
+				return err.Error()
+			}
+			provider, sid, name = entry.Provider, entry.SessionID, strings.TrimSpace(rest)
+		}
+	}
+	if sid == "" {
+		return "no current session to rename."
+	}
+	if utf8.RuneCountInString(name) > maxSessionTitleRunes {
+		name = string([]rune(name)[:maxSessionTitleRunes])
+	}
+	if err := renameChatSession(cfg, chatID, provider, sid, name); err != nil {
+		return "failed to rename: " + err.Error()
+	}
+	return "session " + shortSessionID(sid) + " renamed to " + strconv.Quote(name) + "."
+}
+
+func handleSessionResumeCallback(cfg bridgeConfig, cq telegramCallbackQuery, ref string) {
+	chatID := cq.Message.Chat.ID
+	provider, sid, _ := strings.Cut(ref, ":")
+	msg := telegramMessage{From: cq.From, Chat: cq.Message.Chat}
+	var reply string
+	found := false
+	for _, e := range listChatSessions(chatID) {
+		if e.Provider == provider && e.SessionID == sid {
+			reply = bindChatSession(cfg, msg, e)
+			found = true
+			break
+		}
+	}
+	if !found {
+		_ = answerCallbackQuery(cfg, cq.ID, "session not found.")
+		return
+	}
+	_ = answerCallbackQuery(cfg, cq.ID, "")
+	_ = sendMessage(cfg, chatID, reply)
+	appendChatLog(cfg, msg, reply, "resume")
+}
@@ -0,0 +1,115 @@
+package bridge
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionTitle(t *testing.T) {
+	t.Parallel()
+
+	if got := sessionTitle("  fix the flaky test\nmore details"); got != "fix the flaky test" {
+		t.Fatalf("title = %q", got)
+	}
+	long := strings.Repeat("界", 60)
+	if got := sessionTitle(long); got != strings.Repeat("界", maxSessionTitleRunes)+"…" {
+		t.Fatalf("long title = %q", got)
+	}
+}
+
+func TestSessionHistoryResumeAndRename(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:      "codex",
+		AgentProviders:     []string{"codex", "claude"},
+		CodexWorkdir:       dir,
+		SessionStoreFile:   filepath.Join(dir, "sessions.json"),
+		SessionHistoryFile: filepath.Join(dir, "session-history.json"),
+		ChatSettingsFile:   filepath.Join(dir, "chat-settings.json"),
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	sessionHistory = map[string][]sessionHistoryEntry{}
+
+	recordSessionUse(cfg, "codex", 7, "aaaa-1111", "first task\nwith details", "")
+	recordSessionUse(cfg, "claude", 7, "bbbb-2222", "second task", "hash-b")
+	recordSessionUse(cfg, "codex", 7, "aaaa-1111", "ignored for existing entries", "")
+
+	sessionHistory = map[string][]sessionHistoryEntry{}
+	if err := loadSessionHistory(cfg); err != nil {
+		t.Fatalf("loadSessionHistory: %v", err)
+	}
+	entries := listChatSessions(7)
+	if len(entries) != 2 || entries[0].Title != "first task" || entries[0].Workdir != dir {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if got := listChatSessions(8); len(got) != 0 {
+		t.Fatalf("other chat sees %d sessions", len(got))
+	}
+
+	msg := telegramMessage{Chat: telegramChat{ID: 7}}
+	reply := resumeChatSession(cfg, msg, "bbbb")
+	if !strings.Contains(reply, "resumed claude session") {
+		t.Fatalf("resume reply = %q", reply)
+	}
+	if p := chatProvider(cfg, 7); p != "claude" {
+		t.Fatalf("provider after resume = %q", p)
+	}
+	// The resumed session still gets memory edits made since its last turn.
+	if rec, _ := getChatSession("claude", 7); rec.SessionID != "bbbb-2222" || rec.ContextHash != "hash-b" {
+		t.Fatalf("claude session = %+v", rec)
+	}
+
+	if reply := handleRenameSession(cfg, msg, "release notes"); !strings.Contains(reply, "renamed") {
+		t.Fatalf("rename reply = %q", reply)
+	}
+	if reply := handleRenameSession(cfg, msg, "2 old work"); !strings.Contains(reply, "renamed") {
+		t.Fatalf("rename by number reply = %q", reply)
+	}
+	text, keyboard := formatSessionList(cfg, 7)
+	if !strings.Contains(text, "release notes") || !strings.Contains(text, "old work") || !strings.Contains(text, "* ") {
+		t.Fatalf("list = %q", text)
+	}
+	// The current session has no resume button.
+	if len(keyboard.InlineKeyboard) != 1 || len(keyboard.InlineKeyboard[0]) != 1 {
+		t.Fatalf("keyboard = %+v", keyboard)
+	}
+	if _, err := findChatSession(7, "zzzz"); err == nil {
+		t.Fatal("unknown session resolved")
+	}
+}
+
+func TestResumeRestoresTurnsAndCreatedAt(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:      "codex",
+		AgentProviders:     []string{"codex"},
+		CodexWorkdir:       dir,
+		SessionStoreFile:   filepath.Join(dir, "sessions.json"),
+		SessionHistoryFile: filepath.Join(dir, "session-history.json"),
+		ChatSettingsFile:   filepath.Join(dir, "chat-settings.json"),
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	sessionHistory = map[string][]sessionHistoryEntry{}
+
+	created := "2026-03-01T09:00:00Z"
+	sessionMu.Lock()
+	chatSessions[sessionKey("codex", 9)] = sessionRecord{SessionID: "old-sid", Provider: "codex", ChatID: 9, CreatedAt: created, Turns: 7}
+	sessionMu.Unlock()
+	recordSessionUse(cfg, "codex", 9, "old-sid", "long task", "h")
+	if e := listChatSessions(9); len(e) != 1 || e[0].Turns != 7 || e[0].CreatedAt != created {
+		t.Fatalf("history entry = %+v", e)
+	}
+
+	clearChatSessionID(cfg, "codex", 9)
+	setChatSessionID(cfg, "codex", 9, "new-sid")
+	if reply := resumeChatSession(cfg, telegramMessage{Chat: telegramChat{ID: 9}}, "old-"); !strings.Contains(reply, "resumed") {
+		t.Fatalf("resume reply = %q", reply)
+	}
+	rec, _ := getChatSession("codex", 9)
+	if rec.SessionID != "old-sid" || rec.Turns != 7 || rec.CreatedAt != created || rec.ContextHash != "h" {
+		t.Fatalf("resumed record = %+v", rec)
+	}
+}
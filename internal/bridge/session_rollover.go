@@ -0,0 +1,52 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// sessionRolloverReason explains why rec should not be resumed any more, or
+// returns "" when it is still fresh. SESSION_IDLE_TTL_SEC and SESSION_MAX_TURNS
+// bound how much context a single agent session accumulates.
+func sessionRolloverReason(cfg bridgeConfig, rec sessionRecord, now time.Time) string {
+	if cfg.SessionMaxTurns > 0 && rec.Turns >= cfg.SessionMaxTurns {
+		return fmt.Sprintf("the previous session reached %d turns", rec.Turns)
+	}
+	if cfg.SessionIdleTTLSec > 0 && rec.UpdatedAt != "" {
+		last, err := time.Parse(time.RFC3339, rec.UpdatedAt)
+		if err == nil && now.Sub(last) > time.Duration(cfg.SessionIdleTTLSec)*time.Second {
+			return "the previous session was idle for " + now.Sub(last).Round(time.Minute).String()
+		}
+	}
+	return ""
+}
+
+// promptContextHash fingerprints the agent instructions and memory that
+// buildPromptWithMemory injects, so edits can be pushed into a running
+// session.
+func promptContextHash(cfg bridgeConfig) string {
+	sum := sha256.New()
+	sum.Write([]byte(readAgentInstructions(cfg)))
+	sum.Write([]byte{0})
+	sum.Write([]byte(readMemoryForPrompt(cfg)))
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// buildTurnPrompt injects context on the first turn of a session, and again
+// whenever it changed since it was last sent. It reports whether context was
+// included.
+func buildTurnPrompt(cfg bridgeConfig, prompt string, rec sessionRecord, resumed bool, contextHash string) (string, bool) {
+	if !resumed {
+		return buildPromptWithMemory(cfg, withCarrySummary(prompt, rec.CarrySummary), true), true
+	}
+	if rec.ContextHash == "" || rec.ContextHash == contextHash {
+		return prompt, false
+	}
+	refreshed := buildPromptWithMemory(cfg, prompt, true)
+	if refreshed == prompt {
+		return prompt, false
+	}
+	return "Your background context was updated since the last turn; the version below replaces the earlier one.\n\n" + refreshed, true
+}
@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionRolloverReason(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := bridgeConfig{SessionIdleTTLSec: 3600, SessionMaxTurns: 10}
+	fresh := sessionRecord{SessionID: "s", Turns: 3, UpdatedAt: now.Add(-30 * time.Minute).Format(time.RFC3339)}
+	if r := sessionRolloverReason(cfg, fresh, now); r != "" {
+		t.Fatalf("fresh session rolled over: %q", r)
+	}
+	idle := fresh
+	idle.UpdatedAt = now.Add(-2 * time.Hour).Format(time.RFC3339)
+	if r := sessionRolloverReason(cfg, idle, now); !strings.Contains(r, "idle for 2h0m0s") {
+		t.Fatalf("idle reason = %q", r)
+	}
+	full := fresh
+	full.Turns = 10
+	if r := sessionRolloverReason(cfg, full, now); !strings.Contains(r, "10 turns") {
+		t.Fatalf("turns reason = %q", r)
+	}
+	if r := sessionRolloverReason(bridgeConfig{}, idle, now); r != "" {
+		t.Fatalf("limits disabled but rolled over: %q", r)
+	}
+}
+
+func TestRunAgentRefreshesContextAndRollsOver(t *testing.T) {
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		AgentProvider:    "generic",
+		AgentProviders:   []string{"generic"},
+		AgentBin:         "/bin/sh",
+		AgentArgs:        `-c 'cat' sh`,
+		AgentPromptMode:  promptModeStdin,
+		SessionStoreFile: filepath.Join(dir, "sessions.json"),
+		CodexWorkdir:     dir,
+		MemoryFile:       "MEMORY.md",
+		CodexSandbox:     "read-only",
+		TimeoutSec:       10,
+		SessionMaxTurns:  3,
+	}
+	chatSessions = map[string]sessionRecord{}
+	chatSettingsStore = map[string]chatSettings{}
+	memory := filepath.Join(dir, "MEMORY.md")
+	if err := os.WriteFile(memory, []byte("- likes tea"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(prompt string) string {
+		t.Helper()
+		out, _, err := runAgent(context.Background(), cfg, 31, prompt, nil)
+		if err != nil {
+			t.Fatalf("runAgent(%q): %v", prompt, err)
+		}
+		return out
+	}
+
+	if out := run("first"); !strings.Contains(out, "likes tea") {
+		t.Fatalf("first turn lacks context: %q", out)
+	}
+	if out := run("second"); out != "second" {
+		t.Fatalf("unchanged context was injected again: %q", out)
+	}
+	if err := os.WriteFile(memory, []byte("- likes coffee"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out := run("third"); !strings.Contains(out, "was updated") || !strings.Contains(out, "likes coffee") {
+		t.Fatalf("changed context not refreshed: %q", out)
+	}
+	out := run("fourth")
+	if !strings.HasPrefix(out, "[started a new session: the previous session reached 3 turns") || !strings.Contains(out, "likes coffee") {
+		t.Fatalf("no rollover after max turns: %q", out)
+	}
+	if rec, _ := getChatSession("generic", 31); rec.Turns != 1 {
+		t.Fatalf("new session turns = %d", rec.Turns)
+	}
+}
@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var errBridgeShutdown = errors.New("bridge shutting down")
+
+// watchShutdownSignals requests a graceful shutdown on the first SIGINT or
+// SIGTERM and exits immediately on the second one.
+func watchShutdownSignals(requestShutdown func()) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Printf("received %s; shutting down (send again to force exit)", sig)
+		requestShutdown()
+		sig = <-sigCh
+		log.Printf("received %s again; exiting without waiting", sig)
+		os.Exit(1)
+	}()
+}
+
+func shutdownBridge(cfg bridgeConfig, dispatcher *chatDispatcher, control *controlLane, sched *scheduler, offset int64) {
+	log.Printf("shutdown: polling stopped; waiting up to %ds for in-flight runs", cfg.ShutdownTimeoutSec)
+
+	// Confirm everything handed out so far so Telegram does not replay it on
+	// the next start.
+	ackCtx, cancelAck := context.WithTimeout(context.Background(), 5*time.Second)
+	if _, err := getUpdates(ackCtx, cfg, offset, 0); err != nil {
+		log.Printf("shutdown: failed to confirm update offset=%d: %v", offset, err)
+	}
+	cancelAck()
+
+	// Scheduled and background jobs share the grace period with the chats'
+	// runs.
+	schedDone := make(chan struct{})
+	go func() {
+		sched.Shutdown(time.Duration(cfg.ShutdownTimeoutSec) * time.Second)
+		close(schedDone)
+	}()
+	bgDone := make(chan struct{})
+	go func() {
+		shutdownBackgroundJobs(time.Duration(cfg.ShutdownTimeoutSec) * time.Second)
+		close(bgDone)
+	}()
+	dropped := dispatcher.Shutdown(time.Duration(cfg.ShutdownTimeoutSec) * time.Second)
+	for _, item := range dropped {
+		reply := "your request was not started because the bridge is shutting down: " + queueItemLabel(item.Msg)
+		_ = sendMessage(cfg, item.Msg.Chat.ID, reply)
+		appendChatLog(cfg, item.Msg, reply, "interrupted")
+	}
+
+	<-schedDone
+	<-bgDone
+	control.Close(5 * time.Second)
+
+	if err := flushSessions(cfg); err != nil {
+		log.Printf("shutdown: failed to flush session store: %v", err)
+	}
+	log.Printf("shutdown complete")
+}
+
+func isShutdownCancel(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errBridgeShutdown)
+}
+
+func interruptedReply(cfg bridgeConfig, partial string) string {
+	reply := "your request was interrupted because the bridge is shutting down. please resend it after restart."
+	if p := trimForTelegram(partial, cfg.MaxReplyChars); p != "" {
+		reply = trimForTelegram(reply+"\npartial output:\n"+p, cfg.MaxReplyChars)
+	}
+	return reply
+}
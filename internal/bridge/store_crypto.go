@@ -0,0 +1,415 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encrypted payloads are stored as a text line so the same envelope works for
+// whole files (sessions, memory) and for individual chat log records.
+const storeCipherPrefix = "tgenc1:"
+
+var storeCipherAAD = []byte("telegent-store-v1")
+
+func loadStoreKey() ([]byte, error) {
+	raw := strings.TrimSpace(os.Getenv("STORE_ENCRYPTION_KEY"))
+	source := "STORE_ENCRYPTION_KEY"
+	if raw == "" {
+		keyFile := strings.TrimSpace(os.Getenv("STORE_ENCRYPTION_KEY_FILE"))
+		if keyFile == "" {
+			return nil, nil
+		}
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read STORE_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		raw = strings.TrimSpace(string(b))
+		source = "STORE_ENCRYPTION_KEY_FILE"
+	}
+	key, err := decodeStoreKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	return key, nil
+}
+
+func decodeStoreKey(raw string) ([]byte, error) {
+	if len(raw) == 64 {
+		if key, err := hex.DecodeString(raw); err == nil {
+			return key, nil
+		}
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(raw); err == nil && len(key) == 32 {
+			return key, nil
+		}
+	}
+	return nil, errors.New("key must be 32 bytes encoded as hex or base64")
+}
+
+func generateStoreKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func isSealedStoreData(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(storeCipherPrefix))
+}
+
+func sealStoreData(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newStoreAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, storeCipherAAD)
+	return []byte(storeCipherPrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// openStoreData returns plaintext input unchanged so stores written before
+// encryption was enabled keep working until they are migrated.
+func openStoreData(key []byte, data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte(storeCipherPrefix)) {
+		return data, nil
+	}
+	if len(key) == 0 {
+		return nil, errors.New("store is encrypted but no STORE_ENCRYPTION_KEY is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(trimmed[len(storeCipherPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt encrypted store: %w", err)
+	}
+	aead, err := newStoreAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("corrupt encrypted store: payload too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, storeCipherAAD)
+	if err != nil {
+		return nil, errors.New("failed to decrypt store (wrong key or tampered data)")
+	}
+	return plain, nil
+}
+
+func newStoreAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func storeFileMode(cfg bridgeConfig) os.FileMode {
+	if len(cfg.StoreKey) > 0 {
+		return 0o600
+	}
+	return 0o644
+}
+
+// plaintextStoreWarned remembers the stores already reported as plaintext,
+// so a file read on every prompt (MEMORY.md) is only logged once.
+var plaintextStoreWarned sync.Map
+
+func readStoreFile(cfg bridgeConfig, path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.StoreKey) > 0 && len(bytes.TrimSpace(raw)) > 0 && !isSealedStoreData(raw) {
+		if _, seen := plaintextStoreWarned.LoadOrStore(path, true); !seen {
+			log.Printf("store %s is plaintext although a store key is set; it is encrypted on its next write, or run `telegent store encrypt`", path)
+		}
+	}
+	return openStoreData(cfg.StoreKey, raw)
+}
+
+// restrictStoreFiles tightens stores left at 0644 from before a key was set
+// to 0600. New files get the right mode when they are created, but existing
+// ones keep theirs until rewritten, and the logs are only ever appended to.
+func restrictStoreFiles(cfg bridgeConfig) {
+	if len(cfg.StoreKey) == 0 {
+		return
+	}
+	paths := append(storeFilePaths(cfg), cfg.ChatLogFile, cfg.UsageLogFile)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		backups, _ := filepath.Glob(path + ".bak.*")
+		for _, p := range append([]string{path}, backups...) {
+			info, err := os.Stat(p)
+			if err != nil || info.Mode().Perm()&0o077 == 0 {
+				continue
+			}
+			if err := os.Chmod(p, storeFileMode(cfg)); err != nil {
+				log.Printf("store %s: failed to restrict mode: %v", p, err)
+			}
+		}
+	}
+}
+
+// storeFilePaths lists the whole-file stores, including the HTTP provider
+// histories.
+func storeFilePaths(cfg bridgeConfig) []string {
+	paths := []string{cfg.SessionStoreFile, resolveMemoryPath(cfg), cfg.ChatSettingsFile, cfg.SessionHistoryFile, cfg.ScheduleFile, cfg.ReminderFile, cfg.BgJobFile}
+	if cfg.OpenAIHistoryDir != "" {
+		histories, _ := filepath.Glob(filepath.Join(cfg.OpenAIHistoryDir, "*.json"))
+		paths = append(paths, histories...)
+	}
+	return paths
+}
+
+// encodeStoreFile seals a whole store file when a key is configured.
+func encodeStoreFile(cfg bridgeConfig, data []byte) ([]byte, error) {
+	if len(cfg.StoreKey) == 0 {
+		return data, nil
+	}
+	sealed, err := sealStoreData(cfg.StoreKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return append(sealed, '\n'), nil
+}
+
+func encodeChatLogLine(cfg bridgeConfig, line []byte) ([]byte, error) {
+	if len(cfg.StoreKey) == 0 {
+		return line, nil
+	}
+	return sealStoreData(cfg.StoreKey, line)
+}
+
+func decodeChatLogLine(cfg bridgeConfig, line []byte) ([]byte, error) {
+	return openStoreData(cfg.StoreKey, line)
+}
+
+// migrateStores rewrites the chat and usage logs, session store and history,
+// memory file, chat settings, schedules, reminders, background jobs and HTTP
+// provider histories either sealed with cfg.StoreKey (encrypt=true) or as
+// plaintext (encrypt=false). Backups of these files (path.bak.N) are
+// rewritten too, or removed when they cannot be read.
+func migrateStores(cfg bridgeConfig, encrypt bool) ([]string, error) {
+	if len(cfg.StoreKey) == 0 {
+		return nil, errors.New("STORE_ENCRYPTION_KEY or STORE_ENCRYPTION_KEY_FILE is required")
+	}
+	target := cfg
+	if !encrypt {
+		target.StoreKey = nil
+	}
+
+	paths := storeFilePaths(cfg)
+	done := make([]string, 0, len(paths)+2)
+	for _, path := range paths {
+		raw, err := readStoreFile(cfg, path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return done, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := writeStoreFileAtomic(target, path, raw); err != nil {
+			return done, fmt.Errorf("%s: %w", path, err)
+		}
+		done = append(done, path)
+		migrated, err := migrateStoreBackups(cfg, target, path)
+		done = append(done, migrated...)
+		if err != nil {
+			return done, err
+		}
+	}
+
+	logs := []struct {
+		path string
+		mu   *sync.Mutex
+	}{
+		{cfg.ChatLogFile, &chatLogMu},
+		{cfg.UsageLogFile, &usageLogMu},
+	}
+	for _, l := range logs {
+		if l.path == "" {
+			continue
+		}
+		if err := migrateLineLog(cfg, target, l.path, l.mu); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return done, fmt.Errorf("%s: %w", l.path, err)
+		}
+		done = append(done, l.path)
+	}
+	return done, nil
+}
+
+// migrateStoreBackups re-encodes the backups of path. A backup that does not
+// open with the current key is removed rather than left behind in the old
+// form.
+func migrateStoreBackups(source bridgeConfig, target bridgeConfig, path string) ([]string, error) {
+	backups, _ := filepath.Glob(path + ".bak.*")
+	var done []string
+	for _, backup := range backups {
+		if _, err := strconv.Atoi(strings.TrimPrefix(backup, path+".bak.")); err != nil {
+			continue
+		}
+		raw, err := readStoreFile(source, backup)
+		if err != nil {
+			log.Printf("store migrate: removing unreadable backup %s: %v", backup, err)
+			if err := os.Remove(backup); err != nil {
+				return done, fmt.Errorf("%s: %w", backup, err)
+			}
+			continue
+		}
+		if err := writeStoreFileAtomic(target, backup, raw); err != nil {
+			return done, fmt.Errorf("%s: %w", backup, err)
+		}
+		done = append(done, backup)
+	}
+	return done, nil
+}
+
+// migrateLineLog re-encodes a JSONL log whose lines are sealed one by one.
+func migrateLineLog(source bridgeConfig, target bridgeConfig, path string, mu *sync.Mutex) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		plain, err := decodeChatLogLine(source, line)
+		if err != nil {
+			return err
+		}
+		encoded, err := encodeChatLogLine(target, plain)
+		if err != nil {
+			return err
+		}
+		out.Write(encoded)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	tmp := path + ".migrate"
+	if err := os.WriteFile(tmp, out.Bytes(), storeFileMode(target)); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeStoreFileAtomic replaces path so that a crash leaves either the old
+// or the new content: data goes to a temp file that is fsynced before the
+// rename.
+func writeStoreFileAtomic(cfg bridgeConfig, path string, data []byte) error {
+	return writeStoreFileWithBackups(cfg, path, data, 0)
+}
+
+// writeStoreFileWithBackups is writeStoreFileAtomic that keeps the previous
+// version as path.bak.1, older ones shifting up to path.bak.<backups>.
+func writeStoreFileWithBackups(cfg bridgeConfig, path string, data []byte, backups int) error {
+	data, err := encodeStoreFile(cfg, data)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	// Restrict the mode before any data is written.
+	if err := tmp.Chmod(storeFileMode(cfg)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if backups > 0 {
+		if err := rotateStoreBackups(path, backups); err != nil {
+			log.Printf("store backup rotation failed path=%s: %v", path, err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+func storeBackupPath(path string, n int) string {
+	return path + ".bak." + strconv.Itoa(n)
+}
+
+// rotateStoreBackups shifts path.bak.N up by one and hard-links the current
+// file as path.bak.1, so path itself never disappears.
+func rotateStoreBackups(path string, backups int) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for i := backups; i > 1; i-- {
+		if err := os.Rename(storeBackupPath(path, i-1), storeBackupPath(path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	first := storeBackupPath(path, 1)
+	_ = os.Remove(first)
+	if err := os.Link(path, first); err == nil {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(first, raw, info.Mode().Perm())
+}
@@ -0,0 +1,208 @@
+package bridge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testStoreKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := generateStoreKey()
+	if err != nil {
+		t.Fatalf("generateStoreKey failed: %v", err)
+	}
+	key, err := decodeStoreKey(encoded)
+	if err != nil {
+		t.Fatalf("decodeStoreKey failed: %v", err)
+	}
+	return key
+}
+
+func TestStoreSealRoundTrip(t *testing.T) {
+	t.Parallel()
+	key := testStoreKey(t)
+
+	sealed, err := sealStoreData(key, []byte("secret chat"))
+	if err != nil {
+		t.Fatalf("sealStoreData failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) || !isSealedStoreData(sealed) {
+		t.Fatalf("payload not sealed: %q", sealed)
+	}
+	plain, err := openStoreData(key, sealed)
+	if err != nil || string(plain) != "secret chat" {
+		t.Fatalf("openStoreData=%q err=%v", plain, err)
+	}
+
+	if _, err := openStoreData(testStoreKey(t), sealed); err == nil {
+		t.Fatal("expected wrong key to fail")
+	}
+	if _, err := openStoreData(nil, sealed); err == nil {
+		t.Fatal("expected missing key to fail")
+	}
+	if got, err := openStoreData(key, []byte(`{"a":"b"}`)); err != nil || string(got) != `{"a":"b"}` {
+		t.Fatalf("plaintext passthrough failed: %q err=%v", got, err)
+	}
+}
+
+func TestDecodeStoreKey(t *testing.T) {
+	t.Parallel()
+
+	if _, err := decodeStoreKey(strings.Repeat("ab", 32)); err != nil {
+		t.Fatalf("hex key rejected: %v", err)
+	}
+	if _, err := decodeStoreKey("too-short"); err == nil {
+		t.Fatal("expected short key to be rejected")
+	}
+}
+
+func TestEncryptedStoresAreTransparent(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		CodexWorkdir:     dir,
+		MemoryFile:       "MEMORY.md",
+		ChatLogFile:      filepath.Join(dir, "chat.jsonl"),
+		SessionStoreFile: filepath.Join(dir, "sessions.json"),
+		StoreKey:         testStoreKey(t),
+	}
+
+	if err := ensureMemoryFile(cfg); err != nil {
+		t.Fatalf("ensureMemoryFile failed: %v", err)
+	}
+	if err := appendMemoryItem(cfg, "private item"); err != nil {
+		t.Fatalf("appendMemoryItem failed: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "MEMORY.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealedStoreData(raw) {
+		t.Fatalf("memory file not encrypted: %q", raw)
+	}
+	mem, err := readMemory(cfg)
+	if err != nil || !strings.Contains(mem, "private item") {
+		t.Fatalf("readMemory=%q err=%v", mem, err)
+	}
+
+	appendChatLog(cfg, telegramMessage{Chat: telegramChat{ID: 1}, Text: "hello there"}, "reply", "agent_output")
+	logRaw, err := os.ReadFile(cfg.ChatLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(logRaw, []byte("hello there")) {
+		t.Fatalf("chat log not encrypted: %q", logRaw)
+	}
+
+	done, err := migrateStores(cfg, false)
+	if err != nil {
+		t.Fatalf("decrypt migration failed: %v (done=%v)", err, done)
+	}
+	logRaw, err = os.ReadFile(cfg.ChatLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(logRaw, []byte("hello there")) {
+		t.Fatalf("chat log not decrypted: %q", logRaw)
+	}
+	raw, err = os.ReadFile(filepath.Join(dir, "MEMORY.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isSealedStoreData(raw) || !strings.Contains(string(raw), "private item") {
+		t.Fatalf("memory not decrypted: %q", raw)
+	}
+}
+
+func TestPlaintextStoresAreRestrictedOnceKeyIsSet(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		CodexWorkdir:     dir,
+		MemoryFile:       "MEMORY.md",
+		ChatLogFile:      filepath.Join(dir, "chat.jsonl"),
+		SessionStoreFile: filepath.Join(dir, "sessions.json"),
+	}
+	// Stores written before a key was configured.
+	if err := ensureMemoryFile(cfg); err != nil {
+		t.Fatalf("ensureMemoryFile failed: %v", err)
+	}
+	if err := os.WriteFile(cfg.ChatLogFile, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	memPath := filepath.Join(dir, "MEMORY.md")
+	if info, _ := os.Stat(memPath); info.Mode().Perm() != 0o644 {
+		t.Fatalf("plaintext memory mode = %v", info.Mode().Perm())
+	}
+
+	cfg.StoreKey = testStoreKey(t)
+	restrictStoreFiles(cfg)
+	for _, path := range []string{memPath, cfg.ChatLogFile} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("%s not restricted: %v %v", path, info.Mode().Perm(), err)
+		}
+	}
+	// Plaintext is still readable, and the next write seals it atomically.
+	if mem, err := readMemory(cfg); err != nil || !strings.Contains(mem, "# MEMORY") {
+		t.Fatalf("readMemory=%q err=%v", mem, err)
+	}
+	if err := appendMemoryItem(cfg, "sealed now"); err != nil {
+		t.Fatalf("appendMemoryItem failed: %v", err)
+	}
+	raw, _ := os.ReadFile(memPath)
+	if !isSealedStoreData(raw) {
+		t.Fatalf("memory not sealed on write: %q", raw)
+	}
+	if left, _ := filepath.Glob(memPath + ".tmp-*"); len(left) != 0 {
+		t.Fatalf("temp files left behind: %v", left)
+	}
+}
+
+func TestMigrateStoresRewritesBackups(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg := bridgeConfig{
+		CodexWorkdir:     dir,
+		MemoryFile:       "MEMORY.md",
+		SessionStoreFile: filepath.Join(dir, "sessions.json"),
+		StoreKey:         testStoreKey(t),
+	}
+	plain := cfg
+	plain.StoreKey = nil
+	for i := 0; i < 3; i++ {
+		data := []byte(`{"version": 2, "sessions": {"codex:1": {"session_id": "secret-` + string(rune('a'+i)) + `"}}}`)
+		if err := writeStoreFileWithBackups(plain, cfg.SessionStoreFile, data, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A backup sealed with some other key cannot be migrated.
+	other := cfg
+	other.StoreKey = testStoreKey(t)
+	if err := writeStoreFileAtomic(other, storeBackupPath(cfg.SessionStoreFile, 3), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrateStores(cfg, true); err != nil {
+		t.Fatalf("encrypt migration failed: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		raw, err := os.ReadFile(storeBackupPath(cfg.SessionStoreFile, i))
+		if err != nil || !isSealedStoreData(raw) {
+			t.Fatalf("backup %d not encrypted: %q err=%v", i, raw, err)
+		}
+	}
+	if _, err := os.Stat(storeBackupPath(cfg.SessionStoreFile, 3)); !os.IsNotExist(err) {
+		t.Fatalf("unreadable backup kept: %v", err)
+	}
+
+	if _, err := migrateStores(cfg, false); err != nil {
+		t.Fatalf("decrypt migration failed: %v", err)
+	}
+	raw, err := os.ReadFile(storeBackupPath(cfg.SessionStoreFile, 2))
+	if err != nil || !strings.Contains(string(raw), "secret-a") {
+		t.Fatalf("backup not decrypted: %q err=%v", raw, err)
+	}
+}
@@ -2,6 +2,7 @@ package bridge
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,19 +31,19 @@ type telegramFileInfo struct {
 	FilePath string `json:"file_path"`
 }
 
-func getUpdates(cfg bridgeConfig, offset int64) ([]telegramUpdate, error) {
+func getUpdates(ctx context.Context, cfg bridgeConfig, offset int64, timeoutSec int) ([]telegramUpdate, error) {
 	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates", cfg.BotToken)
 
 	params := url.Values{}
-	params.Set("timeout", "50")
+	params.Set("timeout", strconv.Itoa(timeoutSec))
 	params.Set("offset", strconv.FormatInt(offset, 10))
 
-	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+params.Encode(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+params.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 60 * time.Second}
+	client := &http.Client{Timeout: time.Duration(timeoutSec+10) * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -103,6 +104,73 @@ func sendMessage(cfg bridgeConfig, chatID int64, text string) error {
 	return nil
 }
 
+type telegramSentMessageResponse struct {
+	OK     bool            `json:"ok"`
+	Result telegramMessage `json:"result"`
+}
+
+func postTelegramJSON(cfg bridgeConfig, method string, payload map[string]any) ([]byte, error) {
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/%s", cfg.BotToken, method)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 20 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+func sendMessageWithKeyboard(cfg bridgeConfig, chatID int64, text string, keyboard telegramInlineKeyboard) (int64, error) {
+	respBody, err := postTelegramJSON(cfg, "sendMessage", map[string]any{
+		"chat_id":      chatID,
+		"text":         text,
+		"reply_markup": keyboard,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var payload telegramSentMessageResponse
+	if err := json.Unmarshal(respBody, &payload); err != nil {
+		return 0, fmt.Errorf("bad response: %w", err)
+	}
+	return payload.Result.MessageID, nil
+}
+
+func deleteMessage(cfg bridgeConfig, chatID int64, messageID int64) error {
+	_, err := postTelegramJSON(cfg, "deleteMessage", map[string]any{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	})
+	return err
+}
+
+func answerCallbackQuery(cfg bridgeConfig, callbackID string, text string) error {
+	payload := map[string]any{"callback_query_id": callbackID}
+	if text != "" {
+		payload["text"] = text
+	}
+	_, err := postTelegramJSON(cfg, "answerCallbackQuery", payload)
+	return err
+}
+
 func sendDocument(cfg bridgeConfig, chatID int64, filePath string, caption string) error {
 	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", cfg.BotToken)
 
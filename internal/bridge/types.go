@@ -1,8 +1,25 @@
 package bridge
 
 type telegramUpdate struct {
-	UpdateID int64            `json:"update_id"`
-	Message  *telegramMessage `json:"message"`
+	UpdateID      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+type telegramCallbackQuery struct {
+	ID      string           `json:"id"`
+	From    *telegramUser    `json:"from"`
+	Message *telegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+type telegramInlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type telegramInlineKeyboard struct {
+	InlineKeyboard [][]telegramInlineButton `json:"inline_keyboard"`
 }
 
 type telegramMessage struct {
@@ -48,30 +65,73 @@ type telegramPhotoSize struct {
 }
 
 type bridgeConfig struct {
-	BotToken           string
-	AllowedUserID      int64
-	ParentPID          int
-	AgentProvider      string
-	AgentBin           string
-	AgentArgs          string
-	AgentModel         string
-	AgentSupportsImage bool
-	CodexBin           string
-	CodexWorkdir       string
-	TmpDir             string
-	ImageDir           string
-	CodexModel         string
-	CodexSandbox       string
-	WhisperPythonBin   string
-	WhisperScript      string
-	WhisperModel       string
-	WhisperLanguage    string
-	WhisperCompute     string
-	MemoryFile         string
-	TimeoutSec         int
-	MaxReplyChars      int
-	ChatLogFile        string
-	SessionStoreFile   string
+	BotToken             string
+	AllowedUserID        int64
+	ParentPID            int
+	AgentProvider        string
+	AgentProviders       []string
+	AgentFallback        []string
+	AgentMaxRetries      int
+	AgentRetryBackoffMs  int
+	AgentKillGraceSec    int
+	AllowedModels        []string
+	AllowedSandboxes     []string
+	ChatMaxTimeoutSec    int
+	AgentBin             string
+	AgentArgs            string
+	AgentResumeArgs      string
+	AgentSessionRegex    string
+	AgentSessionJSONPath string
+	AgentReplyJSONPath   string
+	AgentPromptMode      string
+	AgentPromptEnv       string
+	AgentModel           string
+	AgentSupportsImage   bool
+	GenericAgents        map[string]genericAgentConfig
+	CodexBin             string
+	ClaudeBin            string
+	OpenAIBaseURL        string
+	OpenAIAPIKey         string
+	OpenAIModel          string
+	OpenAIHistoryTokens  int
+	OpenAIHistoryDir     string
+	CodexWorkdir         string
+	TmpDir               string
+	ImageDir             string
+	CodexModel           string
+	CodexSandbox         string
+	WhisperPythonBin     string
+	WhisperScript        string
+	WhisperModel         string
+	WhisperLanguage      string
+	WhisperCompute       string
+	MemoryFile           string
+	TimeoutSec           int
+	MaxReplyChars        int
+	MaxConcurrentChats   int
+	QueueMaxPending      int
+	QueueOverflowPolicy  queueOverflowPolicy
+	ShutdownTimeoutSec   int
+	ChatLogFile          string
+	SessionStoreFile     string
+	SessionStoreBackups  int
+	SessionIdleTTLSec    int
+	SessionMaxTurns      int
+	NewSessionCarry      bool
+	SummarizerProvider   string
+	ChatSettingsFile     string
+	SessionHistoryFile   string
+	UsageLogFile         string
+	ScheduleFile         string
+	ScheduleCatchup      string
+	ReminderFile         string
+	BgJobFile            string
+	BgTimeoutSec         int
+	BgMaxRunning         int
+	ModelPrices          map[string]modelPrice
+	DailyBudgetUSD       float64
+	AuditLogFile         string
+	StoreKey             []byte
 }
 
 type mediaInput struct {
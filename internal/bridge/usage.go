@@ -0,0 +1,412 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// modelPrice is the USD price per million tokens of one model.
+type modelPrice struct {
+	Input       float64
+	Output      float64
+	CachedInput float64
+}
+
+// usageRecord is one line of the usage log, written for every agent run.
+type usageRecord struct {
+	Timestamp         string  `json:"timestamp"`
+	Provider          string  `json:"provider"`
+	Model             string  `json:"model,omitempty"`
+	ChatID            int64   `json:"chat_id"`
+	DurationMs        int64   `json:"duration_ms"`
+	InputTokens       int64   `json:"input_tokens"`
+	CachedInputTokens int64   `json:"cached_input_tokens,omitempty"`
+	OutputTokens      int64   `json:"output_tokens"`
+	TotalTokens       int64   `json:"total_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
+	CostSource        string  `json:"cost_source,omitempty"`
+	Outcome           string  `json:"outcome"`
+}
+
+var (
+	usageLogMu sync.Mutex
+	// usageDay and usageDayCost cache today's spend for budget alerts so the
+	// log is only scanned once per day. usageDay also names the log file.
+	usageDay     string
+	usageDayCost float64
+)
+
+func defaultUsageLogPath(cfg bridgeConfig) string {
+	if p := strings.TrimSpace(os.Getenv("USAGE_LOG_FILE")); p != "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(cfg.SessionStoreFile), "usage.jsonl")
+}
+
+// parseModelPrices reads MODEL_PRICES entries of the form
+// name=input/output[/cached], in USD per million tokens. The name is a model
+// or, for runs without an explicit model, a provider.
+func parseModelPrices(raw string) (map[string]modelPrice, error) {
+	prices := map[string]modelPrice{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("MODEL_PRICES entry %q must look like model=input/output[/cached]", entry)
+		}
+		parts := strings.Split(spec, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("MODEL_PRICES entry %q must look like model=input/output[/cached]", entry)
+		}
+		values := make([]float64, len(parts))
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("MODEL_PRICES entry %q has an invalid price %q", entry, p)
+			}
+			values[i] = v
+		}
+		price := modelPrice{Input: values[0], Output: values[1], CachedInput: values[0]}
+		if len(values) == 3 {
+			price.CachedInput = values[2]
+		}
+		prices[name] = price
+	}
+	return prices, nil
+}
+
+// agentModelName is the model the provider of cfg runs with, or "" when it
+// uses its own default.
+func agentModelName(cfg bridgeConfig) string {
+	switch cfg.AgentProvider {
+	case "", "codex":
+		return cfg.CodexModel
+	case "openai":
+		return cfg.OpenAIModel
+	default:
+		return cfg.AgentModel
+	}
+}
+
+func (u agentUsage) Total() int64 {
+	if sum := u.InputTokens + u.CachedInputTokens + u.OutputTokens; sum > u.TotalTokens {
+		return sum
+	}
+	return u.TotalTokens
+}
+
+// usageCost prices u. Costs reported by the provider win over MODEL_PRICES.
+// A bare total from text output is priced at the input rate.
+func usageCost(cfg bridgeConfig, provider string, model string, u agentUsage) (float64, string) {
+	if u.CostUSD > 0 {
+		return u.CostUSD, "provider"
+	}
+	price, ok := cfg.ModelPrices[model]
+	if !ok || model == "" {
+		price, ok = cfg.ModelPrices[provider]
+	}
+	if !ok {
+		return 0, ""
+	}
+	unsplit := u.Total() - u.InputTokens - u.CachedInputTokens - u.OutputTokens
+	cost := (float64(u.InputTokens+unsplit)*price.Input +
+		float64(u.CachedInputTokens)*price.CachedInput +
+		float64(u.OutputTokens)*price.Output) / 1e6
+	return cost, "prices"
+}
+
+var (
+	tokensUsedPattern   = regexp.MustCompile(`(?i)tokens used\s*:?\s*([0-9][0-9,]*)`)
+	inputTokensPattern  = regexp.MustCompile(`(?i)\binput[ _]tokens\s*[:=]?\s*([0-9][0-9,]*)`)
+	cachedTokensPattern = regexp.MustCompile(`(?i)\bcached[ _]input[ _]tokens\s*[:=]?\s*([0-9][0-9,]*)`)
+	outputTokensPattern = regexp.MustCompile(`(?i)\boutput[ _]tokens\s*[:=]?\s*([0-9][0-9,]*)`)
+)
+
+// parseUsageText recovers token counts from human-readable agent output such
+// as codex's "tokens used" trailer, for runs without structured events.
+func parseUsageText(output string) agentUsage {
+	u := agentUsage{
+		InputTokens:       lastTokenCount(inputTokensPattern, output),
+		CachedInputTokens: lastTokenCount(cachedTokensPattern, output),
+		OutputTokens:      lastTokenCount(outputTokensPattern, output),
+		TotalTokens:       lastTokenCount(tokensUsedPattern, output),
+	}
+	u.InputTokens = uncachedInput(u.InputTokens, u.CachedInputTokens)
+	return u
+}
+
+// uncachedInput is the part of an input count that was not served from the
+// cache, for providers whose input count includes cached tokens.
+func uncachedInput(input int64, cached int64) int64 {
+	if cached > 0 && input >= cached {
+		return input - cached
+	}
+	return input
+}
+
+func lastTokenCount(pattern *regexp.Regexp, output string) int64 {
+	matches := pattern.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.ReplaceAll(matches[len(matches)-1][1], ",", ""), 10, 64)
+	return n
+}
+
+// recordAgentUsage appends one run to the usage log and returns a budget
+// alert when this run pushed today's spend over DAILY_BUDGET_USD.
+func recordAgentUsage(cfg bridgeConfig, chatID int64, started time.Time, u agentUsage, runErr error) string {
+	if strings.TrimSpace(cfg.UsageLogFile) == "" {
+		return ""
+	}
+	model := agentModelName(cfg)
+	cost, source := usageCost(cfg, cfg.AgentProvider, model, u)
+	now := time.Now()
+	rec := usageRecord{
+		Timestamp:         now.Format(time.RFC3339),
+		Provider:          cfg.AgentProvider,
+		Model:             model,
+		ChatID:            chatID,
+		DurationMs:        now.Sub(started).Milliseconds(),
+		InputTokens:       u.InputTokens,
+		CachedInputTokens: u.CachedInputTokens,
+		OutputTokens:      u.OutputTokens,
+		TotalTokens:       u.Total(),
+		CostUSD:           cost,
+		CostSource:        source,
+		Outcome:           auditOutcome(runErr),
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("usage log marshal failed: %v", err)
+		return ""
+	}
+	b, err = encodeChatLogLine(cfg, b)
+	if err != nil {
+		log.Printf("usage log encrypt failed: %v", err)
+		return ""
+	}
+
+	usageLogMu.Lock()
+	defer usageLogMu.Unlock()
+	day := cfg.UsageLogFile + "@" + now.Format("2006-01-02")
+	if usageDay != day {
+		records, err := readUsageRecordsLocked(cfg, startOfDay(now))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("usage log read failed: %v", err)
+		}
+		usageDay, usageDayCost = day, 0
+		for _, r := range records {
+			usageDayCost += r.CostUSD
+		}
+	}
+
+	f, err := os.OpenFile(cfg.UsageLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, storeFileMode(cfg))
+	if err != nil {
+		log.Printf("usage log open failed: %v", err)
+		return ""
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Printf("usage log write failed: %v", err)
+		return ""
+	}
+
+	before := usageDayCost
+	usageDayCost += cost
+	if cfg.DailyBudgetUSD > 0 && before < cfg.DailyBudgetUSD && usageDayCost >= cfg.DailyBudgetUSD {
+		return fmt.Sprintf("daily budget reached: $%.2f spent today (budget $%.2f). send /usage for details.", usageDayCost, cfg.DailyBudgetUSD)
+	}
+	return ""
+}
+
+func readUsageRecords(cfg bridgeConfig, since time.Time) ([]usageRecord, error) {
+	usageLogMu.Lock()
+	defer usageLogMu.Unlock()
+	return readUsageRecordsLocked(cfg, since)
+}
+
+func readUsageRecordsLocked(cfg bridgeConfig, since time.Time) ([]usageRecord, error) {
+	f, err := os.Open(cfg.UsageLogFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []usageRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		plain, err := decodeChatLogLine(cfg, line)
+		if err != nil {
+			return records, err
+		}
+		var rec usageRecord
+		if err := json.Unmarshal(plain, &rec); err != nil {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, rec.Timestamp)
+		if err != nil || ts.Before(since) {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// usagePeriodStart maps a /usage period to its start: today since midnight,
+// week as the last seven days including today, month since the first.
+func usagePeriodStart(period string, now time.Time) (time.Time, bool) {
+	switch period {
+	case "", "today":
+		return startOfDay(now), true
+	case "week":
+		return startOfDay(now).AddDate(0, 0, -6), true
+	case "month":
+		y, m, _ := now.Date()
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func parseUsageCommand(text string) (string, bool) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || fields[0] != "/usage" {
+		return "", false
+	}
+	if len(fields) > 1 {
+		return strings.ToLower(fields[1]), true
+	}
+	return "today", true
+}
+
+type usageTotals struct {
+	Runs    int
+	Tokens  int64
+	Cached  int64
+	Output  int64
+	CostUSD float64
+}
+
+func (t *usageTotals) add(r usageRecord) {
+	t.Runs++
+	t.Tokens += r.TotalTokens
+	t.Cached += r.CachedInputTokens
+	t.Output += r.OutputTokens
+	t.CostUSD += r.CostUSD
+}
+
+func (t usageTotals) String() string {
+	return fmt.Sprintf("%d runs, %s tokens (%s cached, %s out), $%.2f", t.Runs, formatTokenCount(t.Tokens), formatTokenCount(t.Cached), formatTokenCount(t.Output), t.CostUSD)
+}
+
+func formatTokenCount(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return strconv.FormatFloat(float64(n)/1e6, 'f', 1, 64) + "M"
+	case n >= 10_000:
+		return strconv.FormatInt(n/1000, 10) + "k"
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+func formatUsageReport(cfg bridgeConfig, period string, since time.Time, records []usageRecord) string {
+	var total usageTotals
+	byProvider := map[string]*usageTotals{}
+	byChat := map[int64]*usageTotals{}
+	for _, r := range records {
+		total.add(r)
+		key := r.Provider
+		if r.Model != "" {
+			key += " (" + r.Model + ")"
+		}
+		if byProvider[key] == nil {
+			byProvider[key] = &usageTotals{}
+		}
+		byProvider[key].add(r)
+		if byChat[r.ChatID] == nil {
+			byChat[r.ChatID] = &usageTotals{}
+		}
+		byChat[r.ChatID].add(r)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "usage %s (since %s):\n%s", period, since.Format("2006-01-02 15:04"), total)
+	if len(records) == 0 {
+		b.WriteString("\nno agent runs recorded.")
+	}
+	if len(byProvider) > 0 {
+		b.WriteString("\n\nby provider:")
+		keys := make([]string, 0, len(byProvider))
+		for k := range byProvider {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return byProvider[keys[i]].CostUSD > byProvider[keys[j]].CostUSD || (byProvider[keys[i]].CostUSD == byProvider[keys[j]].CostUSD && keys[i] < keys[j])
+		})
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\n- %s: %s", k, byProvider[k])
+		}
+	}
+	if len(byChat) > 1 {
+		b.WriteString("\n\nby chat:")
+		chats := make([]int64, 0, len(byChat))
+		for id := range byChat {
+			chats = append(chats, id)
+		}
+		sort.Slice(chats, func(i, j int) bool {
+			return byChat[chats[i]].CostUSD > byChat[chats[j]].CostUSD || (byChat[chats[i]].CostUSD == byChat[chats[j]].CostUSD && chats[i] < chats[j])
+		})
+		for _, id := range chats {
+			fmt.Fprintf(&b, "\n- %d: %s", id, byChat[id])
+		}
+	}
+	if cfg.DailyBudgetUSD > 0 && period == "today" {
+		fmt.Fprintf(&b, "\n\ndaily budget: $%.2f of $%.2f", total.CostUSD, cfg.DailyBudgetUSD)
+	}
+	return b.String()
+}
+
+func handleUsageCommand(cfg bridgeConfig, msg telegramMessage, period string) {
+	var reply string
+	since, ok := usagePeriodStart(period, time.Now())
+	if !ok {
+		reply = "usage: /usage [today|week|month]"
+	} else {
+		records, err := readUsageRecords(cfg, since)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			reply = "failed to read usage log: " + err.Error()
+		} else {
+			reply = formatUsageReport(cfg, period, since, records)
+		}
+	}
+	_ = sendMessage(cfg, msg.Chat.ID, trimForTelegram(reply, cfg.MaxReplyChars))
+	appendChatLog(cfg, msg, reply, "usage")
+}
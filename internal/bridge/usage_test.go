@@ -0,0 +1,125 @@
+package bridge
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseModelPrices(t *testing.T) {
+	t.Parallel()
+
+	prices, err := parseModelPrices("gpt-5=1.25/10/0.125, claude=3/15")
+	if err != nil {
+		t.Fatalf("parseModelPrices: %v", err)
+	}
+	if p := prices["gpt-5"]; p.Input != 1.25 || p.Output != 10 || p.CachedInput != 0.125 {
+		t.Fatalf("gpt-5 price = %+v", p)
+	}
+	if p := prices["claude"]; p.CachedInput != 3 {
+		t.Fatalf("cached price should default to input: %+v", p)
+	}
+	for _, bad := range []string{"gpt-5", "gpt-5=1", "gpt-5=a/b", "=1/2"} {
+		if _, err := parseModelPrices(bad); err == nil {
+			t.Fatalf("parseModelPrices(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseUsageText(t *testing.T) {
+	t.Parallel()
+
+	out := "codex\nhello\ntokens used\n12,345\n"
+	if u := parseUsageText(out); u.TotalTokens != 12345 || u.Total() != 12345 {
+		t.Fatalf("trailer usage = %+v", u)
+	}
+	u := parseUsageText("done. input_tokens=1000 cached_input_tokens=400 output_tokens=50")
+	if u.InputTokens != 600 || u.CachedInputTokens != 400 || u.OutputTokens != 50 || u.Total() != 1050 {
+		t.Fatalf("split usage = %+v", u)
+	}
+	if u := parseUsageText("no numbers here"); u.Total() != 0 {
+		t.Fatalf("empty usage = %+v", u)
+	}
+}
+
+func TestUsageCost(t *testing.T) {
+	t.Parallel()
+
+	cfg := bridgeConfig{ModelPrices: map[string]modelPrice{
+		"gpt-5": {Input: 1, Output: 10, CachedInput: 0.1},
+		"codex": {Input: 2, Output: 2, CachedInput: 2},
+	}}
+	cost, source := usageCost(cfg, "codex", "gpt-5", agentUsage{InputTokens: 1_000_000, CachedInputTokens: 1_000_000, OutputTokens: 100_000})
+	if source != "prices" || math.Abs(cost-2.1) > 1e-9 {
+		t.Fatalf("priced cost = %v %q", cost, source)
+	}
+	// Without a model the provider entry applies; bare totals use the input rate.
+	if cost, _ := usageCost(cfg, "codex", "", agentUsage{TotalTokens: 500_000}); math.Abs(cost-1) > 1e-9 {
+		t.Fatalf("provider cost = %v", cost)
+	}
+	if cost, source := usageCost(cfg, "claude", "sonnet", agentUsage{OutputTokens: 10, CostUSD: 0.5}); cost != 0.5 || source != "provider" {
+		t.Fatalf("reported cost = %v %q", cost, source)
+	}
+	if cost, source := usageCost(cfg, "claude", "sonnet", agentUsage{OutputTokens: 10}); cost != 0 || source != "" {
+		t.Fatalf("unpriced cost = %v %q", cost, source)
+	}
+}
+
+func TestRecordAgentUsageAndReport(t *testing.T) {
+	cfg := bridgeConfig{
+		AgentProvider:  "codex",
+		CodexModel:     "gpt-5",
+		UsageLogFile:   filepath.Join(t.TempDir(), "usage.jsonl"),
+		ModelPrices:    map[string]modelPrice{"gpt-5": {Input: 1, Output: 1, CachedInput: 1}},
+		DailyBudgetUSD: 1.5,
+	}
+	started := time.Now().Add(-2 * time.Second)
+
+	if alert := recordAgentUsage(cfg, 1, started, agentUsage{InputTokens: 1_000_000}, nil); alert != "" {
+		t.Fatalf("alert below budget: %q", alert)
+	}
+	if alert := recordAgentUsage(cfg, 2, started, agentUsage{OutputTokens: 1_000_000}, nil); !strings.Contains(alert, "daily budget reached") {
+		t.Fatalf("missing budget alert: %q", alert)
+	}
+	// Already over budget: no repeated alert.
+	claude := cfg
+	claude.AgentProvider = "claude"
+	if alert := recordAgentUsage(claude, 2, started, agentUsage{CostUSD: 0.25}, errors.New("boom")); alert != "" {
+		t.Fatalf("repeated alert: %q", alert)
+	}
+
+	since, _ := usagePeriodStart("today", time.Now())
+	records, err := readUsageRecords(cfg, since)
+	if err != nil {
+		t.Fatalf("readUsageRecords: %v", err)
+	}
+	if len(records) != 3 || records[0].DurationMs < 2000 || !strings.HasPrefix(records[2].Outcome, "error") {
+		t.Fatalf("records = %+v", records)
+	}
+	report := formatUsageReport(cfg, "today", since, records)
+	for _, want := range []string{"3 runs", "$2.25", "codex (gpt-5): 2 runs", "claude: 1 runs", "by chat:", "- 2: 2 runs", "daily budget: $2.25 of $1.50"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report missing %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestUsagePeriodStart(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 18, 15, 4, 0, 0, time.UTC)
+	week, _ := usagePeriodStart("week", now)
+	month, _ := usagePeriodStart("month", now)
+	if !week.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) || !month.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("week=%v month=%v", week, month)
+	}
+	if _, ok := usagePeriodStart("year", now); ok {
+		t.Fatal("unknown period accepted")
+	}
+	if p, ok := parseUsageCommand("/usage"); !ok || p != "today" {
+		t.Fatalf("default period = %q", p)
+	}
+}